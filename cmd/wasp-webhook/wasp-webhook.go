@@ -0,0 +1,7 @@
+package main
+
+import "github.com/openshift-virtualization/wasp-agent/pkg/wasp/webhook"
+
+func main() {
+	webhook.Execute()
+}
@@ -25,6 +25,19 @@ echo "VERBOSITY=${VERBOSITY}"
 echo "PULL_POLICY=${PULL_POLICY}"
 echo "WASP_NAMESPACE=${WASP_NAMESPACE}"
 echo "DEPLOY_PROMETHEUS_RULE=${DEPLOY_PROMETHEUS_RULE}"
+echo "DEPLOY_WEBHOOK=${DEPLOY_WEBHOOK}"
+echo "WASP_FLAVOUR=${WASP_FLAVOUR}"
+echo "WASP_NODE_SELECTOR=${WASP_NODE_SELECTOR}"
+echo "WASP_TOLERATIONS=${WASP_TOLERATIONS}"
+echo "WASP_AFFINITY=${WASP_AFFINITY}"
+echo "WASP_RESOURCE_REQUESTS=${WASP_RESOURCE_REQUESTS}"
+echo "WASP_RESOURCE_LIMITS=${WASP_RESOURCE_LIMITS}"
+echo "WASP_EXTRA_ENV=${WASP_EXTRA_ENV}"
+echo "WASP_PRIORITY_CLASS=${WASP_PRIORITY_CLASS}"
+echo "WASP_UPDATE_STRATEGY=${WASP_UPDATE_STRATEGY}"
+echo "WASP_MAX_UNAVAILABLE=${WASP_MAX_UNAVAILABLE}"
+echo "WASP_SWAP_DISABLED_PRIORITY_CLASSES=${WASP_SWAP_DISABLED_PRIORITY_CLASSES}"
+echo "WASP_SWAP_PROVISIONING=${WASP_SWAP_PROVISIONING}"
 
 source "${script_dir}"/resource-generator.sh
 
@@ -32,6 +45,9 @@ mkdir -p "${MANIFEST_GENERATED_DIR}/"
 
 #generate operator related manifests used to deploy wasp with operator-framework
 generateResourceManifest $generator $MANIFEST_GENERATED_DIR "operator" "everything" "operator-everything.yaml.in"
+#generate the WaspAgent CRD and wasp-operator, which deploys the resources above from a WaspAgent CR
+generateResourceManifest $generator $MANIFEST_GENERATED_DIR "operator" "wasp-crd" "wasp-crd.yaml.in"
+generateResourceManifest $generator $MANIFEST_GENERATED_DIR "operator" "wasp-operator" "wasp-operator.yaml.in"
 
 
 #process templated manifests and populate them with generated manifests
@@ -39,4 +55,7 @@ tempDir=${MANIFEST_TEMPLATE_DIR}
 processDirTemplates ${tempDir} ${OUT_DIR}/manifests ${OUT_DIR}/manifests/templates ${generator} ${MANIFEST_GENERATED_DIR}
 processDirTemplates ${tempDir}/release ${OUT_DIR}/manifests/release ${OUT_DIR}/manifests/templates/release ${generator} ${MANIFEST_GENERATED_DIR}
 
-
+#generate the Helm chart, the Kustomize base and the OLM bundle
+generatePackagedManifests ${generator} "helm" ${OUT_DIR}/manifests/helm
+generatePackagedManifests ${generator} "kustomize" ${OUT_DIR}/manifests/kustomize
+generatePackagedManifests ${generator} "olm-bundle" ${OUT_DIR}/manifests/olm-bundle
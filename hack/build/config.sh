@@ -19,7 +19,24 @@ VERBOSITY=${VERBOSITY:-1}
 PULL_POLICY=${PULL_POLICY:-Always}
 WASP_NAMESPACE=${WASP_NAMESPACE:-wasp}
 DEPLOY_PROMETHEUS_RULE=${DEPLOY_PROMETHEUS_RULE:-false}
+# deploys wasp-webhook, which stamps the swap policy of pods at admission, it needs cert-manager on kubernetes
+DEPLOY_WEBHOOK=${DEPLOY_WEBHOOK:-false}
 CR_NAME=${CR_NAME:-wasp}
+# openshift, kubernetes, or auto to probe the cluster of KUBECONFIG
+WASP_FLAVOUR=${WASP_FLAVOUR:-openshift}
+# scheduling, resources, environment and update strategy of wasp-agent, see the flags of tools/manifest-generator
+WASP_NODE_SELECTOR=${WASP_NODE_SELECTOR:-}
+WASP_TOLERATIONS=${WASP_TOLERATIONS:-}
+WASP_AFFINITY=${WASP_AFFINITY:-}
+WASP_RESOURCE_REQUESTS=${WASP_RESOURCE_REQUESTS:-}
+WASP_RESOURCE_LIMITS=${WASP_RESOURCE_LIMITS:-}
+WASP_EXTRA_ENV=${WASP_EXTRA_ENV:-}
+WASP_PRIORITY_CLASS=${WASP_PRIORITY_CLASS:-}
+WASP_UPDATE_STRATEGY=${WASP_UPDATE_STRATEGY:-}
+WASP_MAX_UNAVAILABLE=${WASP_MAX_UNAVAILABLE:-}
+WASP_SWAP_DISABLED_PRIORITY_CLASSES=${WASP_SWAP_DISABLED_PRIORITY_CLASSES:-}
+# mounts the root of the host on kubernetes, for wasp-agent to provision swap
+WASP_SWAP_PROVISIONING=${WASP_SWAP_PROVISIONING:-false}
 
 function parseTestOpts() {
     pkgs=""
@@ -19,6 +19,20 @@ script_dir="$(cd "$(dirname "$0")" && pwd -P)"
 source "${script_dir}"/common.sh
 source "${script_dir}"/config.sh
 
+workloadFlags=(
+    -node-selector="${WASP_NODE_SELECTOR}"
+    -tolerations="${WASP_TOLERATIONS}"
+    -affinity="${WASP_AFFINITY}"
+    -resource-requests="${WASP_RESOURCE_REQUESTS}"
+    -resource-limits="${WASP_RESOURCE_LIMITS}"
+    -extra-env="${WASP_EXTRA_ENV}"
+    -priority-class="${WASP_PRIORITY_CLASS}"
+    -update-strategy="${WASP_UPDATE_STRATEGY}"
+    -max-unavailable="${WASP_MAX_UNAVAILABLE}"
+    -swap-disabled-priority-classes="${WASP_SWAP_DISABLED_PRIORITY_CLASSES}"
+    -swap-provisioning="${WASP_SWAP_PROVISIONING}"
+)
+
 #all generated files are placed in manifests/generated
 function generateResourceManifest() {
     generator=$1
@@ -44,7 +58,10 @@ function generateResourceManifest() {
             -verbosity="${VERBOSITY}" \
             -pull-policy="${PULL_POLICY}" \
             -namespace="${WASP_NAMESPACE}" \
-            -deploy-prometheus-rule="${DEPLOY_PROMETHEUS_RULE}"
+            -flavour="${WASP_FLAVOUR}" \
+            -deploy-prometheus-rule="${DEPLOY_PROMETHEUS_RULE}" \
+            -deploy-webhook="${DEPLOY_WEBHOOK}" \
+            "${workloadFlags[@]}"
     ) 1>>"${targetDir}/"$manifestName
     (
         ${generator} -resource-type=${resourceType} \
@@ -57,7 +74,10 @@ function generateResourceManifest() {
             -verbosity="${VERBOSITY}" \
             -pull-policy="{{ pull_policy }}" \
             -namespace="{{ wasp_namespace }}" \
-            -deploy-prometheus-rule="${DEPLOY_PROMETHEUS_RULE}"
+            -flavour="${WASP_FLAVOUR}" \
+            -deploy-prometheus-rule="${DEPLOY_PROMETHEUS_RULE}" \
+            -deploy-webhook="${DEPLOY_WEBHOOK}" \
+            "${workloadFlags[@]}"
     ) 1>>"${targetDir}/"$manifestNamej2
 
     # Remove empty lines at the end of files which are added by go templating
@@ -116,7 +136,9 @@ function populateResourceManifest() {
             -pull-policy="${PULL_POLICY}" \
             -cr-name="${CR_NAME}" \
             -namespace="${WASP_NAMESPACE}" \
+            -flavour="${WASP_FLAVOUR}" \
             -deploy-prometheus-rule="${DEPLOY_PROMETHEUS_RULE}" \
+            -deploy-webhook="${DEPLOY_WEBHOOK}" \
             -generated-manifests-path=${generatedManifests}
     ) 1>>"${targetDir}/"$outfile
 
@@ -127,10 +149,12 @@ function populateResourceManifest() {
             -operator-version="{{ operator_version }}" \
             -deploy-cluster-resources="true" \
             -deploy-prometheus-rule="{{ DEPLOY_PROMETHEUS_RULE }}" \
+            -deploy-webhook="{{ DEPLOY_WEBHOOK }}" \
             -operator-image="{{ operator_image_name }}" \
             -verbosity="${VERBOSITY}" \
             -pull-policy="{{ pull_policy }}" \
             -namespace="{{ wasp_namespace }}" \
+            -flavour="${WASP_FLAVOUR}" \
             -generated-manifests-path=${generatedManifests}
     ) 1>>"${tmplTargetDir}/"$outfile".j2"
 
@@ -138,3 +162,25 @@ function populateResourceManifest() {
     find ${targetDir}/ -type f -exec sed -i {} -e '${/^$/d;}' \;
     find ${tmplTargetDir}/ -type f -exec sed -i {} -e '${/^$/d;}' \;
 }
+
+# the Helm chart, the Kustomize base and the OLM bundle are generated in their own directories, e.g. _out/manifests/helm
+function generatePackagedManifests() {
+    generator=$1
+    outputFormat=$2
+    targetDir=$3
+
+    rm -rf ${targetDir}
+    mkdir -p ${targetDir}
+
+    ${generator} -output-format=${outputFormat} \
+        -output-dir=${targetDir} \
+        -operator-version="${DOCKER_TAG}" \
+        -operator-image="${DOCKER_PREFIX}/${WASP_IMAGE_NAME}:${DOCKER_TAG}" \
+        -verbosity="${VERBOSITY}" \
+        -pull-policy="${PULL_POLICY}" \
+        -namespace="${WASP_NAMESPACE}" \
+        -flavour="${WASP_FLAVOUR}" \
+        -deploy-prometheus-rule="${DEPLOY_PROMETHEUS_RULE}" \
+        -deploy-webhook="${DEPLOY_WEBHOOK}" \
+        "${workloadFlags[@]}"
+}
@@ -0,0 +1,4 @@
+// Package v1alpha1 contains the WaspAgent API, which configures the wasp-agent deployed by the wasp-operator
+// +kubebuilder:object:generate=true
+// +groupName=wasp.io
+package v1alpha1
@@ -0,0 +1,90 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+)
+
+// WaspAgent deploys and configures wasp-agent on the nodes of the cluster
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=wasp
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+type WaspAgent struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WaspAgentSpec   `json:"spec"`
+	Status WaspAgentStatus `json:"status,omitempty"`
+}
+
+// WaspAgentSpec defines the desired state of wasp-agent
+type WaspAgentSpec struct {
+	// Image of wasp-agent, defaults to the image of the operator
+	// +optional
+	Image string `json:"image,omitempty"`
+	// ImagePullPolicy of wasp-agent
+	// +kubebuilder:validation:Enum=Always;IfNotPresent;Never
+	// +optional
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Verbosity of the wasp-agent logs
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Verbosity *int32 `json:"verbosity,omitempty"`
+	// Workload restricts the nodes wasp-agent runs on, e.g. to the nodes with swap
+	// +optional
+	Workload sdkapi.NodePlacement `json:"workload,omitempty"`
+	// Policy configures how wasp-agent grants swap and evicts pods
+	// +optional
+	Policy WaspAgentPolicy `json:"policy,omitempty"`
+	// DeployPrometheusRule deploys the alerts, and the Service and ServiceMonitor exposing the metrics of wasp-agent
+	// +optional
+	DeployPrometheusRule bool `json:"deployPrometheusRule,omitempty"`
+	// DeployWebhook deploys wasp-webhook, which stamps the swap policy annotations on pods at admission and rejects
+	// contradictory ones. It needs cert-manager on Kubernetes.
+	// +optional
+	DeployWebhook bool `json:"deployWebhook,omitempty"`
+}
+
+// WaspAgentPolicy configures how wasp-agent grants swap and evicts pods, unset fields keep the wasp-agent defaults
+type WaspAgentPolicy struct {
+	// MemoryProtection protects the memory of critical, guaranteed and annotated pods with memory.low or memory.min
+	// +kubebuilder:validation:Enum=low;min
+	// +optional
+	MemoryProtection string `json:"memoryProtection,omitempty"`
+	// RequireEncryptedSwap refuses swap to the pods of nodes with unencrypted swap
+	// +optional
+	RequireEncryptedSwap bool `json:"requireEncryptedSwap,omitempty"`
+	// SwapPressureTaint taints the nodes under swap pressure with wasp.io/swap-pressure:NoSchedule
+	// +optional
+	SwapPressureTaint bool `json:"swapPressureTaint,omitempty"`
+	// SwapUtilizationThresholdPercent is the swap utilization above which pods are evicted
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	SwapUtilizationThresholdPercent *int32 `json:"swapUtilizationThresholdPercent,omitempty"`
+	// MaxConcurrentMigrations is the number of VMs migrated away from a node at once, 0 evicts VMs instead
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxConcurrentMigrations *int32 `json:"maxConcurrentMigrations,omitempty"`
+	// SwapDisabledPriorityClasses are the priority classes whose pods get no swap, on top of the critical ones.
+	// It is enforced by wasp-webhook.
+	// +optional
+	SwapDisabledPriorityClasses []string `json:"swapDisabledPriorityClasses,omitempty"`
+}
+
+// WaspAgentStatus defines the observed state of wasp-agent
+type WaspAgentStatus struct {
+	sdkapi.Status `json:",inline"`
+}
+
+// WaspAgentList is a list of WaspAgent
+// +kubebuilder:object:root=true
+type WaspAgentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []WaspAgent `json:"items"`
+}
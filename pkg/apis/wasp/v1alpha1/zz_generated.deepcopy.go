@@ -0,0 +1,136 @@
+//go:build !ignore_autogenerated
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WaspAgent) DeepCopyInto(out *WaspAgent) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WaspAgent.
+func (in *WaspAgent) DeepCopy() *WaspAgent {
+	if in == nil {
+		return nil
+	}
+	out := new(WaspAgent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WaspAgent) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WaspAgentList) DeepCopyInto(out *WaspAgentList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WaspAgent, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WaspAgentList.
+func (in *WaspAgentList) DeepCopy() *WaspAgentList {
+	if in == nil {
+		return nil
+	}
+	out := new(WaspAgentList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WaspAgentList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WaspAgentPolicy) DeepCopyInto(out *WaspAgentPolicy) {
+	*out = *in
+	if in.SwapUtilizationThresholdPercent != nil {
+		in, out := &in.SwapUtilizationThresholdPercent, &out.SwapUtilizationThresholdPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxConcurrentMigrations != nil {
+		in, out := &in.MaxConcurrentMigrations, &out.MaxConcurrentMigrations
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SwapDisabledPriorityClasses != nil {
+		in, out := &in.SwapDisabledPriorityClasses, &out.SwapDisabledPriorityClasses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WaspAgentPolicy.
+func (in *WaspAgentPolicy) DeepCopy() *WaspAgentPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(WaspAgentPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WaspAgentSpec) DeepCopyInto(out *WaspAgentSpec) {
+	*out = *in
+	if in.Verbosity != nil {
+		in, out := &in.Verbosity, &out.Verbosity
+		*out = new(int32)
+		**out = **in
+	}
+	in.Workload.DeepCopyInto(&out.Workload)
+	in.Policy.DeepCopyInto(&out.Policy)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WaspAgentSpec.
+func (in *WaspAgentSpec) DeepCopy() *WaspAgentSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WaspAgentSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WaspAgentStatus) DeepCopyInto(out *WaspAgentStatus) {
+	*out = *in
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WaspAgentStatus.
+func (in *WaspAgentStatus) DeepCopy() *WaspAgentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WaspAgentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
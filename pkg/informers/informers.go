@@ -13,11 +13,18 @@ import (
 	"time"
 )
 
-func GetPodInformer(waspCli client.WaspClient) cache.SharedIndexInformer {
-	listWatcher := NewListWatchFromClient(waspCli.CoreV1().RESTClient(), "pods", metav1.NamespaceAll, fields.Everything(), labels.Everything())
+// GetPodInformer watches the pods scheduled on the node the agent runs on
+func GetPodInformer(waspCli client.WaspClient, nodeName string) cache.SharedIndexInformer {
+	listWatcher := NewListWatchFromClient(waspCli.CoreV1().RESTClient(), "pods", metav1.NamespaceAll, fields.OneTermEqualSelector("spec.nodeName", nodeName), labels.Everything())
 	return cache.NewSharedIndexInformer(listWatcher, &v1.Pod{}, 1*time.Hour, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
 }
 
+// GetNodeInformer watches the node the agent runs on
+func GetNodeInformer(waspCli client.WaspClient, nodeName string) cache.SharedIndexInformer {
+	listWatcher := NewListWatchFromClient(waspCli.CoreV1().RESTClient(), "nodes", metav1.NamespaceAll, fields.OneTermEqualSelector("metadata.name", nodeName), labels.Everything())
+	return cache.NewSharedIndexInformer(listWatcher, &v1.Node{}, 1*time.Hour, cache.Indexers{})
+}
+
 // NewListWatchFromClient creates a new ListWatch from the specified client, resource, kubevirtNamespace and field selector.
 func NewListWatchFromClient(c cache.Getter, resource string, namespace string, fieldSelector fields.Selector, labelSelector labels.Selector) *cache.ListWatch {
 	listFunc := func(options metav1.ListOptions) (runtime.Object, error) {
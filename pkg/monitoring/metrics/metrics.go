@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"github.com/machadovilaca/operator-observability/pkg/operatormetrics"
+	v1lister "k8s.io/client-go/listers/core/v1"
+)
+
+const metricPrefix = "wasp_"
+
+var (
+	podLister v1lister.PodLister
+	nodeName  string
+)
+
+// SetupMetrics registers the metrics of the agent running on the given node
+func SetupMetrics(lister v1lister.PodLister, node string) error {
+	podLister = lister
+	nodeName = node
+
+	return operatormetrics.RegisterCollector(pressureCollector, zswapCollector, swapEncryptionCollector)
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"github.com/machadovilaca/operator-observability/pkg/operatormetrics"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/psi"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	pressureCollector = operatormetrics.Collector{
+		Metrics: []operatormetrics.Metric{
+			nodeMemoryPressure,
+			podMemoryPressure,
+		},
+		CollectCallback: pressureCollectorCallback,
+	}
+
+	nodeMemoryPressure = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "node_memory_pressure_percent",
+			Help: "Share of time in which some or all tasks of the node were stalled on memory, " +
+				"averaged over the window, from /proc/pressure/memory.",
+		},
+		[]string{"node", "type", "window"},
+	)
+
+	podMemoryPressure = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "pod_memory_pressure_percent",
+			Help: "Share of time in which some or all tasks of the pod were stalled on memory, " +
+				"averaged over the window, from the memory.pressure file of the pod cgroup.",
+		},
+		[]string{"node", "namespace", "pod", "type", "window"},
+	)
+)
+
+func pressureCollectorCallback() []operatormetrics.CollectorResult {
+	var results []operatormetrics.CollectorResult
+
+	nodeStats, err := psi.ReadNodeMemoryPressure()
+	if err != nil {
+		log.Log.Errorf("metrics: couldn't read node memory pressure: %v", err)
+	} else {
+		results = append(results, pressureResults(nodeMemoryPressure, []string{nodeName}, nodeStats)...)
+	}
+
+	if podLister == nil {
+		return results
+	}
+	pods, err := podLister.List(labels.Everything())
+	if err != nil {
+		log.Log.Errorf("metrics: couldn't list pods: %v", err)
+		return results
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != nodeName || pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		dirPath, err := cgroup.GetPodCgroupPath(pod)
+		if err != nil {
+			log.Log.V(4).Infof("metrics: couldn't get cgroup of pod %v/%v: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		podStats, err := psi.ReadCgroupMemoryPressure(dirPath)
+		if err != nil {
+			log.Log.V(4).Infof("metrics: couldn't read memory pressure of pod %v/%v: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		results = append(results, pressureResults(podMemoryPressure, []string{nodeName, pod.Namespace, pod.Name}, podStats)...)
+	}
+
+	return results
+}
+
+func pressureResults(metric operatormetrics.Metric, labels []string, stats psi.Stats) []operatormetrics.CollectorResult {
+	var results []operatormetrics.CollectorResult
+	for _, typed := range []struct {
+		name string
+		line psi.Line
+	}{
+		{"some", stats.Some},
+		{"full", stats.Full},
+	} {
+		for _, window := range []struct {
+			name  string
+			value float64
+		}{
+			{"avg10", typed.line.Avg10},
+			{"avg60", typed.line.Avg60},
+			{"avg300", typed.line.Avg300},
+		} {
+			results = append(results, operatormetrics.CollectorResult{
+				Metric: metric,
+				Labels: append(append([]string{}, labels...), typed.name, window.name),
+				Value:  window.value,
+			})
+		}
+	}
+	return results
+}
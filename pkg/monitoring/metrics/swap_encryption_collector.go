@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"github.com/machadovilaca/operator-observability/pkg/operatormetrics"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
+)
+
+var (
+	swapEncryptionCollector = operatormetrics.Collector{
+		Metrics: []operatormetrics.Metric{
+			swapDeviceEncrypted,
+		},
+		CollectCallback: swapEncryptionCollectorCallback,
+	}
+
+	swapDeviceEncrypted = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "swap_device_encrypted",
+			Help: "Whether the swap device keeps the swapped out pages away from the disks in cleartext (1) or not (0).",
+		},
+		[]string{"node", "device", "encryption"},
+	)
+)
+
+func swapEncryptionCollectorCallback() []operatormetrics.CollectorResult {
+	encryptions, err := swap.ReadEncryptions()
+	if err != nil {
+		log.Log.Errorf("metrics: couldn't detect the swap encryption: %v", err)
+		return nil
+	}
+
+	var results []operatormetrics.CollectorResult
+	for device, encryption := range encryptions {
+		value := 0.0
+		if encryption.Encrypted() {
+			value = 1
+		}
+		results = append(results, operatormetrics.CollectorResult{
+			Metric: swapDeviceEncrypted,
+			Labels: []string{nodeName, device, string(encryption)},
+			Value:  value,
+		})
+	}
+	return results
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"github.com/machadovilaca/operator-observability/pkg/operatormetrics"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
+)
+
+var (
+	zswapCollector = operatormetrics.Collector{
+		Metrics: []operatormetrics.Metric{
+			zswapPoolBytes,
+			zswapStoredBytes,
+			zswapCompressionRatio,
+			zswapWrittenBackPages,
+			zramOrigDataBytes,
+			zramComprDataBytes,
+			zramMemUsedBytes,
+		},
+		CollectCallback: zswapCollectorCallback,
+	}
+
+	zswapPoolBytes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "zswap_pool_bytes",
+			Help: "Memory used by the compressed zswap pool.",
+		},
+		[]string{"node"},
+	)
+
+	zswapStoredBytes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "zswap_stored_bytes",
+			Help: "Uncompressed size of the pages held by the zswap pool.",
+		},
+		[]string{"node"},
+	)
+
+	zswapCompressionRatio = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "zswap_compression_ratio",
+			Help: "Ratio between the uncompressed and the compressed size of the zswap pool.",
+		},
+		[]string{"node"},
+	)
+
+	zswapWrittenBackPages = operatormetrics.NewCounterVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "zswap_written_back_pages_total",
+			Help: "Pages written back from the zswap pool to the swap devices.",
+		},
+		[]string{"node"},
+	)
+
+	zramOrigDataBytes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "zram_orig_data_bytes",
+			Help: "Uncompressed size of the data stored in the zram device.",
+		},
+		[]string{"node", "device"},
+	)
+
+	zramComprDataBytes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "zram_compr_data_bytes",
+			Help: "Compressed size of the data stored in the zram device.",
+		},
+		[]string{"node", "device"},
+	)
+
+	zramMemUsedBytes = operatormetrics.NewGaugeVec(
+		operatormetrics.MetricOpts{
+			Name: metricPrefix + "zram_mem_used_bytes",
+			Help: "Memory used by the zram device, including the allocator overhead.",
+		},
+		[]string{"node", "device"},
+	)
+)
+
+func zswapCollectorCallback() []operatormetrics.CollectorResult {
+	var results []operatormetrics.CollectorResult
+
+	if enabled, err := swap.ZswapEnabled(); err != nil {
+		log.Log.V(4).Infof("metrics: couldn't tell whether zswap is enabled: %v", err)
+	} else if enabled {
+		stats, err := swap.ReadZswapStats()
+		if err != nil {
+			log.Log.Errorf("metrics: couldn't read zswap stats: %v", err)
+		} else {
+			results = append(results,
+				operatormetrics.CollectorResult{Metric: zswapPoolBytes, Labels: []string{nodeName}, Value: float64(stats.PoolBytes)},
+				operatormetrics.CollectorResult{Metric: zswapStoredBytes, Labels: []string{nodeName}, Value: float64(stats.StoredBytes)},
+				operatormetrics.CollectorResult{Metric: zswapCompressionRatio, Labels: []string{nodeName}, Value: stats.CompressionRatio()},
+				operatormetrics.CollectorResult{Metric: zswapWrittenBackPages, Labels: []string{nodeName}, Value: float64(stats.WrittenBackPages)},
+			)
+		}
+	}
+
+	zramStats, err := swap.ReadZramStats()
+	if err != nil {
+		log.Log.Errorf("metrics: couldn't read zram stats: %v", err)
+		return results
+	}
+	for _, stats := range zramStats {
+		labels := []string{nodeName, stats.Device}
+		results = append(results,
+			operatormetrics.CollectorResult{Metric: zramOrigDataBytes, Labels: labels, Value: float64(stats.OrigDataBytes)},
+			operatormetrics.CollectorResult{Metric: zramComprDataBytes, Labels: labels, Value: float64(stats.ComprDataBytes)},
+			operatormetrics.CollectorResult{Metric: zramMemUsedBytes, Labels: labels, Value: float64(stats.MemUsedBytes)},
+		)
+	}
+
+	return results
+}
@@ -26,5 +26,18 @@ func nodeAlerts() []promv1.Rule {
 				healthImpactAlertLabelKey: "warning",
 			},
 		},
+		{
+			Alert: "NodeHighMemoryPressure",
+			Annotations: map[string]string{
+				"description": "High memory pressure detected at {{ $labels.node }}. All non-idle tasks were stalled on memory for more than 10% of the time in the last minute. Swapping is likely hurting the workloads of the node.",
+				"summary":     "High memory pressure detected at {{ $labels.node }}.",
+			},
+			Expr: intstr.FromString("wasp_node_memory_pressure_percent{type=\"full\",window=\"avg60\"} > 10"),
+			For:  ptr.To(promv1.Duration("5m")),
+			Labels: map[string]string{
+				severityAlertLabelKey:     "warning",
+				healthImpactAlertLabelKey: "warning",
+			},
+		},
 	}
 }
@@ -0,0 +1,403 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	waspv1 "github.com/openshift-virtualization/wasp-agent/pkg/apis/wasp/v1alpha1"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/args"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/operator"
+	secv1 "github.com/openshift/api/security/v1"
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk/callbacks"
+	sdkr "kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk/reconciler"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	controllerName = "wasp-operator-controller"
+
+	createVersionLabel          = "operator.wasp.io/createVersion"
+	updateVersionLabel          = "operator.wasp.io/updateVersion"
+	lastAppliedConfigAnnotation = "operator.wasp.io/lastAppliedConfiguration"
+	finalizerName               = "operator.wasp.io"
+
+	defaultVerbosity = 1
+	// resyncPeriod is how often the objects are reconciled, and how often a rollout in progress is checked
+	resyncPeriod = 30 * time.Second
+
+	rolloutReason = "DaemonSetRollingOut"
+
+	// agentConfigAPIVersion and agentConfigKind are the version of the configuration file of wasp-agent, see
+	// agent_config.APIVersion, which isn't imported to keep the agent packages out of the operator
+	agentConfigAPIVersion = "wasp.io/v1alpha1"
+	agentConfigKind       = "WaspAgentConfig"
+	// startupPolicyAnnotation holds the policy wasp-agent only reads on startup on the pod template of the DaemonSet,
+	// so that the pods roll out when it changes, the rest of the configuration is reloaded by wasp-agent
+	startupPolicyAnnotation = "operator.wasp.io/startupPolicy"
+)
+
+// Config is the configuration of wasp-operator, read from its environment
+type Config struct {
+	OperatorVersion string
+	// WaspImage is the default image of wasp-agent, used unless the CR sets one
+	WaspImage  string
+	Verbosity  string
+	PullPolicy string
+	Namespace  string
+	// Flavour is the flavour of the cluster, probed on startup
+	Flavour string
+}
+
+// ReconcileWaspAgent reconciles the WaspAgent CR into the objects deploying wasp-agent
+type ReconcileWaspAgent struct {
+	client     client.Client
+	scheme     *runtime.Scheme
+	config     Config
+	reconciler *sdkr.Reconciler
+	// monitoringAvailable tells whether the cluster serves the PrometheusRule and ServiceMonitor types
+	monitoringAvailable bool
+	recorder            record.EventRecorder
+	log                 logr.Logger
+}
+
+// Add creates the WaspAgent controller and adds it to the manager
+func Add(mgr manager.Manager, config Config, log logr.Logger) error {
+	r := &ReconcileWaspAgent{
+		client:              mgr.GetClient(),
+		scheme:              mgr.GetScheme(),
+		config:              config,
+		monitoringAvailable: isMonitoringAvailable(mgr.GetRESTMapper()),
+		recorder:            mgr.GetEventRecorderFor(controllerName),
+		log:                 log.WithName(controllerName),
+	}
+	if !r.monitoringAvailable {
+		r.log.Info("The monitoring.coreos.com API is not served, PrometheusRule and ServiceMonitor won't be deployed")
+	}
+	r.reconciler = sdkr.NewReconciler(r,
+		r.log,
+		mgr.GetClient(),
+		callbacks.NewCallbackDispatcher(r.log, mgr.GetClient(), mgr.GetClient(), mgr.GetScheme(), config.Namespace),
+		mgr.GetScheme(),
+		mgr.GetCache,
+		createVersionLabel,
+		updateVersionLabel,
+		lastAppliedConfigAnnotation,
+		resyncPeriod,
+		finalizerName,
+		true,
+		r.recorder,
+	).WithSanityChecker(r.checkSanity).
+		WithPerishablesSynchronizer(r.syncPerishables)
+
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	r.reconciler.WithController(c)
+	return r.reconciler.WatchCR()
+}
+
+func isMonitoringAvailable(mapper meta.RESTMapper) bool {
+	_, err := mapper.RESTMapping(promv1.SchemeGroupVersion.WithKind(promv1.PrometheusRuleKind).GroupKind())
+	return err == nil
+}
+
+// Reconcile creates, updates and upgrades the objects of the WaspAgent CR, and follows the rollout of wasp-agent
+func (r *ReconcileWaspAgent) Reconcile(_ context.Context, request reconcile.Request) (reconcile.Result, error) {
+	log := r.log.WithValues("Request.Name", request.Name)
+	log.Info("Reconciling WaspAgent")
+
+	result, err := r.reconciler.Reconcile(request, r.config.OperatorVersion, log)
+	if err != nil {
+		return result, err
+	}
+	return r.checkRollout(request.Name, result, log)
+}
+
+// checkRollout reports the WaspAgent as progressing until all the nodes run the current wasp-agent DaemonSet
+func (r *ReconcileWaspAgent) checkRollout(name string, result reconcile.Result, log logr.Logger) (reconcile.Result, error) {
+	cr := &waspv1.WaspAgent{}
+	if err := r.client.Get(context.TODO(), client.ObjectKey{Name: name}, cr); err != nil {
+		if errors.IsNotFound(err) {
+			return result, nil
+		}
+		return result, err
+	}
+	if cr.DeletionTimestamp != nil || cr.Status.Phase != sdkapi.PhaseDeployed {
+		return result, nil
+	}
+
+	ds := &appsv1.DaemonSet{}
+	if err := r.client.Get(context.TODO(), client.ObjectKey{Namespace: r.config.Namespace, Name: "wasp-agent"}, ds); err != nil {
+		return result, err
+	}
+	status := &cr.Status.Status
+	progressing := conditions.IsStatusConditionTrue(status.Conditions, conditions.ConditionProgressing)
+	if rolledOut, message := daemonSetRolledOut(ds); !rolledOut {
+		if !progressing {
+			log.Info("wasp-agent is rolling out", "message", message)
+			conditions.SetStatusCondition(&status.Conditions, conditions.Condition{
+				Type:    conditions.ConditionAvailable,
+				Status:  corev1.ConditionFalse,
+				Reason:  rolloutReason,
+				Message: message,
+			})
+			conditions.SetStatusCondition(&status.Conditions, conditions.Condition{
+				Type:    conditions.ConditionProgressing,
+				Status:  corev1.ConditionTrue,
+				Reason:  rolloutReason,
+				Message: message,
+			})
+			return result, r.client.Status().Update(context.TODO(), cr)
+		}
+		return result, nil
+	}
+	if progressing {
+		log.Info("wasp-agent rolled out")
+		sdk.MarkCrHealthyMessage(cr, status, "DeployCompleted", "Deployment Completed", r.recorder)
+		return result, r.client.Status().Update(context.TODO(), cr)
+	}
+	return result, nil
+}
+
+// daemonSetRolledOut tells whether the current template of the DaemonSet runs and is ready on all its nodes
+func daemonSetRolledOut(ds *appsv1.DaemonSet) (bool, string) {
+	if ds.Status.ObservedGeneration < ds.Generation {
+		return false, "waiting for the DaemonSet spec update to be observed"
+	}
+	desired := ds.Status.DesiredNumberScheduled
+	if ds.Status.UpdatedNumberScheduled < desired {
+		return false, fmt.Sprintf("%d out of %d wasp-agent pods are updated", ds.Status.UpdatedNumberScheduled, desired)
+	}
+	if ds.Status.NumberAvailable < desired {
+		return false, fmt.Sprintf("%d out of %d wasp-agent pods are available", ds.Status.NumberAvailable, desired)
+	}
+	return true, ""
+}
+
+// checkSanity only accepts a single WaspAgent, the first one created
+func (r *ReconcileWaspAgent) checkSanity(cr client.Object, log logr.Logger) (*reconcile.Result, error) {
+	list := &waspv1.WaspAgentList{}
+	if err := r.client.List(context.TODO(), list); err != nil {
+		return &reconcile.Result{}, err
+	}
+	created := cr.GetCreationTimestamp()
+	for _, other := range list.Items {
+		if other.Name != cr.GetName() && other.CreationTimestamp.Before(&created) {
+			log.Info("Another WaspAgent already exists", "name", other.Name)
+			result, err := r.reconciler.ReconcileError(cr, fmt.Sprintf("WaspAgent %s already deploys wasp-agent", other.Name))
+			return &result, err
+		}
+	}
+	return nil, nil
+}
+
+// syncPerishables applies the unstructured objects, which the sdk reconciler can't handle, and deletes the objects
+// the CR no longer asks for, e.g. the alerts once the Prometheus rule is disabled
+func (r *ReconcileWaspAgent) syncPerishables(cr client.Object, log logr.Logger) error {
+	_, unstructuredResources, err := r.resources(cr)
+	if err != nil {
+		return err
+	}
+	for _, obj := range unstructuredResources {
+		if err := controllerutil.SetControllerReference(cr, obj, r.scheme); err != nil {
+			return err
+		}
+		if err := r.client.Patch(context.TODO(), obj, client.Apply, client.FieldOwner(controllerName), client.ForceOwnership); err != nil {
+			return fmt.Errorf("failed to apply %v %v: %v", obj.GetKind(), obj.GetName(), err)
+		}
+		log.V(3).Info("Resource applied", "name", obj.GetName(), "type", obj.GetKind())
+	}
+	return r.reconciler.CleanupUnusedResources(log, cr)
+}
+
+// IsCreating tells whether the CR was just created and has not been reconciled yet
+func (r *ReconcileWaspAgent) IsCreating(cr client.Object) (bool, error) {
+	return cr.(*waspv1.WaspAgent).Status.Phase == "", nil
+}
+
+// Create returns an empty WaspAgent
+func (r *ReconcileWaspAgent) Create() client.Object {
+	return &waspv1.WaspAgent{}
+}
+
+// Status returns the status of the WaspAgent
+func (r *ReconcileWaspAgent) Status(cr client.Object) *sdkapi.Status {
+	return &cr.(*waspv1.WaspAgent).Status.Status
+}
+
+// GetAllResources returns the objects deploying wasp-agent, as configured by the WaspAgent
+func (r *ReconcileWaspAgent) GetAllResources(cr client.Object) ([]client.Object, error) {
+	resources, _, err := r.resources(cr)
+	return resources, err
+}
+
+// resources returns the typed objects of the WaspAgent apart from the unstructured ones, e.g. the node restriction
+// policy, which the sdk reconciler can't read back
+func (r *ReconcileWaspAgent) resources(cr client.Object) ([]client.Object, []*unstructured.Unstructured, error) {
+	args, err := FactoryArgs(cr.(*waspv1.WaspAgent), r.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !r.monitoringAvailable {
+		args.NamespacedArgs.DeployPrometheusRule = "false"
+	}
+	all, err := operator.CreateOperatorResourceGroup("everything", args)
+	if err != nil {
+		return nil, nil, err
+	}
+	var typed []client.Object
+	var untyped []*unstructured.Unstructured
+	for _, obj := range all {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			untyped = append(untyped, u)
+		} else {
+			typed = append(typed, obj)
+		}
+	}
+	return typed, untyped, nil
+}
+
+// GetDependantResourcesListObjects returns the types of the objects owned by the WaspAgent
+func (r *ReconcileWaspAgent) GetDependantResourcesListObjects() []client.ObjectList {
+	lists := []client.ObjectList{
+		&appsv1.DaemonSetList{},
+		&corev1.ServiceAccountList{},
+		&corev1.ServiceList{},
+		&corev1.ConfigMapList{},
+		&rbacv1.ClusterRoleList{},
+		&rbacv1.ClusterRoleBindingList{},
+	}
+	if r.config.Flavour != operator.FlavourKubernetes {
+		lists = append(lists, &secv1.SecurityContextConstraintsList{})
+	}
+	if r.monitoringAvailable {
+		lists = append(lists, &promv1.PrometheusRuleList{}, &promv1.ServiceMonitorList{})
+	}
+	lists = append(lists,
+		&appsv1.DeploymentList{},
+		&admissionregistrationv1.MutatingWebhookConfigurationList{},
+		&admissionregistrationv1.ValidatingWebhookConfigurationList{},
+	)
+	return lists
+}
+
+// FactoryArgs maps the spec of the WaspAgent to the arguments of the resource factories
+func FactoryArgs(cr *waspv1.WaspAgent, config Config) (*operator.FactoryArgs, error) {
+	image := cr.Spec.Image
+	if image == "" {
+		image = config.WaspImage
+	}
+	pullPolicy := string(cr.Spec.ImagePullPolicy)
+	if pullPolicy == "" {
+		pullPolicy = config.PullPolicy
+	}
+	verbosity := config.Verbosity
+	if cr.Spec.Verbosity != nil {
+		verbosity = strconv.Itoa(int(*cr.Spec.Verbosity))
+	}
+	if verbosity == "" {
+		verbosity = strconv.Itoa(defaultVerbosity)
+	}
+	agentConfig, startupPolicy, err := renderAgentConfig(cr.Spec.Policy)
+	if err != nil {
+		return nil, err
+	}
+	return &operator.FactoryArgs{
+		NamespacedArgs: args.FactoryArgs{
+			OperatorVersion:        config.OperatorVersion,
+			WaspImage:              image,
+			DeployClusterResources: "true",
+			DeployPrometheusRule:   strconv.FormatBool(cr.Spec.DeployPrometheusRule),
+			DeployWebhook:          strconv.FormatBool(cr.Spec.DeployWebhook),
+			Verbosity:              verbosity,
+			PullPolicy:             pullPolicy,
+			Namespace:              config.Namespace,
+		},
+		Image:     image,
+		Placement: cr.Spec.Workload,
+		Flavour:   config.Flavour,
+
+		AgentConfig:                 agentConfig,
+		PodAnnotations:              map[string]string{startupPolicyAnnotation: startupPolicy},
+		SwapDisabledPriorityClasses: cr.Spec.Policy.SwapDisabledPriorityClasses,
+	}, nil
+}
+
+// agentStartupPolicy is the part of the policy of the WaspAgent that wasp-agent only reads on startup
+type agentStartupPolicy struct {
+	MemoryProtection     string `json:"memoryProtection,omitempty"`
+	RequireEncryptedSwap bool   `json:"requireEncryptedSwap,omitempty"`
+	SwapPressureTaint    bool   `json:"swapPressureTaint,omitempty"`
+}
+
+// agentPolicy is the policy section of the configuration file of wasp-agent set by the WaspAgent
+type agentPolicy struct {
+	agentStartupPolicy      `json:",inline"`
+	MaxConcurrentMigrations *int32 `json:"maxConcurrentMigrations,omitempty"`
+}
+
+type agentThresholds struct {
+	SwapUtilizationThresholdFactor *float64 `json:"swapUtilizationThresholdFactor,omitempty"`
+}
+
+// agentConfig is the configuration file of wasp-agent, the fields the WaspAgent doesn't set keep the defaults of
+// wasp-agent
+type agentConfig struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Policy     agentPolicy     `json:"policy"`
+	Thresholds agentThresholds `json:"thresholds"`
+}
+
+// renderAgentConfig maps the policy of the WaspAgent to the configuration file of wasp-agent, and to the startup
+// policy annotated on its pods
+func renderAgentConfig(policy waspv1.WaspAgentPolicy) (string, string, error) {
+	config := agentConfig{
+		APIVersion: agentConfigAPIVersion,
+		Kind:       agentConfigKind,
+		Policy: agentPolicy{
+			agentStartupPolicy: agentStartupPolicy{
+				MemoryProtection:     policy.MemoryProtection,
+				RequireEncryptedSwap: policy.RequireEncryptedSwap,
+				SwapPressureTaint:    policy.SwapPressureTaint,
+			},
+			MaxConcurrentMigrations: policy.MaxConcurrentMigrations,
+		},
+	}
+	if policy.SwapUtilizationThresholdPercent != nil {
+		factor := float64(*policy.SwapUtilizationThresholdPercent) / 100
+		config.Thresholds.SwapUtilizationThresholdFactor = &factor
+	}
+	content, err := yaml.Marshal(config)
+	if err != nil {
+		return "", "", err
+	}
+	startupPolicy, err := json.Marshal(config.Policy.agentStartupPolicy)
+	if err != nil {
+		return "", "", err
+	}
+	return string(content), string(startupPolicy), nil
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	waspv1 "github.com/openshift-virtualization/wasp-agent/pkg/apis/wasp/v1alpha1"
+	agent_config "github.com/openshift-virtualization/wasp-agent/pkg/wasp/agent-config"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+)
+
+var _ = Describe("WaspAgent controller", func() {
+	config := Config{
+		OperatorVersion: "v0.1.0",
+		WaspImage:       "quay.io/openshift-virtualization/wasp-agent:v0.1.0",
+		Verbosity:       "2",
+		PullPolicy:      "IfNotPresent",
+		Namespace:       "wasp",
+	}
+
+	It("should default the arguments to the configuration of the operator", func() {
+		args, err := FactoryArgs(&waspv1.WaspAgent{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(args.Image).To(Equal(config.WaspImage))
+		Expect(args.NamespacedArgs.Verbosity).To(Equal("2"))
+		Expect(args.NamespacedArgs.PullPolicy).To(Equal("IfNotPresent"))
+		Expect(args.NamespacedArgs.Namespace).To(Equal("wasp"))
+		Expect(args.NamespacedArgs.DeployPrometheusRule).To(Equal("false"))
+		Expect(args.NamespacedArgs.DeployWebhook).To(Equal("false"))
+		Expect(args.Env).To(BeEmpty())
+		Expect(args.AgentConfig).To(Equal("apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\npolicy: {}\nthresholds: {}\n"))
+		Expect(args.PodAnnotations).To(HaveKeyWithValue(startupPolicyAnnotation, "{}"))
+	})
+
+	It("should map the spec of the WaspAgent", func() {
+		cr := &waspv1.WaspAgent{
+			Spec: waspv1.WaspAgentSpec{
+				Image:           "registry.example.com/wasp-agent:dev",
+				ImagePullPolicy: corev1.PullAlways,
+				Verbosity:       pointer.Int32(5),
+				Workload: sdkapi.NodePlacement{
+					NodeSelector: map[string]string{"node-role.kubernetes.io/worker": ""},
+				},
+				Policy: waspv1.WaspAgentPolicy{
+					SwapDisabledPriorityClasses: []string{"batch-low"},
+				},
+				DeployPrometheusRule: true,
+				DeployWebhook:        true,
+			},
+		}
+		args, err := FactoryArgs(cr, config)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(args.Image).To(Equal("registry.example.com/wasp-agent:dev"))
+		Expect(args.NamespacedArgs.PullPolicy).To(Equal("Always"))
+		Expect(args.NamespacedArgs.Verbosity).To(Equal("5"))
+		Expect(args.NamespacedArgs.DeployPrometheusRule).To(Equal("true"))
+		Expect(args.NamespacedArgs.DeployWebhook).To(Equal("true"))
+		Expect(args.SwapDisabledPriorityClasses).To(ConsistOf("batch-low"))
+		Expect(args.Placement.NodeSelector).To(HaveKey("node-role.kubernetes.io/worker"))
+	})
+
+	It("should map the policy to the configuration file of wasp-agent", func() {
+		content, startupPolicy, err := renderAgentConfig(waspv1.WaspAgentPolicy{
+			MemoryProtection:                "min",
+			RequireEncryptedSwap:            true,
+			SwapPressureTaint:               true,
+			SwapUtilizationThresholdPercent: pointer.Int32(85),
+			MaxConcurrentMigrations:         pointer.Int32(0),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(startupPolicy).To(Equal(`{"memoryProtection":"min","requireEncryptedSwap":true,"swapPressureTaint":true}`))
+
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		agentConfig, err := agent_config.Load(path, agent_config.Config{
+			Threadiness:  1,
+			ResyncPeriod: metav1.Duration{Duration: time.Minute},
+			CRISocket:    "/var/run/crio/crio.sock",
+			HostPaths: agent_config.HostPaths{
+				CrioConfig:       "/etc/crio/crio.conf",
+				CrioConfigDropIn: "/etc/crio/crio.conf.d",
+				OCIHooksDir:      "/run/containers/oci/hooks.d",
+			},
+			Policy:    agent_config.Policy{MaxConcurrentMigrations: 2},
+			Preflight: agent_config.Preflight{Interval: metav1.Duration{Duration: time.Minute}},
+			Reclaim:   agent_config.Reclaim{Interval: metav1.Duration{Duration: time.Minute}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(agentConfig.Policy).To(Equal(agent_config.Policy{
+			MemoryProtection:     "min",
+			RequireEncryptedSwap: true,
+			SwapPressureTaint:    true,
+		}))
+		Expect(agentConfig.Thresholds.SwapUtilizationThresholdFactor).To(Equal(0.85))
+	})
+
+	DescribeTable("should follow the rollout of the DaemonSet", func(status appsv1.DaemonSetStatus, generation int64, expected bool) {
+		ds := &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Generation: generation},
+			Status:     status,
+		}
+		rolledOut, _ := daemonSetRolledOut(ds)
+		Expect(rolledOut).To(Equal(expected))
+	},
+		Entry("rolled out", appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3}, int64(2), true),
+		Entry("spec not observed yet", appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3}, int64(2), false),
+		Entry("pods not updated", appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 1, NumberAvailable: 3}, int64(2), false),
+		Entry("pods not available", appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 2}, int64(2), false),
+	)
+})
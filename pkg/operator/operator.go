@@ -0,0 +1,109 @@
+/*
+ * This file is part of the Wasp project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2023,Red Hat, Inc.
+ *
+ */
+package operator
+
+import (
+	"flag"
+	"os"
+
+	waspv1 "github.com/openshift-virtualization/wasp-agent/pkg/apis/wasp/v1alpha1"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/monitoring/rules"
+	"github.com/openshift-virtualization/wasp-agent/pkg/operator/controller"
+	resources "github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/operator"
+	secv1 "github.com/openshift/api/security/v1"
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+)
+
+const leaderElectionID = "wasp-operator-lock"
+
+// Execute runs wasp-operator, which deploys wasp-agent as configured by the WaspAgent CR
+func Execute() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	config := controller.Config{
+		OperatorVersion: os.Getenv("OPERATOR_VERSION"),
+		WaspImage:       os.Getenv("WASP_IMAGE"),
+		Verbosity:       os.Getenv("VERBOSITY"),
+		PullPolicy:      os.Getenv("PULL_POLICY"),
+		Namespace:       os.Getenv("OPERATOR_NAMESPACE"),
+	}
+	if config.Namespace == "" || config.WaspImage == "" {
+		log.Log.Errorf("Operator: OPERATOR_NAMESPACE and WASP_IMAGE must be set")
+		os.Exit(1)
+	}
+	log.Log.Infof("Operator: version %v, deploying %v in namespace %v", config.OperatorVersion, config.WaspImage, config.Namespace)
+
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		extv1.AddToScheme,
+		secv1.Install,
+		promv1.AddToScheme,
+		waspv1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			panic(err)
+		}
+	}
+	if err := rules.SetupRules(); err != nil {
+		log.Log.Errorf("Operator: failed to set up the alerts: %v", err)
+		os.Exit(1)
+	}
+
+	restConfig := ctrl.GetConfigOrDie()
+	flavour, err := resources.DetectFlavour(discovery.NewDiscoveryClientForConfigOrDie(restConfig))
+	if err != nil {
+		log.Log.Errorf("Operator: failed to detect the flavour of the cluster: %v", err)
+		os.Exit(1)
+	}
+	config.Flavour = flavour
+	log.Log.Infof("Operator: deploying the %v flavour", config.Flavour)
+
+	logger := klog.NewKlogr()
+	ctrl.SetLogger(logger)
+	mgr, err := ctrl.NewManager(restConfig, manager.Options{
+		Scheme:                  scheme,
+		LeaderElection:          true,
+		LeaderElectionID:        leaderElectionID,
+		LeaderElectionNamespace: config.Namespace,
+	})
+	if err != nil {
+		log.Log.Errorf("Operator: failed to create the manager: %v", err)
+		os.Exit(1)
+	}
+	if err := controller.Add(mgr, config, logger); err != nil {
+		log.Log.Errorf("Operator: failed to create the controller: %v", err)
+		os.Exit(1)
+	}
+
+	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+		log.Log.Errorf("Operator: manager exited: %v", err)
+		os.Exit(1)
+	}
+}
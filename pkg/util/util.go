@@ -12,6 +12,23 @@ const (
 	// AppKubernetesComponentLabel is the Kubernetes recommended component label
 	AppKubernetesComponentLabel = "app.kubernetes.io/component"
 	OperatorServiceAccountName  = "wasp"
+	// WaspOperatorServiceAccountName is the service account of wasp-operator
+	WaspOperatorServiceAccountName = "wasp-operator"
+	// MetricsPort is the port on which wasp-agent serves its metrics
+	MetricsPort     = 8080
+	MetricsPortName = "metrics"
+	MetricsPath     = "/metrics"
+	// LivenessPath and ReadinessPath are the probes of wasp-agent, served on the metrics port
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+	// WebhookPort is the port of the optional wasp-webhook, serving the swap policy of the pods on WebhookMutatePath
+	// and WebhookValidatePath
+	WebhookPort         = 8443
+	WebhookMutatePath   = "/mutate-pods"
+	WebhookValidatePath = "/validate-pods"
+	// WebhookHealthPort serves the probes of wasp-webhook, and WebhookCertDir holds its serving certificate
+	WebhookHealthPort = 8081
+	WebhookCertDir    = "/etc/wasp-webhook/certs"
 )
 
 var commonLabels = map[string]string{
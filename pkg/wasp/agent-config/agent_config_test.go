@@ -0,0 +1,196 @@
+package agent_config
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func defaults() Config {
+	return Config{
+		Threadiness:  1,
+		ResyncPeriod: metav1.Duration{Duration: 20 * time.Second},
+		CRISocket:    "/var/run/crio/crio.sock",
+		HostPaths: HostPaths{
+			CrioConfig:       "/etc/crio/crio.conf",
+			CrioConfigDropIn: "/etc/crio/crio.conf.d",
+			OCIHooksDir:      "/run/containers/oci/hooks.d",
+		},
+		Policy: Policy{
+			MaxConcurrentMigrations: 2,
+		},
+		Thresholds: Thresholds{
+			SwapUtilizationThresholdFactor: 0.8,
+			GracePeriod:                    metav1.Duration{Duration: 30 * time.Second},
+		},
+		Preflight: Preflight{
+			Interval: metav1.Duration{Duration: 5 * time.Minute},
+		},
+		Reclaim: Reclaim{
+			Interval: metav1.Duration{Duration: time.Minute},
+			Factor:   0.05,
+		},
+	}
+}
+
+func writeConfig(path, content string) {
+	ExpectWithOffset(1, os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+}
+
+var _ = Describe("AgentConfig", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "config.yaml")
+	})
+
+	Context("Load", func() {
+		It("should return the defaults without a configuration file", func() {
+			config, err := Load(path, defaults())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.APIVersion).To(Equal(APIVersion))
+			Expect(config.Threadiness).To(Equal(1))
+			Expect(config.Thresholds.SwapUtilizationThresholdFactor).To(Equal(0.8))
+		})
+
+		It("should override the defaults with the fields of the file", func() {
+			writeConfig(path, `
+apiVersion: wasp.io/v1alpha1
+kind: WaspAgentConfig
+threadiness: 4
+resyncPeriod: 1m
+policy:
+  memoryProtection: min
+thresholds:
+  swapUtilizationThresholdFactor: 0.5
+`)
+			config, err := Load(path, defaults())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Threadiness).To(Equal(4))
+			Expect(config.ResyncPeriod.Duration).To(Equal(time.Minute))
+			Expect(config.Policy.MemoryProtection).To(Equal("min"))
+			Expect(config.Policy.MaxConcurrentMigrations).To(Equal(2))
+			Expect(config.Thresholds.SwapUtilizationThresholdFactor).To(Equal(0.5))
+			Expect(config.Thresholds.GracePeriod.Duration).To(Equal(30 * time.Second))
+		})
+
+		It("should read the swap, the proactive reclaim and the slices", func() {
+			writeConfig(path, `
+apiVersion: wasp.io/v1alpha1
+kind: WaspAgentConfig
+swap:
+  path: /var/swapfile
+  size: 8Gi
+  zswap:
+    enabled: true
+    compressor: zstd
+  zram:
+    size: 4Gi
+reclaim:
+  enabled: true
+  maxBytesPerInterval: 128Mi
+slices:
+  disableSystemSliceSwap: true
+  systemSliceIOLatencyTarget: 10ms
+  kubepodsSliceIOWeight: 50
+`)
+			config, err := Load(path, defaults())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Swap.Path).To(Equal("/var/swapfile"))
+			Expect(config.Swap.Size.Value()).To(Equal(int64(8 << 30)))
+			Expect(config.Swap.Zswap).To(Equal(Zswap{Enabled: true, Compressor: "zstd"}))
+			Expect(config.Swap.Zram.Size.Value()).To(Equal(int64(4 << 30)))
+			Expect(config.Reclaim.Enabled).To(BeTrue())
+			Expect(config.Reclaim.Factor).To(Equal(0.05))
+			Expect(config.Reclaim.MaxBytesPerInterval.Value()).To(Equal(int64(128 << 20)))
+			Expect(config.Slices.DisableSystemSliceSwap).To(BeTrue())
+			Expect(config.Slices.SystemSliceIOLatencyTarget.Duration).To(Equal(10 * time.Millisecond))
+			Expect(config.Slices.KubepodsSliceIOWeight).To(Equal(uint64(50)))
+		})
+
+		DescribeTable("should reject", func(content, message string) {
+			writeConfig(path, content)
+			_, err := Load(path, defaults())
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+			Entry("another version", "apiVersion: wasp.io/v2\nkind: WaspAgentConfig\n", "unsupported configuration"),
+			Entry("unknown fields", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nthreads: 2\n", "unknown field"),
+			Entry("no workers", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nthreadiness: 0\n", "threadiness"),
+			Entry("a relative host path", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\ncriSocket: crio.sock\n", "criSocket"),
+			Entry("an unknown memory protection", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\npolicy:\n  memoryProtection: high\n", "policy.memoryProtection"),
+			Entry("a factor above 1", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\npolicy:\n  swapHighFactor: 1.5\n", "policy.swapHighFactor"),
+			Entry("a negative grace period", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nthresholds:\n  gracePeriod: -1s\n", "thresholds.gracePeriod"),
+			Entry("a relative swap path", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nswap:\n  path: swapfile\n", "swap.path"),
+			Entry("a negative swap size", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nswap:\n  size: -1Gi\n", "swap.size"),
+			Entry("a zswap pool above the memory", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nswap:\n  zswap:\n    maxPoolPercent: 150\n", "swap.zswap.maxPoolPercent"),
+			Entry("no preflight interval", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\npreflight:\n  interval: 0s\n", "preflight.interval"),
+			Entry("a reclaim factor above 1", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nreclaim:\n  factor: 2\n", "reclaim.factor"),
+			Entry("an io weight above 10000", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nslices:\n  systemSliceIOWeight: 20000\n", "slices.systemSliceIOWeight"),
+			Entry("a negative shutdown timeout", "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nshutdown:\n  timeout: -1s\n", "shutdown.timeout"),
+		)
+	})
+
+	Context("RestartRequired", func() {
+		It("should only report the fields applied on startup", func() {
+			current := defaults()
+			next := defaults()
+			next.Threadiness = 2
+			next.HostPaths.OCIHooksDir = "/etc/containers/oci/hooks.d"
+			next.Policy.MemoryThrottlingFactor = 0.5
+			next.Thresholds.GracePeriod = metav1.Duration{Duration: time.Minute}
+			next.Shutdown.CleanupHostArtifacts = true
+			Expect(RestartRequired(&current, &next)).To(Equal([]string{"threadiness", "hostPaths"}))
+		})
+
+		It("should report the swap and enabling the proactive reclaim, not the reclaim passes and the slices", func() {
+			current := defaults()
+			next := defaults()
+			next.Swap.Zram.Compressor = "zstd"
+			next.Reclaim.Enabled = true
+			next.Reclaim.Factor = 0.1
+			next.Slices.DisableSystemSliceSwap = true
+			Expect(RestartRequired(&current, &next)).To(Equal([]string{"swap", "reclaim.enabled"}))
+		})
+	})
+
+	Context("Watcher", func() {
+		It("should only hand over valid changes", func() {
+			writeConfig(path, "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\n")
+			w, err := NewWatcher(path, defaults(), time.Second)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.reload()).To(BeNil())
+
+			writeConfig(path, "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nthreadiness: -1\n")
+			Expect(w.reload()).To(BeNil())
+			Expect(w.Config().Threadiness).To(Equal(1))
+
+			writeConfig(path, "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nthreadiness: 3\n")
+			config := w.reload()
+			Expect(config).ToNot(BeNil())
+			Expect(config.Threadiness).To(Equal(3))
+			Expect(w.Config()).To(Equal(config))
+
+			Expect(os.Remove(path)).To(Succeed())
+			config = w.reload()
+			Expect(config).ToNot(BeNil())
+			Expect(config.Threadiness).To(Equal(1))
+		})
+
+		It("should serve the configuration and the changes waiting for a restart", func() {
+			w, err := NewWatcher(path, defaults(), time.Second)
+			Expect(err).ToNot(HaveOccurred())
+			writeConfig(path, "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\nthreadiness: 3\n")
+			Expect(w.reload()).ToNot(BeNil())
+
+			recorder := httptest.NewRecorder()
+			w.ServeHTTP(recorder, httptest.NewRequest("GET", DebugPath, nil))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"threadiness":3`))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"pendingRestart":["threadiness"]`))
+		})
+	})
+})
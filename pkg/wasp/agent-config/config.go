@@ -0,0 +1,301 @@
+package agent_config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	limited_swap_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/limited-swap-manager"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion and Kind identify the version of the configuration file
+	APIVersion = "wasp.io/v1alpha1"
+	Kind       = "WaspAgentConfig"
+	// DefaultPath is where the wasp-agent ConfigMap is mounted
+	DefaultPath = "/etc/wasp/config.yaml"
+
+	maxIOWeight = 10000
+)
+
+// Config is the configuration of wasp-agent. The fields missing from the configuration file keep their defaults.
+type Config struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Threadiness is the number of workers setting the swap limits of the pods
+	Threadiness int `json:"threadiness"`
+	// ResyncPeriod is how often the swap limits of all the pods of the node are set again
+	ResyncPeriod metav1.Duration `json:"resyncPeriod"`
+	// CRISocket is the host path of the CRI-O socket
+	CRISocket  string     `json:"criSocket"`
+	HostPaths  HostPaths  `json:"hostPaths"`
+	Policy     Policy     `json:"policy"`
+	Thresholds Thresholds `json:"thresholds"`
+	Swap       Swap       `json:"swap"`
+	Preflight  Preflight  `json:"preflight"`
+	Reclaim    Reclaim    `json:"reclaim"`
+	Slices     Slices     `json:"slices"`
+	Shutdown   Shutdown   `json:"shutdown"`
+}
+
+// HostPaths are the host locations of the CRI-O configuration and of the OCI hooks
+type HostPaths struct {
+	CrioConfig       string `json:"crioConfig"`
+	CrioConfigDropIn string `json:"crioConfigDropIn"`
+	OCIHooksDir      string `json:"ociHooksDir"`
+}
+
+// Policy is how swap is granted to the pods and how the node is protected from swap pressure
+type Policy struct {
+	MemoryProtection         string          `json:"memoryProtection"`
+	MemoryThrottlingFactor   float64         `json:"memoryThrottlingFactor"`
+	SwapHighFactor           float64         `json:"swapHighFactor"`
+	ZswapMaxFactor           float64         `json:"zswapMaxFactor"`
+	RequireEncryptedSwap     bool            `json:"requireEncryptedSwap"`
+	SwapPressureTaint        bool            `json:"swapPressureTaint"`
+	PressureTransitionPeriod metav1.Duration `json:"pressureTransitionPeriod"`
+	MaxConcurrentMigrations  int             `json:"maxConcurrentMigrations"`
+}
+
+// Thresholds are the thresholds of the swap based eviction signals
+type Thresholds struct {
+	SwapUtilizationThresholdFactor    float64         `json:"swapUtilizationThresholdFactor"`
+	MaxAverageSwapInPagesPerSecond    float64         `json:"maxAverageSwapInPagesPerSecond"`
+	MaxAverageSwapOutPagesPerSecond   float64         `json:"maxAverageSwapOutPagesPerSecond"`
+	MaxMemoryPressureSomeAvg10Percent float64         `json:"maxMemoryPressureSomeAvg10Percent"`
+	MaxMemoryPressureFullAvg10Percent float64         `json:"maxMemoryPressureFullAvg10Percent"`
+	AverageWindowSize                 metav1.Duration `json:"averageWindowSize"`
+	GracePeriod                       metav1.Duration `json:"gracePeriod"`
+}
+
+// Swap is the swap wasp-agent provisions and the compressed swap it sets up on startup
+type Swap struct {
+	// Path is the host path of the swap file to create, or of the partition to use as swap, no swap is provisioned
+	// when empty
+	Path string `json:"path"`
+	// Size, RAMFraction and MemoryOverCommitPercent size the swap file, exactly one of them has to be set
+	Size                    resource.Quantity `json:"size"`
+	RAMFraction             float64           `json:"ramFraction"`
+	MemoryOverCommitPercent float64           `json:"memoryOverCommitPercent"`
+	// FormatDevice formats the partition even though it holds a filesystem or another signature
+	FormatDevice bool  `json:"formatDevice"`
+	Zswap        Zswap `json:"zswap"`
+	Zram         Zram  `json:"zram"`
+}
+
+// Zswap is the compressed cache in front of the swap devices, empty values keep the kernel defaults
+type Zswap struct {
+	Enabled        bool   `json:"enabled"`
+	Compressor     string `json:"compressor"`
+	Zpool          string `json:"zpool"`
+	MaxPoolPercent int    `json:"maxPoolPercent"`
+}
+
+// Zram is the compressed swap device in memory, none is set up when its size is zero
+type Zram struct {
+	Size       resource.Quantity `json:"size"`
+	Compressor string            `json:"compressor"`
+	Priority   int               `json:"priority"`
+}
+
+// Preflight is how often the node is checked for the prerequisites of wasp-agent
+type Preflight struct {
+	Interval metav1.Duration `json:"interval"`
+}
+
+// Reclaim is the proactive reclaim of the idle containers that opted in
+type Reclaim struct {
+	Enabled                               bool              `json:"enabled"`
+	Interval                              metav1.Duration   `json:"interval"`
+	Factor                                float64           `json:"factor"`
+	MaxBytesPerInterval                   resource.Quantity `json:"maxBytesPerInterval"`
+	MaxIdleCPUMillicores                  float64           `json:"maxIdleCPUMillicores"`
+	MaxIdleMemoryPressureSomeAvg60Percent float64           `json:"maxIdleMemoryPressureSomeAvg60Percent"`
+}
+
+// Slices are the settings enforced on the system and kubepods slices, zero values leave a setting untouched
+type Slices struct {
+	DisableSystemSliceSwap       bool            `json:"disableSystemSliceSwap"`
+	SystemSliceIOLatencyTarget   metav1.Duration `json:"systemSliceIOLatencyTarget"`
+	KubepodsSliceIOLatencyTarget metav1.Duration `json:"kubepodsSliceIOLatencyTarget"`
+	SystemSliceIOWeight          uint64          `json:"systemSliceIOWeight"`
+	KubepodsSliceIOWeight        uint64          `json:"kubepodsSliceIOWeight"`
+}
+
+// Shutdown is how wasp-agent stops on SIGTERM, it is read when the signal is received
+type Shutdown struct {
+	// Timeout bounds the draining of the pods waiting for their limits, it should stay below the termination grace
+	// period of the pods of the DaemonSet
+	Timeout metav1.Duration `json:"timeout"`
+	// CleanupHostArtifacts removes the OCI hook and its script from the host before exiting, new containers then
+	// don't get swap until wasp-agent starts again
+	CleanupHostArtifacts bool `json:"cleanupHostArtifacts"`
+}
+
+type namedValue[T any] struct {
+	name  string
+	value T
+}
+
+// Load reads the configuration file over the defaults, the defaults are returned when the file doesn't exist
+func Load(path string, defaults Config) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return parse(path, content, defaults)
+}
+
+// parse parses the content of the configuration file over the defaults, nil content stands for a missing file
+func parse(path string, content []byte, defaults Config) (*Config, error) {
+	config := defaults
+	config.APIVersion = APIVersion
+	config.Kind = Kind
+	if content == nil {
+		return &config, config.Validate()
+	}
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration %v: %v", path, err)
+	}
+	return &config, nil
+}
+
+// Validate checks the version of the configuration and the ranges of its values
+func (c *Config) Validate() error {
+	var errs []error
+	if c.APIVersion != APIVersion || c.Kind != Kind {
+		errs = append(errs, fmt.Errorf("unsupported configuration %v %v, expected %v %v", c.APIVersion, c.Kind, APIVersion, Kind))
+	}
+	if c.Threadiness < 1 {
+		errs = append(errs, fmt.Errorf("threadiness %v should be at least 1", c.Threadiness))
+	}
+	if c.ResyncPeriod.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("resyncPeriod %v should be positive", c.ResyncPeriod.Duration))
+	}
+	for _, path := range []namedValue[string]{
+		{"criSocket", c.CRISocket},
+		{"hostPaths.crioConfig", c.HostPaths.CrioConfig},
+		{"hostPaths.crioConfigDropIn", c.HostPaths.CrioConfigDropIn},
+		{"hostPaths.ociHooksDir", c.HostPaths.OCIHooksDir},
+	} {
+		if !filepath.IsAbs(path.value) {
+			errs = append(errs, fmt.Errorf("%v %q should be an absolute host path", path.name, path.value))
+		}
+	}
+	switch c.Policy.MemoryProtection {
+	case "", limited_swap_manager.MemoryProtectionLow, limited_swap_manager.MemoryProtectionMin:
+	default:
+		errs = append(errs, fmt.Errorf("policy.memoryProtection %q should be empty, %q or %q", c.Policy.MemoryProtection,
+			limited_swap_manager.MemoryProtectionLow, limited_swap_manager.MemoryProtectionMin))
+	}
+	for _, factor := range []namedValue[float64]{
+		{"policy.memoryThrottlingFactor", c.Policy.MemoryThrottlingFactor},
+		{"policy.swapHighFactor", c.Policy.SwapHighFactor},
+		{"policy.zswapMaxFactor", c.Policy.ZswapMaxFactor},
+		{"thresholds.swapUtilizationThresholdFactor", c.Thresholds.SwapUtilizationThresholdFactor},
+		{"swap.ramFraction", c.Swap.RAMFraction},
+		{"reclaim.factor", c.Reclaim.Factor},
+	} {
+		if factor.value < 0 || factor.value > 1 {
+			errs = append(errs, fmt.Errorf("%v %v should be between 0 and 1", factor.name, factor.value))
+		}
+	}
+	for _, value := range []namedValue[float64]{
+		{"policy.maxConcurrentMigrations", float64(c.Policy.MaxConcurrentMigrations)},
+		{"policy.pressureTransitionPeriod", float64(c.Policy.PressureTransitionPeriod.Duration)},
+		{"thresholds.maxAverageSwapInPagesPerSecond", c.Thresholds.MaxAverageSwapInPagesPerSecond},
+		{"thresholds.maxAverageSwapOutPagesPerSecond", c.Thresholds.MaxAverageSwapOutPagesPerSecond},
+		{"thresholds.maxMemoryPressureSomeAvg10Percent", c.Thresholds.MaxMemoryPressureSomeAvg10Percent},
+		{"thresholds.maxMemoryPressureFullAvg10Percent", c.Thresholds.MaxMemoryPressureFullAvg10Percent},
+		{"thresholds.averageWindowSize", float64(c.Thresholds.AverageWindowSize.Duration)},
+		{"thresholds.gracePeriod", float64(c.Thresholds.GracePeriod.Duration)},
+		{"swap.size", c.Swap.Size.AsApproximateFloat64()},
+		{"swap.memoryOverCommitPercent", c.Swap.MemoryOverCommitPercent},
+		{"swap.zram.size", c.Swap.Zram.Size.AsApproximateFloat64()},
+		{"reclaim.maxBytesPerInterval", c.Reclaim.MaxBytesPerInterval.AsApproximateFloat64()},
+		{"reclaim.maxIdleCPUMillicores", c.Reclaim.MaxIdleCPUMillicores},
+		{"reclaim.maxIdleMemoryPressureSomeAvg60Percent", c.Reclaim.MaxIdleMemoryPressureSomeAvg60Percent},
+		{"slices.systemSliceIOLatencyTarget", float64(c.Slices.SystemSliceIOLatencyTarget.Duration)},
+		{"slices.kubepodsSliceIOLatencyTarget", float64(c.Slices.KubepodsSliceIOLatencyTarget.Duration)},
+		{"shutdown.timeout", float64(c.Shutdown.Timeout.Duration)},
+	} {
+		if value.value < 0 {
+			errs = append(errs, fmt.Errorf("%v should not be negative", value.name))
+		}
+	}
+	if c.Swap.Path != "" && !filepath.IsAbs(c.Swap.Path) {
+		errs = append(errs, fmt.Errorf("swap.path %q should be an absolute host path", c.Swap.Path))
+	}
+	if c.Swap.Zswap.MaxPoolPercent < 0 || c.Swap.Zswap.MaxPoolPercent > 100 {
+		errs = append(errs, fmt.Errorf("swap.zswap.maxPoolPercent %v should be between 0 and 100", c.Swap.Zswap.MaxPoolPercent))
+	}
+	for _, interval := range []namedValue[metav1.Duration]{
+		{"preflight.interval", c.Preflight.Interval},
+		{"reclaim.interval", c.Reclaim.Interval},
+	} {
+		if interval.value.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("%v %v should be positive", interval.name, interval.value.Duration))
+		}
+	}
+	for _, weight := range []namedValue[uint64]{
+		{"slices.systemSliceIOWeight", c.Slices.SystemSliceIOWeight},
+		{"slices.kubepodsSliceIOWeight", c.Slices.KubepodsSliceIOWeight},
+	} {
+		if weight.value > maxIOWeight {
+			errs = append(errs, fmt.Errorf("%v %v should be at most %v", weight.name, weight.value, maxIOWeight))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RestartRequired returns the fields changed between two configurations that only apply when wasp-agent starts.
+// The throttling factors, the thresholds, the maximal number of concurrent migrations, the settings of the proactive
+// reclaim passes, the slices and the shutdown apply right away.
+func RestartRequired(current, next *Config) []string {
+	var fields []string
+	if current.Threadiness != next.Threadiness {
+		fields = append(fields, "threadiness")
+	}
+	if current.ResyncPeriod != next.ResyncPeriod {
+		fields = append(fields, "resyncPeriod")
+	}
+	if current.CRISocket != next.CRISocket {
+		fields = append(fields, "criSocket")
+	}
+	if current.HostPaths != next.HostPaths {
+		fields = append(fields, "hostPaths")
+	}
+	if current.Policy.MemoryProtection != next.Policy.MemoryProtection {
+		fields = append(fields, "policy.memoryProtection")
+	}
+	if current.Policy.RequireEncryptedSwap != next.Policy.RequireEncryptedSwap {
+		fields = append(fields, "policy.requireEncryptedSwap")
+	}
+	if current.Policy.SwapPressureTaint != next.Policy.SwapPressureTaint {
+		fields = append(fields, "policy.swapPressureTaint")
+	}
+	if current.Policy.PressureTransitionPeriod != next.Policy.PressureTransitionPeriod {
+		fields = append(fields, "policy.pressureTransitionPeriod")
+	}
+	if !reflect.DeepEqual(current.Swap, next.Swap) {
+		fields = append(fields, "swap")
+	}
+	if current.Preflight != next.Preflight {
+		fields = append(fields, "preflight")
+	}
+	if current.Reclaim.Enabled != next.Reclaim.Enabled {
+		fields = append(fields, "reclaim.enabled")
+	}
+	if current.Reclaim.Interval != next.Reclaim.Interval {
+		fields = append(fields, "reclaim.interval")
+	}
+	return fields
+}
@@ -0,0 +1,133 @@
+package agent_config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DebugPath is where the effective configuration is served
+const DebugPath = "/debug/config"
+
+// Watcher polls the configuration file, a ConfigMap mounted as a volume is updated in place by the kubelet.
+// Invalid configurations are logged and ignored, the last valid one stays in effect.
+type Watcher struct {
+	path     string
+	defaults Config
+	interval time.Duration
+	lock     sync.RWMutex
+	// started is the configuration wasp-agent started with, config the last valid one
+	started *Config
+	config  *Config
+	content []byte
+}
+
+type debugConfig struct {
+	Path   string  `json:"path"`
+	Config *Config `json:"config"`
+	// PendingRestart lists the fields changed since wasp-agent started, that only apply once it restarts
+	PendingRestart []string `json:"pendingRestart"`
+}
+
+// NewWatcher loads the configuration file over the defaults, it fails on an invalid configuration
+func NewWatcher(path string, defaults Config, interval time.Duration) (*Watcher, error) {
+	w := &Watcher{
+		path:     path,
+		defaults: defaults,
+		interval: interval,
+	}
+	content, err := w.read()
+	if err != nil {
+		return nil, err
+	}
+	config, err := parse(path, content, defaults)
+	if err != nil {
+		return nil, err
+	}
+	w.started, w.config, w.content = config, config, content
+	logConfig("AgentConfig: effective configuration", config)
+	return w, nil
+}
+
+// Config returns the configuration in effect
+func (w *Watcher) Config() *Config {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.config
+}
+
+// Run polls the configuration file until stop is closed, and calls onChange with every new valid configuration
+func (w *Watcher) Run(onChange func(*Config), stop <-chan struct{}) {
+	log.Log.Infof("Starting AgentConfig watcher of %v", w.path)
+	defer log.Log.Infof("Shutting down AgentConfig watcher")
+	wait.Until(func() {
+		if config := w.reload(); config != nil {
+			onChange(config)
+		}
+	}, w.interval, stop)
+}
+
+// reload returns the configuration when the file changed and is valid
+func (w *Watcher) reload() *Config {
+	content, err := w.read()
+	if err != nil {
+		log.Log.Errorf("AgentConfig: %v", err)
+		return nil
+	}
+	if bytes.Equal(content, w.content) {
+		return nil
+	}
+	w.content = content
+	config, err := parse(w.path, content, w.defaults)
+	if err != nil {
+		log.Log.Errorf("AgentConfig: keeping the current configuration: %v", err)
+		return nil
+	}
+
+	w.lock.Lock()
+	w.config = config
+	w.lock.Unlock()
+	logConfig("AgentConfig: configuration changed", config)
+	if fields := RestartRequired(w.started, config); len(fields) > 0 {
+		log.Log.Warningf("AgentConfig: %v only apply once wasp-agent restarts", fields)
+	}
+	return config
+}
+
+func (w *Watcher) read() ([]byte, error) {
+	content, err := os.ReadFile(w.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// ServeHTTP serves the configuration in effect, along with the changes waiting for a restart
+func (w *Watcher) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	config := w.Config()
+	rw.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(rw).Encode(debugConfig{
+		Path:           w.path,
+		Config:         config,
+		PendingRestart: RestartRequired(w.started, config),
+	})
+	if err != nil {
+		log.Log.Errorf("AgentConfig: %v", err)
+	}
+}
+
+func logConfig(message string, config *Config) {
+	content, err := json.Marshal(config)
+	if err != nil {
+		log.Log.Errorf("AgentConfig: %v", err)
+		return
+	}
+	log.Log.Infof("%v: %s", message, content)
+}
@@ -20,23 +20,66 @@ package wasp
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/openshift-virtualization/wasp-agent/pkg/client"
 	"github.com/openshift-virtualization/wasp-agent/pkg/informers"
 	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/monitoring/metrics"
+	"github.com/openshift-virtualization/wasp-agent/pkg/util"
+	agent_config "github.com/openshift-virtualization/wasp-agent/pkg/wasp/agent-config"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	eviction_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/eviction-manager"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/health"
 	limited_swap_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/limited-swap-manager"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/preflight"
+	reclaim_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/reclaim-manager"
+	slice_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/slice-manager"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shirou/gopsutil/mem"
 	"io"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	v1lister "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// configPollInterval is how often the configuration file is checked for changes
+	configPollInterval = 10 * time.Second
+	// criProbeTimeout is how long the readiness probe waits for CRI-O, below the timeout of the probe
+	criProbeTimeout = 3 * time.Second
 )
 
 type WaspApp struct {
 	limitesSwapManager *limited_swap_manager.LimitedSwapManager
+	evictionManager    *eviction_manager.EvictionManager
+	reclaimManager     *reclaim_manager.ReclaimManager
+	sliceManager       *slice_manager.SliceManager
+	preflightChecker   *preflight.Checker
 	podInformer        cache.SharedIndexInformer
+	nodeInformer       cache.SharedIndexInformer
 	ctx                context.Context
 	cli                client.WaspClient
+	eventBroadcaster   record.EventBroadcaster
+	recorder           record.EventRecorder
+	metricsServer      *http.Server
+	configWatcher      *agent_config.Watcher
+	healthChecker      *health.Checker
+	config             *agent_config.Config
 	waspNs             string
 	nodeName           string
 }
@@ -45,15 +88,22 @@ func Execute() {
 	var err error
 	flag.Parse()
 
-	setCrioSocketSymLink()
-	if err = setOCIHook(); err != nil {
+	var app = WaspApp{}
+	app.configWatcher, err = agent_config.NewWatcher(getConfigPath(), defaultConfig(), configPollInterval)
+	if err != nil {
+		panic(err)
+	}
+	app.config = app.configWatcher.Config()
+
+	setCrioSocketSymLink(app.config.CRISocket)
+	if err = setOCIHook(app.config.HostPaths); err != nil {
 		panic(err)
 	}
 
-	var app = WaspApp{}
 	app.nodeName = os.Getenv("NODE_NAME")
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// SIGTERM stops the informers and the managers, then Run shuts wasp-agent down
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 	app.ctx = ctx
 
@@ -66,7 +116,9 @@ func Execute() {
 	if err != nil {
 		panic(err)
 	}
-	app.podInformer = informers.GetPodInformer(app.cli)
+	app.podInformer = informers.GetPodInformer(app.cli, app.nodeName)
+	app.nodeInformer = informers.GetNodeInformer(app.cli, app.nodeName)
+	app.recorder = app.getEventRecorder()
 
 	log.Log.Infof("nodeName: %v "+
 		"ns: %v "+
@@ -74,42 +126,376 @@ func Execute() {
 		app.waspNs,
 	)
 
+	if err = metrics.SetupMetrics(v1lister.NewPodLister(app.podInformer.GetIndexer()), app.nodeName); err != nil {
+		panic(err)
+	}
+
+	if app.config.Swap.Path != "" {
+		if err = provisionSwap(app.config.Swap); err != nil {
+			log.Log.Errorf("failed to provision swap: %v", err)
+		}
+	}
+	configureCompressedSwap(app.config.Swap)
+
 	stop := ctx.Done()
+	app.initPreflightChecker(stop)
 	app.initLimitedSwapManager(stop)
+	app.initEvictionManager(stop)
+	app.initReclaimManager(stop)
+	app.initSliceManager(stop)
+	app.initHealthChecker()
 	app.Run(stop)
 }
 
+// provisionSwap creates and enables the swap area configured by swap.path, it has to run before the managers
+// read the swap capacity of the node
+func provisionSwap(config agent_config.Swap) error {
+	size := swap.Size{
+		Bytes:                   uint64(config.Size.Value()),
+		RAMFraction:             config.RAMFraction,
+		MemoryOverCommitPercent: config.MemoryOverCommitPercent,
+	}
+
+	virtualMem, err := mem.VirtualMemory()
+	if err != nil {
+		return fmt.Errorf("error fetching virtual memory: %v", err)
+	}
+	return swap.Provision(swap.ProvisionOptions{
+		Path:         config.Path,
+		Size:         size,
+		FormatDevice: config.FormatDevice,
+	}, virtualMem.Total)
+}
+
+// configureCompressedSwap enables zswap and sets up a zram swap device when configured
+func configureCompressedSwap(config agent_config.Swap) {
+	if config.Zswap.Enabled {
+		err := swap.ConfigureZswap(swap.ZswapOptions{
+			Compressor:     config.Zswap.Compressor,
+			Zpool:          config.Zswap.Zpool,
+			MaxPoolPercent: config.Zswap.MaxPoolPercent,
+		})
+		if err != nil {
+			log.Log.Errorf("failed to configure zswap: %v", err)
+		}
+	}
+	if zramSize := config.Zram.Size.Value(); zramSize > 0 {
+		err := swap.SetupZram(swap.ZramOptions{
+			Size:       uint64(zramSize),
+			Compressor: config.Zram.Compressor,
+			Priority:   config.Zram.Priority,
+		})
+		if err != nil {
+			log.Log.Errorf("failed to set up zram: %v", err)
+		}
+	}
+}
+
+// initPreflightChecker runs the preflight checks once the swap is set up, so that a misconfigured node is
+// reported before the managers start
+func (waspapp *WaspApp) initPreflightChecker(stop <-chan struct{}) {
+	waspapp.preflightChecker = preflight.NewChecker(waspapp.cli,
+		waspapp.nodeName,
+		newCrioConfig(waspapp.config.HostPaths),
+		waspapp.config.Preflight.Interval.Duration,
+		waspapp.config.Policy.RequireEncryptedSwap,
+		stop,
+	)
+	if failures := waspapp.preflightChecker.Report(); len(failures) > 0 {
+		log.Log.Errorf("node %v is not ready for swap, see the %v condition of the node", waspapp.nodeName, preflight.NodeSwapReadyCondition)
+	}
+}
+
 func (waspapp *WaspApp) initLimitedSwapManager(stop <-chan struct{}) {
 	waspapp.limitesSwapManager = limited_swap_manager.NewLimitedSwapManager(waspapp.cli,
 		waspapp.podInformer,
 		waspapp.nodeName,
+		throttling(waspapp.config.Policy),
+		waspapp.config.Policy.MemoryProtection,
+		waspapp.config.Policy.RequireEncryptedSwap,
+		stop,
+	)
+}
+
+func (waspapp *WaspApp) getEventRecorder() record.EventRecorder {
+	waspapp.eventBroadcaster = record.NewBroadcaster()
+	waspapp.eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: waspapp.cli.CoreV1().Events(v1.NamespaceAll)})
+	return waspapp.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "wasp-agent", Host: waspapp.nodeName})
+}
+
+func (waspapp *WaspApp) initEvictionManager(stop <-chan struct{}) {
+	var swapProvisioner func() error
+	if waspapp.config.Swap.Path != "" {
+		// the swap is provisioned again with the size in effect, the path stays the one wasp-agent started with
+		swapProvisioner = func() error {
+			config := waspapp.configWatcher.Config().Swap
+			config.Path = waspapp.config.Swap.Path
+			return provisionSwap(config)
+		}
+	}
+	waspapp.evictionManager = eviction_manager.NewEvictionManager(waspapp.cli,
+		waspapp.podInformer,
+		waspapp.nodeInformer,
+		waspapp.recorder,
+		waspapp.nodeName,
+		evictionThresholds(waspapp.config.Thresholds),
+		waspapp.config.Policy.MaxConcurrentMigrations,
+		eviction_manager.NodePressureOptions{
+			Taint:            waspapp.config.Policy.SwapPressureTaint,
+			TransitionPeriod: waspapp.config.Policy.PressureTransitionPeriod.Duration,
+		},
+		swapProvisioner,
+		stop,
+	)
+}
+
+func (waspapp *WaspApp) initReclaimManager(stop <-chan struct{}) {
+	if !waspapp.config.Reclaim.Enabled {
+		return
+	}
+	waspapp.reclaimManager = reclaim_manager.NewReclaimManager(waspapp.podInformer,
+		waspapp.nodeName,
+		reclaimOptions(waspapp.config.Reclaim),
+		stop,
+	)
+}
+
+func (waspapp *WaspApp) initSliceManager(stop <-chan struct{}) {
+	waspapp.sliceManager = slice_manager.NewSliceManager(waspapp.cli,
+		waspapp.nodeName,
+		sliceOptions(waspapp.config.Slices),
 		stop,
 	)
 }
 
+// initHealthChecker sets up the probes of the DaemonSet. wasp-agent is restarted when its OCI hook was removed from
+// the host or its workers stopped processing pods. It is ready once the informers synced, CRI-O answers, and the
+// limits of a pod were set recently.
+func (waspapp *WaspApp) initHealthChecker() {
+	started := time.Now()
+	resyncPeriod := waspapp.config.ResyncPeriod.Duration
+	hookPath := filepath.Join(hostRoot, waspapp.config.HostPaths.OCIHooksDir, hookFile)
+
+	waspapp.healthChecker = health.NewChecker()
+	waspapp.healthChecker.AddLivenessCheck("oci-hook", health.FilesExist(hookScriptPath, hookPath))
+	waspapp.healthChecker.AddLivenessCheck("workers", health.Recent("processed pod",
+		waspapp.limitesSwapManager.LastProcessed, started, max(10*resyncPeriod, 5*time.Minute)))
+	waspapp.healthChecker.AddReadinessCheck("informers", health.InformersSynced(waspapp.podInformer, waspapp.nodeInformer))
+	waspapp.healthChecker.AddReadinessCheck("cri", func() error {
+		_, err := cgroup.GetRuntimeVersion(criProbeTimeout)
+		return err
+	})
+	waspapp.healthChecker.AddReadinessCheck("reconcile", health.Recent("reconcile",
+		waspapp.limitesSwapManager.LastReconciled, time.Time{}, max(3*resyncPeriod, time.Minute)))
+}
+
+func getConfigPath() string {
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		return path
+	}
+	return agent_config.DefaultPath
+}
+
+// defaultConfig is the configuration the configuration file overrides
+func defaultConfig() agent_config.Config {
+	return agent_config.Config{
+		Threadiness:  1,
+		ResyncPeriod: metav1.Duration{Duration: 20 * time.Second},
+		CRISocket:    CRISocketPath,
+		HostPaths: agent_config.HostPaths{
+			CrioConfig:       CrioConfigPath,
+			CrioConfigDropIn: CrioConfigDropInPath,
+			OCIHooksDir:      OCIHooksDir,
+		},
+		Policy: agent_config.Policy{
+			PressureTransitionPeriod: metav1.Duration{Duration: 300 * time.Second},
+			MaxConcurrentMigrations:  2,
+		},
+		Thresholds: agent_config.Thresholds{
+			SwapUtilizationThresholdFactor:  0.8,
+			MaxAverageSwapInPagesPerSecond:  1000,
+			MaxAverageSwapOutPagesPerSecond: 1000,
+			AverageWindowSize:               metav1.Duration{Duration: 30 * time.Second},
+			GracePeriod:                     metav1.Duration{Duration: 30 * time.Second},
+		},
+		Swap: agent_config.Swap{
+			Zram: agent_config.Zram{
+				Priority: 100,
+			},
+		},
+		Preflight: agent_config.Preflight{
+			Interval: metav1.Duration{Duration: 300 * time.Second},
+		},
+		Reclaim: agent_config.Reclaim{
+			Interval:             metav1.Duration{Duration: 60 * time.Second},
+			Factor:               0.05,
+			MaxBytesPerInterval:  resource.MustParse("256Mi"),
+			MaxIdleCPUMillicores: 10,
+		},
+		Shutdown: agent_config.Shutdown{
+			Timeout: metav1.Duration{Duration: 20 * time.Second},
+		},
+	}
+}
+
+func throttling(policy agent_config.Policy) limited_swap_manager.Throttling {
+	return limited_swap_manager.Throttling{
+		MemoryThrottlingFactor: policy.MemoryThrottlingFactor,
+		SwapHighFactor:         policy.SwapHighFactor,
+		ZswapMaxFactor:         policy.ZswapMaxFactor,
+	}
+}
+
+func evictionThresholds(thresholds agent_config.Thresholds) eviction_manager.Thresholds {
+	return eviction_manager.Thresholds{
+		SwapUtilizationThresholdFactor:  thresholds.SwapUtilizationThresholdFactor,
+		MaxAverageSwapInPagesPerSecond:  thresholds.MaxAverageSwapInPagesPerSecond,
+		MaxAverageSwapOutPagesPerSecond: thresholds.MaxAverageSwapOutPagesPerSecond,
+		MaxMemoryPressureSomeAvg10:      thresholds.MaxMemoryPressureSomeAvg10Percent,
+		MaxMemoryPressureFullAvg10:      thresholds.MaxMemoryPressureFullAvg10Percent,
+		AverageWindowSize:               thresholds.AverageWindowSize.Duration,
+		GracePeriod:                     thresholds.GracePeriod.Duration,
+	}
+}
+
+func reclaimOptions(reclaim agent_config.Reclaim) reclaim_manager.Options {
+	return reclaim_manager.Options{
+		Interval:                       reclaim.Interval.Duration,
+		ReclaimFactor:                  reclaim.Factor,
+		MaxBytesPerInterval:            uint64(reclaim.MaxBytesPerInterval.Value()),
+		MaxIdleCPUMillicores:           reclaim.MaxIdleCPUMillicores,
+		MaxIdleMemoryPressureSomeAvg60: reclaim.MaxIdleMemoryPressureSomeAvg60Percent,
+	}
+}
+
+func sliceOptions(slices agent_config.Slices) slice_manager.Options {
+	return slice_manager.Options{
+		DisableSystemSliceSwap:       slices.DisableSystemSliceSwap,
+		SystemSliceIOLatencyTarget:   slices.SystemSliceIOLatencyTarget.Duration,
+		KubepodsSliceIOLatencyTarget: slices.KubepodsSliceIOLatencyTarget.Duration,
+		SystemSliceIOWeight:          slices.SystemSliceIOWeight,
+		KubepodsSliceIOWeight:        slices.KubepodsSliceIOWeight,
+	}
+}
+
+// applyConfig applies the settings of a changed configuration that don't require a restart
+func (waspapp *WaspApp) applyConfig(config *agent_config.Config) {
+	waspapp.limitesSwapManager.SetThrottling(throttling(config.Policy))
+	waspapp.evictionManager.SetSettings(eviction_manager.Settings{
+		Thresholds:              evictionThresholds(config.Thresholds),
+		MaxConcurrentMigrations: config.Policy.MaxConcurrentMigrations,
+	})
+	waspapp.sliceManager.SetOptions(sliceOptions(config.Slices))
+	// the proactive reclaim is only enabled or disabled on restart
+	if waspapp.reclaimManager != nil {
+		waspapp.reclaimManager.SetOptions(reclaimOptions(config.Reclaim))
+	}
+}
+
 func (waspapp *WaspApp) Run(stop <-chan struct{}) {
 	go waspapp.podInformer.Run(stop)
+	go waspapp.nodeInformer.Run(stop)
+	waspapp.metricsServer = waspapp.newMetricsServer()
+	go waspapp.serveMetrics()
 
 	if !cache.WaitForCacheSync(stop,
 		waspapp.podInformer.HasSynced,
+		waspapp.nodeInformer.HasSynced,
 	) {
 		klog.Warningf("failed to wait for caches to sync")
 	}
+	managers := []managerDone{
+		runManager("LimitedSwapManager", func() {
+			waspapp.limitesSwapManager.Run(waspapp.config.Threadiness, waspapp.config.ResyncPeriod.Duration)
+		}),
+		runManager("EvictionManager", waspapp.evictionManager.Run),
+		runManager("SliceManager", waspapp.sliceManager.Run),
+		runManager("preflight Checker", waspapp.preflightChecker.Run),
+	}
+	if waspapp.reclaimManager != nil {
+		managers = append(managers, runManager("ReclaimManager", waspapp.reclaimManager.Run))
+	}
+	go waspapp.configWatcher.Run(waspapp.applyConfig, stop)
+
+	<-waspapp.ctx.Done()
+	waspapp.shutdown(managers)
+}
+
+// managerDone is closed once the manager stopped
+type managerDone struct {
+	name string
+	done <-chan struct{}
+}
+
+func runManager(name string, run func()) managerDone {
+	done := make(chan struct{})
 	go func() {
-		waspapp.limitesSwapManager.Run(1)
+		defer close(done)
+		run()
 	}()
+	return managerDone{name: name, done: done}
+}
 
-	<-waspapp.ctx.Done()
+// shutdown runs once a signal stopped the informers and the managers. Within the shutdown timeout, it waits for
+// the managers to be done with the pods being processed, the evictions and the updates of the node, optionally
+// removes the OCI hook from the host, flushes the events and stops serving the metrics, so that a rolling update
+// of the DaemonSet doesn't interrupt wasp-agent mid-write.
+func (waspapp *WaspApp) shutdown(managers []managerDone) {
+	config := waspapp.configWatcher.Config()
+	log.Log.Infof("Shutting down wasp-agent within %v", config.Shutdown.Timeout.Duration)
+	ctx, cancel := context.WithTimeout(context.Background(), config.Shutdown.Timeout.Duration)
+	defer cancel()
+
+	for _, manager := range managers {
+		select {
+		case <-manager.done:
+		case <-ctx.Done():
+			log.Log.Warningf("timed out waiting for %v to stop", manager.name)
+		}
+	}
+
+	if config.Shutdown.CleanupHostArtifacts {
+		// the hook was installed with the host paths wasp-agent started with
+		if err := removeOCIHook(waspapp.config.HostPaths); err != nil {
+			log.Log.Errorf("failed to remove the OCI hook: %v", err)
+		} else {
+			log.Log.Infof("removed the OCI hook from the host")
+		}
+	}
+
+	waspapp.eventBroadcaster.Shutdown()
+	if err := waspapp.metricsServer.Shutdown(ctx); err != nil {
+		log.Log.Errorf("failed to shut the metrics server down: %v", err)
+	}
+	log.Log.Infof("wasp-agent stopped")
+}
+
+func (waspapp *WaspApp) newMetricsServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(util.MetricsPath, promhttp.Handler())
+	mux.Handle(agent_config.DebugPath, waspapp.configWatcher)
+	waspapp.healthChecker.Install(mux)
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", util.MetricsPort),
+		Handler: mux,
+	}
+}
 
+func (waspapp *WaspApp) serveMetrics() {
+	err := waspapp.metricsServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Log.Errorf("metrics server failed: %v", err)
+	}
 }
 
-func setCrioSocketSymLink() {
+// setCrioSocketSymLink links the CRI-O socket of the host at its default location, where the agent dials it
+func setCrioSocketSymLink(criSocket string) {
 	err := os.MkdirAll("/var/run/crio", 0755)
 	if err != nil {
 		klog.Warningf(err.Error())
 		return
 	}
-	os.Symlink("/host/var/run/crio/crio.sock", "/var/run/crio/crio.sock")
+	os.Symlink(filepath.Join(hostRoot, criSocket), CRISocketPath)
 	if err != nil {
 		klog.Warningf(err.Error())
 		return
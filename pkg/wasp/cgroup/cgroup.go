@@ -0,0 +1,201 @@
+package cgroup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	v1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CgroupPathBase = "/host/sys/fs/cgroup"
+	crioSocket     = "unix:///var/run/crio/crio.sock"
+)
+
+func getContainerStatusResponse(containerUID string) (*runtimeapi.ContainerStatusResponse, error) {
+	// Set up the gRPC connection to the CRI runtime
+	conn, err := grpc.Dial(crioSocket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Create a RuntimeServiceClient
+	client := runtimeapi.NewRuntimeServiceClient(conn)
+
+	// Call the ContainerStatus API to get container information
+	request := &runtimeapi.ContainerStatusRequest{ContainerId: containerUID, Verbose: true}
+	response, err := client.ContainerStatus(context.Background(), request)
+
+	return response, err
+}
+
+// GetRuntimeVersion asks the CRI runtime for its name and version, it tells whether the runtime is reachable
+// within the timeout
+func GetRuntimeVersion(timeout time.Duration) (*runtimeapi.VersionResponse, error) {
+	conn, err := grpc.Dial(crioSocket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	client := runtimeapi.NewRuntimeServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return client.Version(ctx, &runtimeapi.VersionRequest{})
+}
+
+type Data struct {
+	Pid int `json:"pid"`
+}
+
+// GetContainerCgroupPath returns the host cgroup v2 directory of the container with the given CRI id.
+func GetContainerCgroupPath(containerUID string) (string, error) {
+	containerStatusResponse, err := getContainerStatusResponse(containerUID)
+	if err != nil {
+		return "", err
+	}
+	if containerStatusResponse.Info == nil {
+		return "", fmt.Errorf("Failed to get container status info")
+	}
+
+	var data Data
+	err = json.Unmarshal([]byte(containerStatusResponse.Info["info"]), &data)
+	if err != nil {
+		return "", err
+	}
+	if data.Pid == 0 {
+		return "", fmt.Errorf("PID not found in container info")
+	}
+
+	return getCgroupPath(strconv.Itoa(data.Pid))
+}
+
+// getCgroupPath returns the unified cgroup path of the given pid.
+func getCgroupPath(pid string) (string, error) {
+	procCgroupBasePath := filepath.Join("/host/proc", pid, "cgroup")
+	controllerPaths, err := cgroups.ParseCgroupFile(procCgroupBasePath)
+	path, ok := controllerPaths[""]
+	if err != nil {
+		return "", err
+	} else if !ok {
+		return "", fmt.Errorf("could not get cgroup path")
+	}
+	return filepath.Join(CgroupPathBase, path), nil
+}
+
+func GetContainerUID(pod *v1.Pod, container v1.Container) (string, error) {
+	prefix := "cri-o://"
+	for _, conatinerStatus := range pod.Status.ContainerStatuses {
+		if conatinerStatus.Name == container.Name {
+			return strings.TrimPrefix(conatinerStatus.ContainerID, prefix), nil
+		}
+	}
+	for _, conatinerStatus := range pod.Status.InitContainerStatuses {
+		if conatinerStatus.Name == container.Name {
+			return strings.TrimPrefix(conatinerStatus.ContainerID, prefix), nil
+		}
+	}
+	return "", fmt.Errorf("cannot find ContainerUID PodName: %v containerName: %v", pod.Name, container.Name)
+}
+
+func GetContainerState(pod *v1.Pod, container v1.Container) (v1.ContainerState, bool) {
+	for _, conatinerStatus := range pod.Status.ContainerStatuses {
+		if conatinerStatus.Name == container.Name {
+			return conatinerStatus.State, true
+		}
+	}
+	for _, conatinerStatus := range pod.Status.InitContainerStatuses {
+		if conatinerStatus.Name == container.Name {
+			return conatinerStatus.State, true
+		}
+	}
+
+	return v1.ContainerState{}, false
+}
+
+// ReadUint64 reads a single unsigned value, such as memory.current, from a cgroup file.
+// The special value "max" is reported as zero.
+func ReadUint64(dirPath, file string) (uint64, error) {
+	content, err := cgroups.ReadFile(dirPath, file)
+	if err != nil {
+		return 0, err
+	}
+	content = strings.TrimSpace(content)
+	if content == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(content, 10, 64)
+}
+
+// GetRunningContainersCgroupPaths returns the cgroup directories of all running containers of the pod.
+func GetRunningContainersCgroupPaths(pod *v1.Pod) ([]string, error) {
+	var paths []string
+	for _, container := range append(pod.Spec.Containers, pod.Spec.InitContainers...) {
+		containerState, exist := GetContainerState(pod, container)
+		if !exist || containerState.Running == nil {
+			continue
+		}
+		containerUID, err := GetContainerUID(pod, container)
+		if err != nil {
+			return nil, err
+		}
+		dirPath, err := GetContainerCgroupPath(containerUID)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, dirPath)
+	}
+	return paths, nil
+}
+
+// GetPodMemoryAndSwapUsage sums memory.current and memory.swap.current over the running containers of the pod.
+func GetPodMemoryAndSwapUsage(pod *v1.Pod) (uint64, error) {
+	paths, err := GetRunningContainersCgroupPaths(pod)
+	if err != nil {
+		return 0, err
+	}
+	var usage uint64
+	for _, dirPath := range paths {
+		memoryCurrent, err := ReadUint64(dirPath, "memory.current")
+		if err != nil {
+			return 0, err
+		}
+		swapCurrent, err := ReadUint64(dirPath, "memory.swap.current")
+		if err != nil {
+			return 0, err
+		}
+		usage += memoryCurrent + swapCurrent
+	}
+	return usage, nil
+}
+
+// GetPodCgroupPath returns the cgroup directory of the pod, found by walking up from the cgroup of one of its running containers.
+// Both the systemd ("kubepods-burstable-pod<uid>.slice") and the cgroupfs ("pod<uid>") naming are supported.
+func GetPodCgroupPath(pod *v1.Pod) (string, error) {
+	paths, err := GetRunningContainersCgroupPaths(pod)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("pod %v/%v has no running containers", pod.Namespace, pod.Name)
+	}
+
+	uid := string(pod.UID)
+	systemdUID := strings.ReplaceAll(uid, "-", "_")
+	for dirPath := paths[0]; dirPath != CgroupPathBase && dirPath != "/" && dirPath != "."; dirPath = filepath.Dir(dirPath) {
+		base := filepath.Base(dirPath)
+		if strings.Contains(base, "pod"+uid) || strings.Contains(base, "pod"+systemdUID) {
+			return dirPath, nil
+		}
+	}
+	return "", fmt.Errorf("could not find the cgroup of pod %v/%v", pod.Namespace, pod.Name)
+}
@@ -0,0 +1,303 @@
+package eviction_manager
+
+import (
+	"context"
+	"fmt"
+	"github.com/openshift-virtualization/wasp-agent/pkg/client"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	kubelettypes "k8s.io/kubernetes/pkg/kubelet/types"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	monitoringInterval = 1 * time.Second
+	// podCleanupTimeout bounds how long the manager waits for an evicted pod to go away before evicting another one
+	podCleanupTimeout = 30 * time.Second
+	// initial and maximal delay before retrying the eviction of a pod protected by a PodDisruptionBudget
+	evictionInitialBackoff = 5 * time.Second
+	evictionMaxBackoff     = 5 * time.Minute
+
+	EvictedReason           = "Evicted"
+	EvictionBlockedReason   = "EvictionBlocked"
+	evictionMessageTemplate = "The node is under swap pressure, signals: %v"
+)
+
+type EvictionManager struct {
+	podLister  v1lister.PodLister
+	nodeLister v1lister.NodeLister
+	waspCli    client.WaspClient
+	recorder   record.EventRecorder
+	nodeName   string
+	thresholds Thresholds
+	// maxConcurrentMigrations limits the live migrations away from the node, zero evicts VMIs instead
+	maxConcurrentMigrations int
+	statsCollector          *statsCollector
+	nodePressureReporter    *nodePressureReporter
+	signalsObservedAt       map[Signal]time.Time
+	lastEvictedPod          *v1.Pod
+	lastEvictionTime        time.Time
+	evictionBackoff         *flowcontrol.Backoff
+	// provisionSwap provisions the swap again once drained, it is nil when swap provisioning isn't configured
+	provisionSwap func() error
+	// settings replace the thresholds and the maximal number of concurrent migrations on the next synchronization
+	settings atomic.Pointer[Settings]
+	stop     <-chan struct{}
+}
+
+// Settings are the settings of the EvictionManager that may change while the agent runs
+type Settings struct {
+	Thresholds              Thresholds
+	MaxConcurrentMigrations int
+}
+
+func NewEvictionManager(waspCli client.WaspClient,
+	podInformer cache.SharedIndexInformer,
+	nodeInformer cache.SharedIndexInformer,
+	recorder record.EventRecorder,
+	nodeName string,
+	thresholds Thresholds,
+	maxConcurrentMigrations int,
+	nodePressureOptions NodePressureOptions,
+	provisionSwap func() error,
+	stop <-chan struct{},
+) *EvictionManager {
+	return &EvictionManager{
+		podLister:               v1lister.NewPodLister(podInformer.GetIndexer()),
+		nodeLister:              v1lister.NewNodeLister(nodeInformer.GetIndexer()),
+		waspCli:                 waspCli,
+		recorder:                recorder,
+		nodeName:                nodeName,
+		thresholds:              thresholds,
+		maxConcurrentMigrations: maxConcurrentMigrations,
+		statsCollector:          newStatsCollector(thresholds),
+		nodePressureReporter:    newNodePressureReporter(waspCli, nodeName, nodePressureOptions),
+		signalsObservedAt:       make(map[Signal]time.Time),
+		evictionBackoff:         flowcontrol.NewBackOff(evictionInitialBackoff, evictionMaxBackoff),
+		provisionSwap:           provisionSwap,
+		stop:                    stop,
+	}
+}
+
+// SetSettings replaces the thresholds and the maximal number of concurrent migrations
+func (em *EvictionManager) SetSettings(settings Settings) {
+	em.settings.Store(&settings)
+}
+
+// applySettings applies the settings set since the last synchronization, the swap traffic samples are kept
+func (em *EvictionManager) applySettings() {
+	settings := em.settings.Swap(nil)
+	if settings == nil {
+		return
+	}
+	log.Log.Infof("EvictionManager: thresholds changed to %+v, max concurrent migrations to %v", settings.Thresholds, settings.MaxConcurrentMigrations)
+	em.thresholds = settings.Thresholds
+	em.maxConcurrentMigrations = settings.MaxConcurrentMigrations
+	collector := newStatsCollector(settings.Thresholds)
+	collector.samples = em.statsCollector.samples
+	em.statsCollector = collector
+}
+
+func (em *EvictionManager) Run() {
+	defer utilruntime.HandleCrash()
+	log.Log.Infof("Starting EvictionManager")
+	defer log.Log.Infof("Shutting down EvictionManager")
+
+	// returns once stopped and done with the current iteration
+	wait.Until(em.synchronize, monitoringInterval, em.stop)
+}
+
+func (em *EvictionManager) synchronize() {
+	em.applySettings()
+	now := time.Now()
+	em.evictionBackoff.GC()
+	if em.drainSwap(now) {
+		return
+	}
+	observation, err := em.statsCollector.collect(now)
+	if err != nil {
+		log.Log.Errorf("EvictionManager: %v", err)
+		return
+	}
+
+	signalsMet := thresholdsMet(em.thresholds, observation)
+	em.nodePressureReporter.report(signalsMet, now)
+
+	signals := em.signalsMetForGracePeriod(signalsMet, now)
+	if len(signals) == 0 {
+		return
+	}
+	if em.waitingForPodCleanup(now) {
+		return
+	}
+	if em.waitingForMigrations() {
+		return
+	}
+
+	log.Log.Infof("EvictionManager: node is under swap pressure, signals: %v swap used: %v swap total: %v swap in: %.2f pages/s swap out: %.2f pages/s",
+		signals, observation.SwapUsed, observation.SwapTotal, observation.SwapInPagesPerSecond, observation.SwapOutPagesPerSecond)
+
+	candidates, err := em.getEvictionCandidates()
+	if err != nil {
+		log.Log.Errorf("EvictionManager: %v", err)
+		return
+	}
+	if len(candidates) == 0 {
+		log.Log.Infof("EvictionManager: no pods to evict")
+		return
+	}
+
+	rankForEviction(candidates, em.getPodsUsage(candidates))
+	em.evictOne(candidates, fmt.Sprintf(evictionMessageTemplate, signals), now)
+}
+
+// evictOne evicts, or live migrates, the first of the ranked candidates that can be evicted
+func (em *EvictionManager) evictOne(candidates []*v1.Pod, message string, now time.Time) bool {
+	for _, pod := range candidates {
+		if em.evictionBackoff.IsInBackOffSinceUpdate(string(pod.UID), now) {
+			continue
+		}
+		if vmiName, isVMI := getVMIName(pod); isVMI && em.maxConcurrentMigrations > 0 {
+			switch em.migrateVMI(pod, vmiName, message) {
+			case migrationStarted:
+				// waitingForMigrations holds further evictions until the migration finishes
+				return true
+			case migrationInProgress:
+				return false
+			case migrationFailed:
+				continue
+			}
+		}
+		if em.evictPod(pod, message, now) {
+			em.lastEvictedPod = pod
+			em.lastEvictionTime = now
+			return true
+		}
+	}
+	return false
+}
+
+// signalsMetForGracePeriod returns the signals that have been continuously met for at least the grace period
+func (em *EvictionManager) signalsMetForGracePeriod(signals []Signal, now time.Time) []Signal {
+	met := make(map[Signal]bool)
+	for _, signal := range signals {
+		met[signal] = true
+		if _, ok := em.signalsObservedAt[signal]; !ok {
+			em.signalsObservedAt[signal] = now
+		}
+	}
+
+	var result []Signal
+	for signal, observedAt := range em.signalsObservedAt {
+		if !met[signal] {
+			delete(em.signalsObservedAt, signal)
+			continue
+		}
+		if now.Sub(observedAt) >= em.thresholds.GracePeriod {
+			result = append(result, signal)
+		}
+	}
+	return result
+}
+
+// waitingForPodCleanup reports whether the last evicted pod is still around, giving the node
+// a chance to reclaim its memory before another pod is evicted
+func (em *EvictionManager) waitingForPodCleanup(now time.Time) bool {
+	if em.lastEvictedPod == nil {
+		return false
+	}
+	if now.Sub(em.lastEvictionTime) > podCleanupTimeout {
+		em.lastEvictedPod = nil
+		return false
+	}
+	pod, err := em.podLister.Pods(em.lastEvictedPod.Namespace).Get(em.lastEvictedPod.Name)
+	if kapierrors.IsNotFound(err) || (err == nil && pod.UID != em.lastEvictedPod.UID) {
+		em.lastEvictedPod = nil
+		return false
+	}
+	return true
+}
+
+// getEvictionCandidates lists the pods of the node that may be evicted.
+// Static pods, mirror pods and critical pods are never evicted.
+func (em *EvictionManager) getEvictionCandidates() ([]*v1.Pod, error) {
+	pods, err := em.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*v1.Pod
+	for _, pod := range pods {
+		if pod.Spec.NodeName != em.nodeName ||
+			pod.DeletionTimestamp != nil ||
+			pod.Status.Phase == v1.PodSucceeded ||
+			pod.Status.Phase == v1.PodFailed ||
+			kubelettypes.IsCriticalPod(pod) {
+			continue
+		}
+		candidates = append(candidates, pod)
+	}
+	return candidates, nil
+}
+
+// getPodsUsage reads the memory and swap usage of the pods, pods whose usage can't be read are left out
+func (em *EvictionManager) getPodsUsage(pods []*v1.Pod) podUsage {
+	usage := make(podUsage)
+	for _, pod := range pods {
+		podUsage, err := cgroup.GetPodMemoryAndSwapUsage(pod)
+		if err != nil {
+			log.Log.Infof("EvictionManager: couldn't get usage of pod %v/%v: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		usage[pod.UID] = podUsage
+	}
+	return usage
+}
+
+// evictPod evicts the pod through the Eviction API so that PodDisruptionBudgets are respected.
+// Pods whose eviction is blocked by a PodDisruptionBudget are retried with an exponential backoff.
+func (em *EvictionManager) evictPod(pod *v1.Pod, message string, now time.Time) bool {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			Preconditions: metav1.NewUIDPreconditions(string(pod.UID)),
+		},
+	}
+
+	err := em.waspCli.PolicyV1().Evictions(pod.Namespace).Evict(context.Background(), eviction)
+	switch {
+	case err == nil:
+		em.evictionBackoff.DeleteEntry(string(pod.UID))
+		em.recorder.Event(pod, v1.EventTypeWarning, EvictedReason, message)
+		log.Log.Infof("EvictionManager: evicted pod %v/%v: %v", pod.Namespace, pod.Name, message)
+		return true
+	case kapierrors.IsTooManyRequests(err):
+		em.evictionBackoff.Next(string(pod.UID), now)
+		em.recorder.Eventf(pod, v1.EventTypeWarning, EvictionBlockedReason, "%v, eviction is blocked by a PodDisruptionBudget, retrying in %v",
+			message, em.evictionBackoff.Get(string(pod.UID)))
+		log.Log.Infof("EvictionManager: eviction of pod %v/%v is blocked by a PodDisruptionBudget: %v", pod.Namespace, pod.Name, err)
+		return false
+	case kapierrors.IsNotFound(err) || kapierrors.IsConflict(err):
+		// the pod is already gone or was replaced by a pod with the same name
+		return false
+	default:
+		em.evictionBackoff.Next(string(pod.UID), now)
+		log.Log.Errorf("EvictionManager: failed to evict pod %v/%v: %v", pod.Namespace, pod.Name, err)
+		return false
+	}
+}
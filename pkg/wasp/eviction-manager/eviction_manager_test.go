@@ -0,0 +1,238 @@
+/*
+Copyright 2023 The Wasp Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package eviction_manager
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/psi"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+)
+
+const gi = 1024 * 1024 * 1024
+
+func newPod(name string, priority int32, request, limit string) *v1.Pod {
+	resources := v1.ResourceRequirements{
+		Requests: v1.ResourceList{},
+		Limits:   v1.ResourceList{},
+	}
+	if request != "" {
+		resources.Requests[v1.ResourceMemory] = resource.MustParse(request)
+	}
+	if limit != "" {
+		resources.Limits[v1.ResourceMemory] = resource.MustParse(limit)
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			UID:  types.UID(name),
+		},
+		Spec: v1.PodSpec{
+			Priority: &priority,
+			Containers: []v1.Container{
+				{
+					Name:      "container",
+					Resources: resources,
+				},
+			},
+		},
+	}
+}
+
+func names(pods []*v1.Pod) []string {
+	var result []string
+	for _, pod := range pods {
+		result = append(result, pod.Name)
+	}
+	return result
+}
+
+var _ = Describe("Eviction manager", func() {
+	Context("rankForEviction", func() {
+		It("should place pods exceeding their limits before pods exceeding their requests", func() {
+			exceedsRequests := newPod("exceeds-requests", 0, "100Mi", "")
+			exceedsLimits := newPod("exceeds-limits", 100, "100Mi", "200Mi")
+			pods := []*v1.Pod{exceedsRequests, exceedsLimits}
+			usage := podUsage{
+				exceedsRequests.UID: 1024 * 1024 * 1024,
+				exceedsLimits.UID:   300 * 1024 * 1024,
+			}
+
+			rankForEviction(pods, usage)
+			Expect(names(pods)).To(Equal([]string{"exceeds-limits", "exceeds-requests"}))
+		})
+
+		It("should place pods exceeding their requests before lower priority pods", func() {
+			withinRequests := newPod("within-requests", 0, "1Gi", "")
+			exceedsRequests := newPod("exceeds-requests", 100, "100Mi", "")
+			pods := []*v1.Pod{withinRequests, exceedsRequests}
+			usage := podUsage{
+				withinRequests.UID:  100 * 1024 * 1024,
+				exceedsRequests.UID: 200 * 1024 * 1024,
+			}
+
+			rankForEviction(pods, usage)
+			Expect(names(pods)).To(Equal([]string{"exceeds-requests", "within-requests"}))
+		})
+
+		It("should order by priority and then by usage above requests", func() {
+			highPriority := newPod("high-priority", 1000, "100Mi", "")
+			lowPrioritySmall := newPod("low-priority-small", 0, "100Mi", "")
+			lowPriorityLarge := newPod("low-priority-large", 0, "100Mi", "")
+			pods := []*v1.Pod{highPriority, lowPrioritySmall, lowPriorityLarge}
+			usage := podUsage{
+				highPriority.UID:     500 * 1024 * 1024,
+				lowPrioritySmall.UID: 150 * 1024 * 1024,
+				lowPriorityLarge.UID: 400 * 1024 * 1024,
+			}
+
+			rankForEviction(pods, usage)
+			Expect(names(pods)).To(Equal([]string{"low-priority-large", "low-priority-small", "high-priority"}))
+		})
+
+		It("should place pods without stats first", func() {
+			withStats := newPod("with-stats", 0, "100Mi", "200Mi")
+			withoutStats := newPod("without-stats", 0, "100Mi", "")
+			pods := []*v1.Pod{withStats, withoutStats}
+			usage := podUsage{
+				withStats.UID: 300 * 1024 * 1024,
+			}
+
+			rankForEviction(pods, usage)
+			Expect(names(pods)).To(Equal([]string{"without-stats", "with-stats"}))
+		})
+	})
+
+	Context("thresholdsMet", func() {
+		thresholds := Thresholds{
+			SwapUtilizationThresholdFactor:  0.8,
+			MaxAverageSwapInPagesPerSecond:  1000,
+			MaxAverageSwapOutPagesPerSecond: 1000,
+			MaxMemoryPressureFullAvg10:      20,
+		}
+
+		DescribeTable("should detect the crossed signals", func(observation Observation, expected []Signal) {
+			Expect(thresholdsMet(thresholds, observation)).To(Equal(expected))
+		},
+			Entry("no pressure", Observation{SwapTotal: 100, SwapUsed: 10}, nil),
+			Entry("swap utilization", Observation{SwapTotal: 100, SwapUsed: 90}, []Signal{SwapUtilizationSignal}),
+			Entry("swap in only", Observation{SwapTotal: 100, SwapInPagesPerSecond: 2000}, nil),
+			Entry("swap traffic", Observation{SwapTotal: 100, SwapInPagesPerSecond: 2000, SwapOutPagesPerSecond: 2000}, []Signal{SwapTrafficSignal}),
+			Entry("no swap", Observation{}, nil),
+			Entry("memory pressure", Observation{MemoryPressure: psi.Stats{Full: psi.Line{Avg10: 30}}}, []Signal{MemoryPressureSignal}),
+		)
+	})
+
+	Context("signalsMetForGracePeriod", func() {
+		It("should only report signals that are met for the whole grace period", func() {
+			em := &EvictionManager{
+				thresholds:        Thresholds{GracePeriod: 10 * time.Second},
+				signalsObservedAt: make(map[Signal]time.Time),
+			}
+			start := time.Now()
+
+			Expect(em.signalsMetForGracePeriod([]Signal{SwapUtilizationSignal}, start)).To(BeEmpty())
+			Expect(em.signalsMetForGracePeriod([]Signal{SwapUtilizationSignal}, start.Add(10*time.Second))).To(Equal([]Signal{SwapUtilizationSignal}))
+			Expect(em.signalsMetForGracePeriod(nil, start.Add(11*time.Second))).To(BeEmpty())
+			Expect(em.signalsMetForGracePeriod([]Signal{SwapUtilizationSignal}, start.Add(12*time.Second))).To(BeEmpty())
+		})
+	})
+
+	Context("getVMIName", func() {
+		It("should return the owning VirtualMachineInstance of a virt-launcher pod", func() {
+			pod := newPod("virt-launcher-vmi-abcde", 0, "100Mi", "")
+			pod.OwnerReferences = []metav1.OwnerReference{
+				{APIVersion: "kubevirt.io/v1", Kind: "VirtualMachineInstance", Name: "vmi"},
+			}
+			name, isVMI := getVMIName(pod)
+			Expect(isVMI).To(BeTrue())
+			Expect(name).To(Equal("vmi"))
+		})
+
+		It("should ignore pods that aren't owned by a VirtualMachineInstance", func() {
+			pod := newPod("pod", 0, "100Mi", "")
+			pod.OwnerReferences = []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "rs"},
+			}
+			_, isVMI := getVMIName(pod)
+			Expect(isVMI).To(BeFalse())
+		})
+	})
+
+	Context("statsCollector", func() {
+		It("should average the swap traffic over the window", func() {
+			sc := newStatsCollector(Thresholds{AverageWindowSize: 10 * time.Second})
+			start := time.Now()
+			sc.addSample(swapSample{timestamp: start, swapInPages: 0, swapOutPages: 0})
+			sc.addSample(swapSample{timestamp: start.Add(5 * time.Second), swapInPages: 500, swapOutPages: 50})
+			sc.addSample(swapSample{timestamp: start.Add(15 * time.Second), swapInPages: 1500, swapOutPages: 150})
+
+			swapIn, swapOut := sc.averageRates()
+			Expect(swapIn).To(Equal(100.0))
+			Expect(swapOut).To(Equal(10.0))
+		})
+	})
+
+	Context("nodePressureReporter", func() {
+		It("should keep reporting pressure for the transition period", func() {
+			r := newNodePressureReporter(nil, "node", NodePressureOptions{TransitionPeriod: time.Minute})
+			start := time.Now()
+			Expect(r.underPressure(nil, start)).To(BeFalse())
+			Expect(r.underPressure([]Signal{SwapUtilizationSignal}, start)).To(BeTrue())
+			Expect(r.underPressure(nil, start.Add(30*time.Second))).To(BeTrue())
+			Expect(r.underPressure(nil, start.Add(time.Minute))).To(BeFalse())
+		})
+
+		It("should keep the last transition time on heartbeats", func() {
+			transitionAt := time.Now().Add(-time.Hour)
+			condition := newSwapPressureCondition(false, nil, time.Now(), transitionAt)
+			Expect(condition.LastTransitionTime.Time).To(Equal(transitionAt))
+			Expect(condition.LastTransitionTime.IsZero()).To(BeFalse())
+		})
+	})
+	Context("swap drain", func() {
+		It("should turn swap off only once the available memory can absorb it", func() {
+			Expect(canAbsorbSwap(6*gi, 10*gi, 5*gi)).To(BeTrue())
+			Expect(canAbsorbSwap(5*gi, 10*gi, 5*gi)).To(BeFalse())
+		})
+
+		It("should give up on the drain after the timeout", func() {
+			now := time.Now()
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				swapDrainStartedAnnotation: now.Add(-drainSwapTimeout - time.Minute).UTC().Format(time.RFC3339),
+			}}}
+			Expect(swapDrainExpired(node, now)).To(BeTrue())
+			node.Annotations[swapDrainStartedAnnotation] = now.Add(-time.Minute).UTC().Format(time.RFC3339)
+			Expect(swapDrainExpired(node, now)).To(BeFalse())
+			Expect(swapDrainExpired(&v1.Node{}, now)).To(BeFalse())
+		})
+
+		It("should not evict DaemonSet pods", func() {
+			dsPod := newPod("ds", 0, "100Mi", "")
+			dsPod.OwnerReferences = []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "ds", Controller: pointer.Bool(true)},
+			}
+			pod := newPod("pod", 0, "100Mi", "")
+			Expect(withoutDaemonSetPods([]*v1.Pod{dsPod, pod})).To(Equal([]*v1.Pod{pod}))
+		})
+	})
+})
@@ -0,0 +1,136 @@
+package eviction_manager
+
+import (
+	"context"
+	"fmt"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	v1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+const (
+	// SwapPressureMigrationLabel marks the migrations created by wasp, its value is the source node name
+	SwapPressureMigrationLabel = "wasp.io/swap-pressure-migration"
+	MigratingReason            = "Migrating"
+)
+
+// getVMIName returns the name of the VirtualMachineInstance owning a virt-launcher pod
+func getVMIName(pod *v1.Pod) (string, bool) {
+	for _, ownerReference := range pod.OwnerReferences {
+		if ownerReference.Kind == kubevirtv1.VirtualMachineInstanceGroupVersionKind.Kind &&
+			ownerReference.APIVersion == kubevirtv1.GroupVersion.String() {
+			return ownerReference.Name, true
+		}
+	}
+	return "", false
+}
+
+func isMigrating(vmi *kubevirtv1.VirtualMachineInstance) bool {
+	return vmi.Status.MigrationState != nil && !vmi.Status.MigrationState.Completed
+}
+
+// countRunningMigrations counts the migrations created by wasp away from this node that did not finish yet
+func (em *EvictionManager) countRunningMigrations() (int, error) {
+	migrations, err := em.waspCli.KubevirtClient().KubevirtV1().VirtualMachineInstanceMigrations(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", SwapPressureMigrationLabel, em.nodeName),
+	})
+	if err != nil {
+		return 0, err
+	}
+	running := 0
+	for _, migration := range migrations.Items {
+		if !migration.IsFinal() {
+			running++
+		}
+	}
+	return running, nil
+}
+
+// waitingForMigrations reports whether migrations created by wasp are still relieving the node. Nothing else is
+// evicted until they finish, however long they take.
+func (em *EvictionManager) waitingForMigrations() bool {
+	if em.maxConcurrentMigrations == 0 {
+		return false
+	}
+	runningMigrations, err := em.countRunningMigrations()
+	if kapierrors.IsNotFound(err) {
+		// KubeVirt isn't installed
+		return false
+	}
+	if err != nil {
+		log.Log.Errorf("EvictionManager: couldn't list migrations: %v", err)
+		return false
+	}
+	if runningMigrations > 0 {
+		log.Log.Infof("EvictionManager: waiting for %v migrations to finish", runningMigrations)
+		return true
+	}
+	return false
+}
+
+// migrationResult tells how the eviction of a virt-launcher pod was handled by a live migration
+type migrationResult int
+
+const (
+	// migrationStarted means that a migration of the VMI away from the node was created
+	migrationStarted migrationResult = iota
+	// migrationInProgress means that the node is already relieved by a migration, nothing should be evicted meanwhile
+	migrationInProgress
+	// migrationFailed means that the VMI couldn't be migrated this time, the next candidate should be tried
+	migrationFailed
+	// migrationUnsupported means that the VMI can't be migrated, the pod should be evicted instead
+	migrationUnsupported
+)
+
+// migrateVMI live migrates the VirtualMachineInstance of a virt-launcher pod away from the node
+func (em *EvictionManager) migrateVMI(pod *v1.Pod, vmiName string, message string) migrationResult {
+	vmi, err := em.waspCli.KubevirtClient().KubevirtV1().VirtualMachineInstances(pod.Namespace).Get(context.Background(), vmiName, metav1.GetOptions{})
+	if kapierrors.IsNotFound(err) {
+		return migrationUnsupported
+	}
+	if err != nil {
+		log.Log.Errorf("EvictionManager: couldn't get VirtualMachineInstance %v/%v: %v", pod.Namespace, vmiName, err)
+		return migrationFailed
+	}
+	if !vmi.IsMigratable() {
+		return migrationUnsupported
+	}
+	if isMigrating(vmi) {
+		log.Log.Infof("EvictionManager: VirtualMachineInstance %v/%v is already migrating", vmi.Namespace, vmi.Name)
+		return migrationInProgress
+	}
+
+	runningMigrations, err := em.countRunningMigrations()
+	if err != nil {
+		log.Log.Errorf("EvictionManager: couldn't list migrations: %v", err)
+		return migrationFailed
+	}
+	if runningMigrations >= em.maxConcurrentMigrations {
+		log.Log.Infof("EvictionManager: %v migrations are already running, not migrating VirtualMachineInstance %v/%v", runningMigrations, vmi.Namespace, vmi.Name)
+		return migrationInProgress
+	}
+
+	migration := &kubevirtv1.VirtualMachineInstanceMigration{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "wasp-" + vmi.Name + "-",
+			Namespace:    vmi.Namespace,
+			Labels: map[string]string{
+				SwapPressureMigrationLabel: em.nodeName,
+			},
+		},
+		Spec: kubevirtv1.VirtualMachineInstanceMigrationSpec{
+			VMIName: vmi.Name,
+		},
+	}
+	_, err = em.waspCli.KubevirtClient().KubevirtV1().VirtualMachineInstanceMigrations(vmi.Namespace).Create(context.Background(), migration, metav1.CreateOptions{})
+	if err != nil {
+		log.Log.Errorf("EvictionManager: failed to migrate VirtualMachineInstance %v/%v: %v", vmi.Namespace, vmi.Name, err)
+		return migrationFailed
+	}
+
+	em.recorder.Eventf(pod, v1.EventTypeWarning, MigratingReason, "%v, live migrating VirtualMachineInstance %v", message, vmi.Name)
+	log.Log.Infof("EvictionManager: migrating VirtualMachineInstance %v/%v: %v", vmi.Namespace, vmi.Name, message)
+	return migrationStarted
+}
@@ -0,0 +1,163 @@
+package eviction_manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openshift-virtualization/wasp-agent/pkg/client"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"time"
+)
+
+const (
+	// SwapPressureCondition is set on the node while it is under swap pressure
+	SwapPressureCondition v1.NodeConditionType = "SwapPressure"
+	// SwapPressureTaintKey is the NoSchedule taint optionally added to the node while it is under swap pressure
+	SwapPressureTaintKey = "wasp.io/swap-pressure"
+
+	swapPressureReason   = "SwapPressure"
+	noSwapPressureReason = "NoSwapPressure"
+	// conditionHeartbeatPeriod is how often the condition is refreshed when it doesn't change
+	conditionHeartbeatPeriod = 1 * time.Minute
+)
+
+// NodePressureOptions configures how swap pressure is reported on the node
+type NodePressureOptions struct {
+	// Taint adds a NoSchedule taint to the node while it is under swap pressure
+	Taint bool
+	// TransitionPeriod is how long the node has to be free of pressure before the condition and the taint are cleared
+	TransitionPeriod time.Duration
+}
+
+// nodePressureReporter reports swap pressure as a node condition and, optionally, a taint.
+// Pressure is reported as soon as a signal is met, and cleared only once no signal
+// was met for the transition period, to avoid flapping.
+type nodePressureReporter struct {
+	waspCli          client.WaspClient
+	nodeName         string
+	options          NodePressureOptions
+	lastPressureAt   time.Time
+	reportedPressure *bool
+	lastReportAt     time.Time
+	// lastTransitionAt is resent on every heartbeat, the strategic merge patch would otherwise clear it
+	lastTransitionAt time.Time
+}
+
+func newNodePressureReporter(waspCli client.WaspClient, nodeName string, options NodePressureOptions) *nodePressureReporter {
+	return &nodePressureReporter{
+		waspCli:  waspCli,
+		nodeName: nodeName,
+		options:  options,
+	}
+}
+
+// underPressure tells whether the node should be reported as under pressure, taking the transition period into account
+func (r *nodePressureReporter) underPressure(signals []Signal, now time.Time) bool {
+	if len(signals) > 0 {
+		r.lastPressureAt = now
+		return true
+	}
+	return !r.lastPressureAt.IsZero() && now.Sub(r.lastPressureAt) < r.options.TransitionPeriod
+}
+
+func (r *nodePressureReporter) report(signals []Signal, now time.Time) {
+	pressure := r.underPressure(signals, now)
+	changed := r.reportedPressure == nil || *r.reportedPressure != pressure
+	if !changed && now.Sub(r.lastReportAt) < conditionHeartbeatPeriod {
+		return
+	}
+
+	transitionAt := r.lastTransitionAt
+	if changed {
+		transitionAt = now
+	}
+	if err := r.setCondition(newSwapPressureCondition(pressure, signals, now, transitionAt)); err != nil {
+		log.Log.Errorf("EvictionManager: failed to set the %v condition of node %v: %v", SwapPressureCondition, r.nodeName, err)
+		return
+	}
+	if changed {
+		if err := r.setTaint(pressure && r.options.Taint); err != nil {
+			log.Log.Errorf("EvictionManager: failed to update the %v taint of node %v: %v", SwapPressureTaintKey, r.nodeName, err)
+			return
+		}
+		log.Log.Infof("EvictionManager: node %v swap pressure: %v", r.nodeName, pressure)
+	}
+
+	r.reportedPressure = &pressure
+	r.lastReportAt = now
+	r.lastTransitionAt = transitionAt
+}
+
+// newSwapPressureCondition builds the SwapPressure condition, always carrying its last transition time
+func newSwapPressureCondition(pressure bool, signals []Signal, now, transitionAt time.Time) v1.NodeCondition {
+	condition := v1.NodeCondition{
+		Type:               SwapPressureCondition,
+		Status:             v1.ConditionFalse,
+		LastHeartbeatTime:  metav1.NewTime(now),
+		LastTransitionTime: metav1.NewTime(transitionAt),
+		Reason:             noSwapPressureReason,
+		Message:            "The node has no swap pressure",
+	}
+	if pressure {
+		condition.Status = v1.ConditionTrue
+		condition.Reason = swapPressureReason
+		condition.Message = fmt.Sprintf(evictionMessageTemplate, signals)
+	}
+	return condition
+}
+
+func (r *nodePressureReporter) setCondition(condition v1.NodeCondition) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []v1.NodeCondition{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.waspCli.CoreV1().Nodes().PatchStatus(context.Background(), r.nodeName, patch)
+	return err
+}
+
+// setTaint adds or removes the swap pressure taint
+func (r *nodePressureReporter) setTaint(taint bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := r.waspCli.CoreV1().Nodes().Get(context.Background(), r.nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		var taints []v1.Taint
+		found := false
+		for _, t := range node.Spec.Taints {
+			if t.Key == SwapPressureTaintKey {
+				found = true
+				continue
+			}
+			taints = append(taints, t)
+		}
+		if found == taint {
+			return nil
+		}
+		if taint {
+			taints = append(taints, v1.Taint{
+				Key:    SwapPressureTaintKey,
+				Effect: v1.TaintEffectNoSchedule,
+			})
+		}
+
+		patch, err := json.Marshal([]map[string]interface{}{
+			{"op": "test", "path": "/metadata/resourceVersion", "value": node.ResourceVersion},
+			{"op": "replace", "path": "/spec/taints", "value": taints},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = r.waspCli.CoreV1().Nodes().Patch(context.Background(), r.nodeName, types.JSONPatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+}
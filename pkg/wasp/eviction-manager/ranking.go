@@ -0,0 +1,163 @@
+package eviction_manager
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	v1resource "k8s.io/kubernetes/pkg/api/v1/resource"
+	"sort"
+)
+
+// podUsage is the memory plus swap usage of each pod in bytes, keyed by pod UID
+type podUsage map[types.UID]uint64
+
+// cmpFunc compares p1 and p2 and returns:
+//
+//	-1 if p1 <  p2
+//	 0 if p1 == p2
+//	+1 if p1 >  p2
+type cmpFunc func(p1, p2 *v1.Pod) int
+
+// multiSorter implements the Sort interface, sorting changes within.
+type multiSorter struct {
+	pods []*v1.Pod
+	cmp  []cmpFunc
+}
+
+// Sort sorts the argument slice according to the less functions passed to OrderedBy.
+func (ms *multiSorter) Sort(pods []*v1.Pod) {
+	ms.pods = pods
+	sort.Sort(ms)
+}
+
+// orderedBy returns a Sorter that sorts using the cmp functions, in order.
+func orderedBy(cmp ...cmpFunc) *multiSorter {
+	return &multiSorter{
+		cmp: cmp,
+	}
+}
+
+func (ms *multiSorter) Len() int {
+	return len(ms.pods)
+}
+
+func (ms *multiSorter) Swap(i, j int) {
+	ms.pods[i], ms.pods[j] = ms.pods[j], ms.pods[i]
+}
+
+// Less tries each cmp function in order until one of them decides.
+func (ms *multiSorter) Less(i, j int) bool {
+	p1, p2 := ms.pods[i], ms.pods[j]
+	var k int
+	for k = 0; k < len(ms.cmp)-1; k++ {
+		cmpResult := ms.cmp[k](p1, p2)
+		if cmpResult < 0 {
+			return true
+		} else if cmpResult > 0 {
+			return false
+		}
+	}
+	return ms.cmp[k](p1, p2) < 0
+}
+
+// cmpBool compares booleans, placing true before false
+func cmpBool(a, b bool) int {
+	if a == b {
+		return 0
+	}
+	if !b {
+		return -1
+	}
+	return 1
+}
+
+// podMemoryLimit returns the sum of the container memory limits, if every container sets one
+func podMemoryLimit(pod *v1.Pod) (resource.Quantity, bool) {
+	for _, container := range pod.Spec.Containers {
+		if container.Resources.Limits.Memory().IsZero() {
+			return resource.Quantity{}, false
+		}
+	}
+	limits := v1resource.PodLimits(pod, v1resource.PodResourcesOptions{})
+	return limits[v1.ResourceMemory], true
+}
+
+func podPriority(pod *v1.Pod) int32 {
+	if pod.Spec.Priority != nil {
+		return *pod.Spec.Priority
+	}
+	return 0
+}
+
+// exceedMemoryLimits places pods whose usage exceeds their memory limits first
+func exceedMemoryLimits(usage podUsage) cmpFunc {
+	return func(p1, p2 *v1.Pod) int {
+		p1Usage, p1Found := usage[p1.UID]
+		p2Usage, p2Found := usage[p2.UID]
+		if !p1Found || !p2Found {
+			// prioritize evicting the pod for which no stats were found
+			return cmpBool(!p1Found, !p2Found)
+		}
+
+		p1Limit, p1HasLimit := podMemoryLimit(p1)
+		p2Limit, p2HasLimit := podMemoryLimit(p2)
+		p1ExceedsLimits := p1HasLimit && resource.NewQuantity(int64(p1Usage), resource.BinarySI).Cmp(p1Limit) == 1
+		p2ExceedsLimits := p2HasLimit && resource.NewQuantity(int64(p2Usage), resource.BinarySI).Cmp(p2Limit) == 1
+		return cmpBool(p1ExceedsLimits, p2ExceedsLimits)
+	}
+}
+
+// exceedMemoryRequests places pods whose usage exceeds their memory requests first
+func exceedMemoryRequests(usage podUsage) cmpFunc {
+	return func(p1, p2 *v1.Pod) int {
+		p1Usage, p1Found := usage[p1.UID]
+		p2Usage, p2Found := usage[p2.UID]
+		if !p1Found || !p2Found {
+			return cmpBool(!p1Found, !p2Found)
+		}
+
+		p1Request := v1resource.GetResourceRequestQuantity(p1, v1.ResourceMemory)
+		p2Request := v1resource.GetResourceRequestQuantity(p2, v1.ResourceMemory)
+		p1ExceedsRequests := resource.NewQuantity(int64(p1Usage), resource.BinarySI).Cmp(p1Request) == 1
+		p2ExceedsRequests := resource.NewQuantity(int64(p2Usage), resource.BinarySI).Cmp(p2Request) == 1
+		return cmpBool(p1ExceedsRequests, p2ExceedsRequests)
+	}
+}
+
+// priority places lower priority pods first
+func priority(p1, p2 *v1.Pod) int {
+	priority1 := podPriority(p1)
+	priority2 := podPriority(p2)
+	if priority1 == priority2 {
+		return 0
+	}
+	if priority1 > priority2 {
+		return 1
+	}
+	return -1
+}
+
+// memory places pods with the highest usage above their requests first
+func memory(usage podUsage) cmpFunc {
+	return func(p1, p2 *v1.Pod) int {
+		p1Usage, p1Found := usage[p1.UID]
+		p2Usage, p2Found := usage[p2.UID]
+		if !p1Found || !p2Found {
+			return cmpBool(!p1Found, !p2Found)
+		}
+
+		p1Memory := resource.NewQuantity(int64(p1Usage), resource.BinarySI)
+		p1Memory.Sub(v1resource.GetResourceRequestQuantity(p1, v1.ResourceMemory))
+		p2Memory := resource.NewQuantity(int64(p2Usage), resource.BinarySI)
+		p2Memory.Sub(v1resource.GetResourceRequestQuantity(p2, v1.ResourceMemory))
+
+		// prioritize evicting the pod which has the larger consumption of memory
+		return p2Memory.Cmp(*p1Memory)
+	}
+}
+
+// rankForEviction orders the pods in the documented eviction order: usage exceeding limits,
+// usage exceeding requests, pod priority and finally usage relative to requests.
+func rankForEviction(pods []*v1.Pod, usage podUsage) {
+	orderedBy(exceedMemoryLimits(usage), exceedMemoryRequests(usage), priority, memory(usage)).Sort(pods)
+}
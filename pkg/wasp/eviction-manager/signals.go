@@ -0,0 +1,136 @@
+package eviction_manager
+
+import (
+	"fmt"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/psi"
+	"github.com/shirou/gopsutil/mem"
+	"time"
+)
+
+const pageSize = 4 * 1024
+
+type Signal string
+
+const (
+	// SwapUtilizationSignal is met when the used swap exceeds the configured fraction of the total swap
+	SwapUtilizationSignal Signal = "SwapUtilization"
+	// SwapTrafficSignal is met when both the average swap-in and swap-out rates exceed the configured maximum
+	SwapTrafficSignal Signal = "SwapTraffic"
+	// MemoryPressureSignal is met when the node memory PSI, averaged over 10 seconds, exceeds the configured maximum
+	MemoryPressureSignal Signal = "MemoryPressure"
+)
+
+// Thresholds configures when the node is considered to be under swap pressure.
+// A zero or negative value disables the corresponding signal.
+type Thresholds struct {
+	SwapUtilizationThresholdFactor  float64
+	MaxAverageSwapInPagesPerSecond  float64
+	MaxAverageSwapOutPagesPerSecond float64
+	// MaxMemoryPressureSomeAvg10 and MaxMemoryPressureFullAvg10 are percentages of stalled time
+	MaxMemoryPressureSomeAvg10 float64
+	MaxMemoryPressureFullAvg10 float64
+	AverageWindowSize          time.Duration
+	GracePeriod                time.Duration
+}
+
+// Observation is a point in time view of the node swap and memory pressure state
+type Observation struct {
+	SwapTotal             uint64
+	SwapUsed              uint64
+	SwapInPagesPerSecond  float64
+	SwapOutPagesPerSecond float64
+	MemoryPressure        psi.Stats
+}
+
+type swapSample struct {
+	timestamp    time.Time
+	swapInPages  uint64
+	swapOutPages uint64
+}
+
+// statsCollector samples the node swap counters and averages the swap traffic over a sliding window
+type statsCollector struct {
+	window  time.Duration
+	samples []swapSample
+	// readPressure is set when a memory pressure threshold is configured
+	readPressure bool
+}
+
+func newStatsCollector(thresholds Thresholds) *statsCollector {
+	return &statsCollector{
+		window:       thresholds.AverageWindowSize,
+		readPressure: thresholds.MaxMemoryPressureSomeAvg10 > 0 || thresholds.MaxMemoryPressureFullAvg10 > 0,
+	}
+}
+
+func (sc *statsCollector) collect(now time.Time) (Observation, error) {
+	swap, err := mem.SwapMemory()
+	if err != nil {
+		return Observation{}, fmt.Errorf("error fetching swap memory: %v", err)
+	}
+
+	sc.addSample(swapSample{
+		timestamp:    now,
+		swapInPages:  swap.Sin / pageSize,
+		swapOutPages: swap.Sout / pageSize,
+	})
+	swapInRate, swapOutRate := sc.averageRates()
+
+	observation := Observation{
+		SwapTotal:             swap.Total,
+		SwapUsed:              swap.Used,
+		SwapInPagesPerSecond:  swapInRate,
+		SwapOutPagesPerSecond: swapOutRate,
+	}
+	if sc.readPressure {
+		observation.MemoryPressure, err = psi.ReadNodeMemoryPressure()
+		if err != nil {
+			return Observation{}, fmt.Errorf("error fetching memory pressure: %v", err)
+		}
+	}
+
+	return observation, nil
+}
+
+func (sc *statsCollector) addSample(sample swapSample) {
+	sc.samples = append(sc.samples, sample)
+	windowStart := sample.timestamp.Add(-sc.window)
+	firstInWindow := 0
+	for firstInWindow < len(sc.samples)-1 && sc.samples[firstInWindow].timestamp.Before(windowStart) {
+		firstInWindow++
+	}
+	sc.samples = sc.samples[firstInWindow:]
+}
+
+func (sc *statsCollector) averageRates() (float64, float64) {
+	if len(sc.samples) < 2 {
+		return 0, 0
+	}
+	first := sc.samples[0]
+	last := sc.samples[len(sc.samples)-1]
+	seconds := last.timestamp.Sub(first.timestamp).Seconds()
+	if seconds <= 0 {
+		return 0, 0
+	}
+
+	return float64(last.swapInPages-first.swapInPages) / seconds, float64(last.swapOutPages-first.swapOutPages) / seconds
+}
+
+// thresholdsMet returns the signals whose thresholds are crossed by the observation
+func thresholdsMet(thresholds Thresholds, observation Observation) []Signal {
+	var signals []Signal
+	if thresholds.SwapUtilizationThresholdFactor > 0 && observation.SwapTotal > 0 &&
+		float64(observation.SwapUsed) > thresholds.SwapUtilizationThresholdFactor*float64(observation.SwapTotal) {
+		signals = append(signals, SwapUtilizationSignal)
+	}
+	if thresholds.MaxAverageSwapInPagesPerSecond > 0 && thresholds.MaxAverageSwapOutPagesPerSecond > 0 &&
+		observation.SwapInPagesPerSecond > thresholds.MaxAverageSwapInPagesPerSecond &&
+		observation.SwapOutPagesPerSecond > thresholds.MaxAverageSwapOutPagesPerSecond {
+		signals = append(signals, SwapTrafficSignal)
+	}
+	if (thresholds.MaxMemoryPressureSomeAvg10 > 0 && observation.MemoryPressure.Some.Avg10 > thresholds.MaxMemoryPressureSomeAvg10) ||
+		(thresholds.MaxMemoryPressureFullAvg10 > 0 && observation.MemoryPressure.Full.Avg10 > thresholds.MaxMemoryPressureFullAvg10) {
+		signals = append(signals, MemoryPressureSignal)
+	}
+	return signals
+}
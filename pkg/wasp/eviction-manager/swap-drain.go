@@ -0,0 +1,228 @@
+package eviction_manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
+	"github.com/shirou/gopsutil/mem"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"strings"
+	"time"
+)
+
+const (
+	// DrainSwapAnnotation requests the agent to drain the swap of its node. With DrainSwapOff the swap is turned
+	// off, with DrainSwapResize it is provisioned again, with the currently configured size, once drained.
+	DrainSwapAnnotation = "wasp.io/drain-swap"
+	DrainSwapOff        = "off"
+	DrainSwapResize     = "resize"
+
+	// DrainSwapStatusAnnotation reports the progress of the swap drain
+	DrainSwapStatusAnnotation = "wasp.io/drain-swap-status"
+	DrainSwapInProgress       = "InProgress"
+	DrainSwapCompleted        = "Completed"
+	DrainSwapFailed           = "Failed"
+
+	// cordonedForSwapDrainAnnotation marks nodes cordoned by the agent, so that only those are uncordoned
+	cordonedForSwapDrainAnnotation = "wasp.io/cordoned-for-swap-drain"
+	// swapDrainStartedAnnotation records when the drain started, to give up on it after drainSwapTimeout
+	swapDrainStartedAnnotation = "wasp.io/drain-swap-started"
+
+	// drainSwapTimeout bounds a drain, e.g. when the remaining pods can't be evicted because of their PDBs
+	drainSwapTimeout = 1 * time.Hour
+
+	// drainSwapMemoryReserve is the share of the node memory that has to remain available once the swap is drained
+	drainSwapMemoryReserve = 0.1
+	drainSwapMessage       = "The swap of the node is being drained"
+)
+
+// drainSwap handles swap drain requests. The swap is turned off once the available memory can absorb the swapped
+// out pages, until then the node is cordoned and pods are evicted, or migrated, one at a time. It reports whether a
+// drain is in progress, in which case the regular eviction is skipped.
+func (em *EvictionManager) drainSwap(now time.Time) bool {
+	node, err := em.nodeLister.Get(em.nodeName)
+	if err != nil {
+		log.Log.Errorf("EvictionManager: couldn't get node %v: %v", em.nodeName, err)
+		return false
+	}
+	request := node.Annotations[DrainSwapAnnotation]
+	status := node.Annotations[DrainSwapStatusAnnotation]
+	switch {
+	case request == "" && status == "":
+		return false
+	case request == "":
+		// the request was withdrawn, possibly before completion
+		em.finishSwapDrain(node, nil)
+		return false
+	case swapDrainFinished(status):
+		return false
+	case request != DrainSwapOff && request != DrainSwapResize:
+		em.finishSwapDrain(node, fmt.Errorf("invalid %v annotation %q, should be %q or %q", DrainSwapAnnotation, request, DrainSwapOff, DrainSwapResize))
+		return false
+	case status == DrainSwapInProgress && swapDrainExpired(node, now):
+		em.finishSwapDrain(node, fmt.Errorf("the swap wasn't drained within %v", drainSwapTimeout))
+		return false
+	}
+
+	devices, err := swap.ReadSwaps()
+	if err != nil {
+		log.Log.Errorf("EvictionManager: %v", err)
+		return true
+	}
+	virtualMem, err := mem.VirtualMemory()
+	if err != nil {
+		log.Log.Errorf("EvictionManager: error fetching virtual memory: %v", err)
+		return true
+	}
+
+	swapUsed := swap.UsedBytes(devices)
+	if !canAbsorbSwap(virtualMem.Available, virtualMem.Total, swapUsed) {
+		log.Log.Infof("EvictionManager: draining swap, %v bytes of swap used and %v bytes of memory available", swapUsed, virtualMem.Available)
+		if status != DrainSwapInProgress || node.Annotations[swapDrainStartedAnnotation] == "" {
+			if err := em.startSwapDrain(node, now); err != nil {
+				log.Log.Errorf("EvictionManager: failed to cordon node %v: %v", em.nodeName, err)
+				return true
+			}
+		}
+		if em.waitingForPodCleanup(now) {
+			return true
+		}
+		candidates, err := em.getEvictionCandidates()
+		if err != nil {
+			log.Log.Errorf("EvictionManager: %v", err)
+			return true
+		}
+		candidates = withoutDaemonSetPods(candidates)
+		rankForEviction(candidates, em.getPodsUsage(candidates))
+		if !em.evictOne(candidates, drainSwapMessage, now) {
+			log.Log.Infof("EvictionManager: no pod can be evicted to drain the swap")
+		}
+		return true
+	}
+
+	// the lister may lag behind the last update of the drain, e.g. still report it in progress right after it
+	// completed, the node is read again before swap is turned off or provisioned a second time
+	node, err = em.waspCli.CoreV1().Nodes().Get(context.Background(), em.nodeName, metav1.GetOptions{})
+	if err != nil {
+		log.Log.Errorf("EvictionManager: couldn't get node %v: %v", em.nodeName, err)
+		return true
+	}
+	if node.Annotations[DrainSwapAnnotation] != request || swapDrainFinished(node.Annotations[DrainSwapStatusAnnotation]) {
+		return false
+	}
+
+	for _, device := range devices {
+		log.Log.Infof("EvictionManager: turning swap %v off", device.Filename)
+		if err := swap.Off(device); err != nil {
+			em.finishSwapDrain(node, err)
+			return false
+		}
+	}
+	if request == DrainSwapResize {
+		if em.provisionSwap == nil {
+			em.finishSwapDrain(node, fmt.Errorf("swap provisioning isn't configured, swap can't be resized"))
+			return false
+		}
+		if err := em.provisionSwap(); err != nil {
+			em.finishSwapDrain(node, err)
+			return false
+		}
+	}
+	em.finishSwapDrain(node, nil)
+	return false
+}
+
+// swapDrainFinished tells whether the drain reported by the status completed or failed
+func swapDrainFinished(status string) bool {
+	return status == DrainSwapCompleted || strings.HasPrefix(status, DrainSwapFailed)
+}
+
+// swapDrainExpired tells whether the drain started more than drainSwapTimeout ago
+func swapDrainExpired(node *v1.Node, now time.Time) bool {
+	startedAt, err := time.Parse(time.RFC3339, node.Annotations[swapDrainStartedAnnotation])
+	if err != nil {
+		return false
+	}
+	return now.Sub(startedAt) > drainSwapTimeout
+}
+
+// withoutDaemonSetPods leaves out the pods of DaemonSets, they would be recreated on the node right away
+func withoutDaemonSetPods(pods []*v1.Pod) []*v1.Pod {
+	var result []*v1.Pod
+	for _, pod := range pods {
+		if controller := metav1.GetControllerOf(pod); controller != nil && controller.Kind == "DaemonSet" {
+			continue
+		}
+		result = append(result, pod)
+	}
+	return result
+}
+
+// canAbsorbSwap tells whether the available memory can hold the swapped out pages, while keeping a reserve
+func canAbsorbSwap(memoryAvailable, memoryTotal, swapUsed uint64) bool {
+	reserve := uint64(float64(memoryTotal) * drainSwapMemoryReserve)
+	return memoryAvailable >= swapUsed+reserve
+}
+
+// startSwapDrain marks the drain as in progress and cordons the node, unless it is already unschedulable
+func (em *EvictionManager) startSwapDrain(node *v1.Node, now time.Time) error {
+	annotations := map[string]interface{}{
+		DrainSwapStatusAnnotation:  DrainSwapInProgress,
+		swapDrainStartedAnnotation: now.UTC().Format(time.RFC3339),
+	}
+	spec := map[string]interface{}{}
+	if !node.Spec.Unschedulable {
+		annotations[cordonedForSwapDrainAnnotation] = "true"
+		spec["unschedulable"] = true
+		log.Log.Infof("EvictionManager: cordoning node %v to drain its swap", em.nodeName)
+	}
+	return em.patchNode(annotations, spec)
+}
+
+// finishSwapDrain reports the outcome of the drain and uncordons the node if it was cordoned for the drain.
+// The status is removed once the request is withdrawn.
+func (em *EvictionManager) finishSwapDrain(node *v1.Node, drainErr error) {
+	var status interface{}
+	switch {
+	case node.Annotations[DrainSwapAnnotation] == "":
+		status = nil
+	case drainErr != nil:
+		status = fmt.Sprintf("%v: %v", DrainSwapFailed, drainErr)
+		log.Log.Errorf("EvictionManager: failed to drain the swap of node %v: %v", em.nodeName, drainErr)
+	default:
+		status = DrainSwapCompleted
+		log.Log.Infof("EvictionManager: drained the swap of node %v", em.nodeName)
+	}
+
+	annotations := map[string]interface{}{
+		DrainSwapStatusAnnotation:  status,
+		swapDrainStartedAnnotation: nil,
+	}
+	spec := map[string]interface{}{}
+	if node.Annotations[cordonedForSwapDrainAnnotation] != "" {
+		annotations[cordonedForSwapDrainAnnotation] = nil
+		spec["unschedulable"] = nil
+		log.Log.Infof("EvictionManager: uncordoning node %v", em.nodeName)
+	}
+	if err := em.patchNode(annotations, spec); err != nil {
+		log.Log.Errorf("EvictionManager: failed to update node %v: %v", em.nodeName, err)
+	}
+}
+
+func (em *EvictionManager) patchNode(annotations, spec map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+		"spec": spec,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = em.waspCli.CoreV1().Nodes().Patch(context.Background(), em.nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
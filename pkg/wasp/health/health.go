@@ -0,0 +1,140 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/util"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Check returns an error while the checked part of wasp-agent is unhealthy
+type Check func() error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker serves the liveness and readiness checks of wasp-agent, in the format of the checks of kube-apiserver
+type Checker struct {
+	lock      sync.RWMutex
+	liveness  []namedCheck
+	readiness []namedCheck
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// AddLivenessCheck adds a check to both the liveness and the readiness, a live wasp-agent isn't necessarily ready
+func (c *Checker) AddLivenessCheck(name string, check Check) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.liveness = append(c.liveness, namedCheck{name, check})
+	c.readiness = append(c.readiness, namedCheck{name, check})
+}
+
+// AddReadinessCheck adds a check to the readiness only
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.readiness = append(c.readiness, namedCheck{name, check})
+}
+
+// Install serves the liveness and the readiness on the mux. The liveness fails when wasp-agent has to be restarted,
+// the readiness while it doesn't manage the swap of the pods of its node.
+func (c *Checker) Install(mux *http.ServeMux) {
+	mux.HandleFunc(util.LivenessPath, func(rw http.ResponseWriter, _ *http.Request) {
+		c.serve(rw, "liveness", c.livenessChecks())
+	})
+	mux.HandleFunc(util.ReadinessPath, func(rw http.ResponseWriter, _ *http.Request) {
+		c.serve(rw, "readiness", c.readinessChecks())
+	})
+}
+
+func (c *Checker) livenessChecks() []namedCheck {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.liveness
+}
+
+func (c *Checker) readinessChecks() []namedCheck {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.readiness
+}
+
+// serve runs all the checks and reports each of them, it answers 500 when one of them fails
+func (c *Checker) serve(rw http.ResponseWriter, kind string, checks []namedCheck) {
+	var b strings.Builder
+	var failed []string
+	for _, check := range checks {
+		if err := check.check(); err != nil {
+			fmt.Fprintf(&b, "[-]%s failed: %v\n", check.name, err)
+			failed = append(failed, check.name)
+			continue
+		}
+		fmt.Fprintf(&b, "[+]%s ok\n", check.name)
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	if len(failed) > 0 {
+		log.Log.Warningf("Health: %v check failed: %v", kind, failed)
+		rw.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(&b, "%s check failed\n", kind)
+	} else {
+		fmt.Fprintf(&b, "%s check passed\n", kind)
+	}
+	if _, err := rw.Write([]byte(b.String())); err != nil {
+		log.Log.Errorf("Health: %v", err)
+	}
+}
+
+// InformersSynced fails until the informers synced their caches
+func InformersSynced(informers ...cache.SharedIndexInformer) Check {
+	return func() error {
+		for _, informer := range informers {
+			if !informer.HasSynced() {
+				return fmt.Errorf("informer caches not synced")
+			}
+		}
+		return nil
+	}
+}
+
+// FilesExist fails when one of the files was removed
+func FilesExist(paths ...string) Check {
+	return func() error {
+		for _, path := range paths {
+			if _, err := os.Stat(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Recent fails when last is older than maxAge. Until something happened, last returns the zero time; the check
+// then fails as well, unless it counts from since.
+func Recent(what string, last func() time.Time, since time.Time, maxAge time.Duration) Check {
+	return func() error {
+		t := last()
+		if t.IsZero() {
+			if since.IsZero() {
+				return fmt.Errorf("no %s yet", what)
+			}
+			t = since
+		}
+		if age := time.Since(t); age > maxAge {
+			return fmt.Errorf("last %s %v ago, more than %v", what, age.Round(time.Second), maxAge)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift-virtualization/wasp-agent/pkg/util"
+)
+
+func get(mux *http.ServeMux, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+var _ = Describe("Health", func() {
+	Context("Checker", func() {
+		var (
+			mux       *http.ServeMux
+			criFailed error
+		)
+
+		BeforeEach(func() {
+			criFailed = nil
+			checker := NewChecker()
+			checker.AddLivenessCheck("workers", func() error { return nil })
+			checker.AddReadinessCheck("cri", func() error { return criFailed })
+			mux = http.NewServeMux()
+			checker.Install(mux)
+		})
+
+		It("should pass when all the checks pass", func() {
+			recorder := get(mux, util.ReadinessPath)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal("[+]workers ok\n[+]cri ok\nreadiness check passed\n"))
+		})
+
+		It("should only fail the readiness on a readiness check", func() {
+			criFailed = fmt.Errorf("connection refused")
+			recorder := get(mux, util.ReadinessPath)
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(ContainSubstring("[-]cri failed: connection refused\n"))
+
+			recorder = get(mux, util.LivenessPath)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal("[+]workers ok\nliveness check passed\n"))
+		})
+	})
+
+	Context("FilesExist", func() {
+		It("should fail when a file is missing", func() {
+			dir := GinkgoT().TempDir()
+			Expect(FilesExist(dir)()).To(Succeed())
+			Expect(FilesExist(dir, filepath.Join(dir, "swap-for-burstable.json"))()).ToNot(Succeed())
+		})
+	})
+
+	Context("Recent", func() {
+		never := func() time.Time { return time.Time{} }
+		ago := func(d time.Duration) func() time.Time {
+			return func() time.Time { return time.Now().Add(-d) }
+		}
+
+		It("should fail until something happened", func() {
+			Expect(Recent("reconcile", never, time.Time{}, time.Minute)()).To(MatchError("no reconcile yet"))
+		})
+
+		It("should count from since until something happened", func() {
+			Expect(Recent("processed pod", never, time.Now(), time.Minute)()).To(Succeed())
+			Expect(Recent("processed pod", never, time.Now().Add(-2*time.Minute), time.Minute)()).
+				To(MatchError(ContainSubstring("last processed pod 2m0s ago")))
+		})
+
+		It("should fail when the last time is too old", func() {
+			Expect(Recent("reconcile", ago(time.Second), time.Time{}, time.Minute)()).To(Succeed())
+			Expect(Recent("reconcile", ago(time.Hour), time.Time{}, time.Minute)()).ToNot(Succeed())
+		})
+	})
+})
@@ -1,49 +1,85 @@
 package limited_swap_manager
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/openshift-virtualization/wasp-agent/pkg/client"
 	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
 	"github.com/shirou/gopsutil/mem"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	v1 "k8s.io/api/core/v1"
 	kapierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	v1lister "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
-	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
 	kubeapiqos "k8s.io/kubernetes/pkg/apis/core/v1/helper/qos"
 	kubelettypes "k8s.io/kubernetes/pkg/kubelet/types"
+	"math"
+	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type enqueueState string
 
 const (
-	Immediate      enqueueState = "Immediate"
-	Forget         enqueueState = "Forget"
-	BackOff        enqueueState = "BackOff"
-	cgroupPathBase              = "/host/sys/fs/cgroup"
+	Immediate enqueueState = "Immediate"
+	Forget    enqueueState = "Forget"
+	BackOff   enqueueState = "BackOff"
 )
 
+const pageSize = 4 * 1024
+
+const (
+	// SwapAnnotation sets the swap policy of a pod, burstable pods get a share of the swap unless it is SwapDisabled
+	SwapAnnotation = "wasp.io/swap"
+	// SwapLimited grants the burstable containers of the pod a share of the swap proportional to their memory request
+	SwapLimited = "limited"
+	// SwapDisabled denies swap to all the containers of the pod
+	SwapDisabled = "disabled"
+)
+
+// Throttling configures how the memory and the swap of burstable containers are throttled
+type Throttling struct {
+	// MemoryThrottlingFactor places memory.high of burstable containers between their memory request (0)
+	// and their memory limit (1), zero disables the throttling
+	MemoryThrottlingFactor float64
+	// SwapHighFactor sets memory.swap.high of burstable containers to a fraction of their memory.swap.max,
+	// zero disables the swap throttling
+	SwapHighFactor float64
+	// ZswapMaxFactor sets memory.zswap.max of burstable containers to a fraction of their memory.swap.max,
+	// zero leaves memory.zswap.max untouched
+	ZswapMaxFactor float64
+}
+
 type LimitedSwapManager struct {
-	podInformer    cache.SharedIndexInformer
-	podLister      v1lister.PodLister
-	podQueue       workqueue.RateLimitingInterface
-	waspCli        client.WaspClient
-	swapCapacity   uint64
+	podInformer cache.SharedIndexInformer
+	podLister   v1lister.PodLister
+	podQueue    workqueue.RateLimitingInterface
+	waspCli     client.WaspClient
+	// swapCapacity is refreshed periodically, as swap may be added or drained while the agent runs
+	swapCapacity   atomic.Uint64
 	memoryCapacity uint64
+	// throttling may be replaced while the agent runs, see SetThrottling
+	throttling atomic.Pointer[Throttling]
+	throttles  *throttles
+	// memoryProtection is nil when memory protection is disabled
+	memoryProtection *memoryProtection
+	// requireEncryptedSwap refuses swap to all the pods while a swap area of the node stores pages in cleartext,
+	// swapEncrypted is refreshed along with the swap capacity
+	requireEncryptedSwap bool
+	swapEncrypted        atomic.Bool
+	// lastProcessed and lastReconciled are the unix times in nanoseconds a pod was last processed by a worker,
+	// and last processed without error
+	lastProcessed  atomic.Int64
+	lastReconciled atomic.Int64
 	nodeName       string
 	stop           <-chan struct{}
 }
@@ -51,6 +87,9 @@ type LimitedSwapManager struct {
 func NewLimitedSwapManager(waspCli client.WaspClient,
 	podInformer cache.SharedIndexInformer,
 	nodeName string,
+	throttling Throttling,
+	memoryProtectionMode string,
+	requireEncryptedSwap bool,
 	stop <-chan struct{},
 ) *LimitedSwapManager {
 	swap, err := mem.SwapMemory()
@@ -61,17 +100,27 @@ func NewLimitedSwapManager(waspCli client.WaspClient,
 	if err != nil {
 		panic(fmt.Sprintf("Error fetching virtualMem memory: %v", err))
 	}
+	memoryProtection, err := newMemoryProtection(memoryProtectionMode)
+	if err != nil {
+		panic(err)
+	}
 	cgroupManager := LimitedSwapManager{
-		podInformer:    podInformer,
-		podLister:      v1lister.NewPodLister(podInformer.GetIndexer()),
-		waspCli:        waspCli,
-		nodeName:       nodeName,
-		podQueue:       workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "pdo-queue-for-cgroup-manager"}),
-		stop:           stop,
-		swapCapacity:   swap.Total,
-		memoryCapacity: virtualMem.Total,
+		podInformer:          podInformer,
+		podLister:            v1lister.NewPodLister(podInformer.GetIndexer()),
+		waspCli:              waspCli,
+		nodeName:             nodeName,
+		podQueue:             workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: "pdo-queue-for-cgroup-manager"}),
+		stop:                 stop,
+		memoryCapacity:       virtualMem.Total,
+		throttles:            newThrottles(),
+		memoryProtection:     memoryProtection,
+		requireEncryptedSwap: requireEncryptedSwap,
 	}
 
+	cgroupManager.throttling.Store(&throttling)
+	cgroupManager.swapCapacity.Store(swap.Total)
+	cgroupManager.refreshSwapEncryption()
+
 	_, err = cgroupManager.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		UpdateFunc: cgroupManager.updatePod,
 		DeleteFunc: cgroupManager.createPod,
@@ -115,6 +164,8 @@ func (lsm *LimitedSwapManager) runWorker() {
 }
 
 func (lsm *LimitedSwapManager) enqueueAllPods() {
+	lsm.refreshSwapCapacity()
+	lsm.refreshSwapEncryption()
 	pods, err := lsm.podLister.List(labels.Everything())
 	if err != nil {
 		log.Log.Errorf(err.Error())
@@ -132,6 +183,41 @@ func (lsm *LimitedSwapManager) enqueueAllPods() {
 	}
 }
 
+// refreshSwapCapacity updates the swap capacity, the swap limits are recomputed as all the pods get enqueued
+func (lsm *LimitedSwapManager) refreshSwapCapacity() {
+	swap, err := mem.SwapMemory()
+	if err != nil {
+		log.Log.Errorf("LimitedSwapManager: error fetching swap memory: %v", err)
+		return
+	}
+	if previous := lsm.swapCapacity.Swap(swap.Total); previous != swap.Total {
+		log.Log.Infof("LimitedSwapManager: swap capacity changed from %v to %v", previous, swap.Total)
+	}
+}
+
+// refreshSwapEncryption checks whether all the swap areas are encrypted, when encryption is required. Swap is
+// refused as long as the encryption can't be verified.
+func (lsm *LimitedSwapManager) refreshSwapEncryption() {
+	if !lsm.requireEncryptedSwap {
+		return
+	}
+	encrypted := false
+	encryptions, err := swap.ReadEncryptions()
+	if err != nil {
+		log.Log.Errorf("LimitedSwapManager: %v", err)
+	} else {
+		encrypted = swap.AllEncrypted(encryptions)
+	}
+	if previous := lsm.swapEncrypted.Swap(encrypted); previous != encrypted {
+		log.Log.Infof("LimitedSwapManager: swap encryption %v, swap granted to pods: %v", encryptions, encrypted)
+	}
+}
+
+// swapGranted tells whether burstable pods may use swap, given the encryption policy
+func (lsm *LimitedSwapManager) swapGranted() bool {
+	return !lsm.requireEncryptedSwap || lsm.swapEncrypted.Load()
+}
+
 func (lsm *LimitedSwapManager) Execute() bool {
 	key, quit := lsm.podQueue.Get()
 	if quit {
@@ -140,8 +226,12 @@ func (lsm *LimitedSwapManager) Execute() bool {
 	defer lsm.podQueue.Done(key)
 
 	err, enqueueState := lsm.execute(key.(string))
+	now := time.Now().UnixNano()
+	lsm.lastProcessed.Store(now)
 	if err != nil {
 		log.Log.Infof(fmt.Sprintf("RQController: Error with key: %v err: %v", key, err))
+	} else {
+		lsm.lastReconciled.Store(now)
 	}
 	switch enqueueState {
 	case BackOff:
@@ -155,34 +245,116 @@ func (lsm *LimitedSwapManager) Execute() bool {
 	return true
 }
 
-func (lsm *LimitedSwapManager) Run(threadiness int) {
+// LastProcessed returns when a worker last processed a pod, the zero time until the first one
+func (lsm *LimitedSwapManager) LastProcessed() time.Time {
+	return unixNanoTime(lsm.lastProcessed.Load())
+}
+
+// LastReconciled returns when the limits of a pod were last set without error, the zero time until the first one
+func (lsm *LimitedSwapManager) LastReconciled() time.Time {
+	return unixNanoTime(lsm.lastReconciled.Load())
+}
+
+func unixNanoTime(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
+
+// SetThrottling replaces the throttling, and sets the limits of all the pods again
+func (lsm *LimitedSwapManager) SetThrottling(throttling Throttling) {
+	if previous := lsm.throttling.Swap(&throttling); *previous != throttling {
+		log.Log.Infof("LimitedSwapManager: throttling changed from %+v to %+v", *previous, throttling)
+		lsm.enqueueAllPods()
+	}
+}
+
+// Run starts the workers, and sets the limits of all the pods every resyncPeriod. Once stopped, it returns after
+// the workers drained the pods already queued, so that no cgroup is left half written.
+func (lsm *LimitedSwapManager) Run(threadiness int, resyncPeriod time.Duration) {
 	defer utilruntime.HandleCrash()
 	log.Log.Infof("Starting LimitedSwapManager")
 	defer log.Log.Infof("Shutting down LimitedSwapManager")
-	defer lsm.podQueue.ShutDown()
 
+	lsm.restoreMemoryProtection()
+	var workers sync.WaitGroup
 	for i := 0; i < threadiness; i++ {
-		go wait.Until(lsm.runWorker, time.Second, lsm.stop)
-		go wait.Until(lsm.enqueueAllPods, metav1.Duration{Duration: 20 * time.Second}.Duration, lsm.stop)
+		workers.Add(1)
+		// a worker only returns once the queue is shut down and empty
+		go func() {
+			defer workers.Done()
+			lsm.runWorker()
+		}()
 	}
+	go wait.Until(lsm.enqueueAllPods, resyncPeriod, lsm.stop)
 
 	<-lsm.stop
+	log.Log.Infof("LimitedSwapManager: draining %v queued pods", lsm.podQueue.Len())
+	lsm.podQueue.ShutDownWithDrain()
+	workers.Wait()
+}
+
+// restoreMemoryProtection restores the protection of the kubepods slices written before the agent restarted, or resets
+// it when memory protection got disabled since
+func (lsm *LimitedSwapManager) restoreMemoryProtection() {
+	if lsm.memoryProtection == nil {
+		if err := resetMemoryProtection(cgroup.CgroupPathBase); err != nil {
+			log.Log.Errorf("LimitedSwapManager: %v", err)
+		}
+		return
+	}
+	pods, err := lsm.podLister.List(labels.Everything())
+	if err != nil {
+		log.Log.Errorf("LimitedSwapManager: %v", err)
+		return
+	}
+	var nodePods []*v1.Pod
+	for _, pod := range pods {
+		if pod.Spec.NodeName == lsm.nodeName {
+			nodePods = append(nodePods, pod)
+		}
+	}
+	if err := lsm.memoryProtection.rebuild(nodePods); err != nil {
+		log.Log.Errorf("LimitedSwapManager: %v", err)
+	}
 }
 
 func (lsm *LimitedSwapManager) execute(key string) (error, enqueueState) {
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	pod, err := lsm.podLister.Pods(namespace).Get(name)
 	if kapierrors.IsNotFound(err) {
+		lsm.throttles.forget(key)
+		if lsm.memoryProtection != nil {
+			if err := lsm.memoryProtection.release(key); err != nil {
+				return err, BackOff
+			}
+		}
 		return nil, Forget
 	} else if err != nil {
 		log.Log.Errorf(err.Error())
 		return err, BackOff
 	}
+
+	if lsm.memoryProtection != nil {
+		if shouldProtectMemory(pod) {
+			err = lsm.memoryProtection.protect(key, pod)
+		} else {
+			err = lsm.memoryProtection.release(key)
+		}
+		if err != nil {
+			log.Log.Infof("LimitSwapManager: couldn't update the memory protection of pod %v: %v", key, err.Error())
+			lsm.podQueue.AddRateLimited(key)
+		}
+	}
+
 	podQos := kubeapiqos.GetPodQOS(pod)
-	setAllContainersSwapToZero := podQos != v1.PodQOSBurstable || kubelettypes.IsCriticalPod(pod)
+	setAllContainersSwapToZero := podQos != v1.PodQOSBurstable || kubelettypes.IsCriticalPod(pod) || !lsm.swapGranted() ||
+		pod.Annotations[SwapAnnotation] == SwapDisabled
+	throttling := lsm.throttling.Load()
 
 	for _, container := range append(pod.Spec.Containers, pod.Spec.InitContainers...) {
-		containerState, exist := getContainerState(pod, container)
+		containerState, exist := cgroup.GetContainerState(pod, container)
 		if !exist || containerState.Waiting != nil || containerState.Running == nil {
 			lsm.podQueue.AddRateLimited(key)
 			continue
@@ -190,13 +362,13 @@ func (lsm *LimitedSwapManager) execute(key string) (error, enqueueState) {
 			continue
 		}
 
-		containerUID, err := getContainerUID(pod, container)
+		containerUID, err := cgroup.GetContainerUID(pod, container)
 		if err != nil {
 			lsm.podQueue.AddRateLimited(key)
 			continue
 		}
 
-		dirPath, err := getContainerCgroupPath(containerUID)
+		dirPath, err := cgroup.GetContainerCgroupPath(containerUID)
 		if err != nil {
 			log.Log.Errorf(err.Error())
 			lsm.podQueue.AddRateLimited(key)
@@ -208,17 +380,50 @@ func (lsm *LimitedSwapManager) execute(key string) (error, enqueueState) {
 			if err != nil {
 				log.Log.Infof("LimitSwapManager: couldn't set swap limit: %v", err.Error())
 				lsm.podQueue.AddRateLimited(key)
+				continue
+			}
+			// the pod may have had swap before, e.g. until its swap got disabled by an annotation
+			if err := lsm.throttles.liftContainer(key, dirPath); err != nil {
+				log.Log.Infof("LimitSwapManager: couldn't lift the throttles: %v", err.Error())
+				lsm.podQueue.AddRateLimited(key)
 			}
 			continue
 		}
 		containerMemoryRequest := container.Resources.Requests.Memory()
-		swapLimit := calcSwapForBurstablePods(containerMemoryRequest.Value(), int64(lsm.memoryCapacity), int64(lsm.swapCapacity))
+		swapLimit := calcSwapForBurstablePods(containerMemoryRequest.Value(), int64(lsm.memoryCapacity), int64(lsm.swapCapacity.Load()))
 		err = setSwapLimit(dirPath, swapLimit)
 		if err != nil {
 			log.Log.Infof("LimitSwapManager: couldn't set swap limit: %v", err.Error())
 			lsm.podQueue.AddRateLimited(key)
 			continue
 		}
+
+		// the throttles written by wasp are lifted when they don't apply, e.g. once disabled by a reload of the configuration
+		swapHigh, ok := calcSwapHigh(swapLimit, throttling.SwapHighFactor)
+		err = lsm.throttles.set(key, dirPath, "memory.swap.high", swapHigh, ok)
+		if err != nil {
+			log.Log.Infof("LimitSwapManager: couldn't set memory.swap.high: %v", err.Error())
+			lsm.podQueue.AddRateLimited(key)
+			continue
+		}
+
+		if zswapSupported(dirPath) {
+			zswapMax, ok := calcZswapMax(swapLimit, throttling.ZswapMaxFactor)
+			err = lsm.throttles.set(key, dirPath, swap.ZswapMaxFile, zswapMax, ok)
+			if err != nil {
+				log.Log.Infof("LimitSwapManager: couldn't set memory.zswap.max: %v", err.Error())
+				lsm.podQueue.AddRateLimited(key)
+				continue
+			}
+		}
+
+		memoryHigh, ok := calcMemoryHigh(containerMemoryRequest.Value(), container.Resources.Limits.Memory().Value(), int64(lsm.memoryCapacity), throttling.MemoryThrottlingFactor)
+		err = lsm.throttles.set(key, dirPath, "memory.high", memoryHigh, ok)
+		if err != nil {
+			log.Log.Infof("LimitSwapManager: couldn't set memory.high: %v", err.Error())
+			lsm.podQueue.AddRateLimited(key)
+			continue
+		}
 	}
 
 	return nil, Forget
@@ -231,93 +436,49 @@ func calcSwapForBurstablePods(containerMemoryRequest, nodeTotalMemory, totalPods
 	return int64(swapAllocation)
 }
 
-func setSwapLimit(dirPath string, swapLimit int64) error {
-	err := cgroups.WriteFile(dirPath, "memory.swap.max", strconv.FormatInt(swapLimit, 10))
-	return err
-}
-
-func getContainerStatusResponse(containerUID string) (*runtimeapi.ContainerStatusResponse, error) {
-	// Set up the gRPC connection to the CRI runtime
-	conn, err := grpc.Dial("unix:///var/run/crio/crio.sock", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	// Create a RuntimeServiceClient
-	client := runtimeapi.NewRuntimeServiceClient(conn)
-
-	// Call the ContainerStatus API to get container information
-	request := &runtimeapi.ContainerStatusRequest{ContainerId: containerUID, Verbose: true}
-	response, err := client.ContainerStatus(context.Background(), request)
-
-	return response, err
-}
-
-type Data struct {
-	Pid int `json:"pid"`
-}
-
-func getContainerCgroupPath(containerUID string) (string, error) {
-	containerStatusResponse, err := getContainerStatusResponse(containerUID)
-	if err != nil {
-		return "", err
-	}
-	if containerStatusResponse.Info == nil {
-		return "", fmt.Errorf("Failed to get container status info")
-	}
-
-	var data Data
-	err = json.Unmarshal([]byte(containerStatusResponse.Info["info"]), &data)
-	if err != nil {
-		return "", err
+// calcMemoryHigh places memory.high between the container memory request and its memory limit, or the node
+// memory when the container has no limit, the same way the kubelet MemoryQoS feature does. It is rounded down
+// to a page and is only set when it lies strictly between the request and the limit.
+func calcMemoryHigh(containerMemoryRequest, containerMemoryLimit, nodeTotalMemory int64, throttlingFactor float64) (int64, bool) {
+	memoryLimit := containerMemoryLimit
+	if memoryLimit == 0 {
+		memoryLimit = nodeTotalMemory
 	}
-	if data.Pid == 0 {
-		return "", fmt.Errorf("PID not found in container info")
+	memoryHigh := int64(math.Floor((float64(containerMemoryRequest)+throttlingFactor*float64(memoryLimit-containerMemoryRequest))/pageSize)) * pageSize
+	if memoryHigh <= containerMemoryRequest || memoryHigh >= memoryLimit {
+		return 0, false
 	}
-
-	return getCgroupPath(strconv.Itoa(data.Pid))
+	return memoryHigh, true
 }
 
-// ReadCgroupFile reads the contents of the cgroup file at the given path.
-func getCgroupPath(pid string) (string, error) {
-	procCgroupBasePath := filepath.Join("/host/proc", pid, "cgroup")
-	controllerPaths, err := cgroups.ParseCgroupFile(procCgroupBasePath)
-	path, ok := controllerPaths[""]
-	if err != nil {
-		return "", err
-	} else if !ok {
-		return "", fmt.Errorf("could not get cgroup path")
+// calcSwapHigh returns the memory.swap.high matching the given memory.swap.max, rounded down to a page.
+// Above it, allocations of the container are throttled before it reaches its swap limit.
+func calcSwapHigh(swapLimit int64, swapHighFactor float64) (int64, bool) {
+	if swapHighFactor <= 0 || swapHighFactor >= 1 || swapLimit <= 0 {
+		return 0, false
 	}
-	return filepath.Join(cgroupPathBase, path), nil
+	swapHigh := int64(math.Floor(float64(swapLimit)*swapHighFactor/pageSize)) * pageSize
+	return swapHigh, swapHigh > 0
 }
 
-func getContainerUID(pod *v1.Pod, container v1.Container) (string, error) {
-	prefix := "cri-o://"
-	for _, conatinerStatus := range pod.Status.ContainerStatuses {
-		if conatinerStatus.Name == container.Name {
-			return strings.TrimPrefix(conatinerStatus.ContainerID, prefix), nil
-		}
+// calcZswapMax returns the memory.zswap.max matching the given memory.swap.max, rounded down to a page
+func calcZswapMax(swapLimit int64, zswapMaxFactor float64) (int64, bool) {
+	if zswapMaxFactor <= 0 || swapLimit < 0 {
+		return 0, false
 	}
-	for _, conatinerStatus := range pod.Status.InitContainerStatuses {
-		if conatinerStatus.Name == container.Name {
-			return strings.TrimPrefix(conatinerStatus.ContainerID, prefix), nil
-		}
+	if zswapMaxFactor > 1 {
+		zswapMaxFactor = 1
 	}
-	return "", fmt.Errorf("cannot find ContainerUID PodName: %v containerName: %v", pod.Name, container.Name)
+	return int64(math.Floor(float64(swapLimit)*zswapMaxFactor/pageSize)) * pageSize, true
 }
 
-func getContainerState(pod *v1.Pod, container v1.Container) (v1.ContainerState, bool) {
-	for _, conatinerStatus := range pod.Status.ContainerStatuses {
-		if conatinerStatus.Name == container.Name {
-			return conatinerStatus.State, true
-		}
-	}
-	for _, conatinerStatus := range pod.Status.InitContainerStatuses {
-		if conatinerStatus.Name == container.Name {
-			return conatinerStatus.State, true
-		}
-	}
+// zswapSupported tells whether the kernel supports limiting the zswap usage of cgroups
+func zswapSupported(dirPath string) bool {
+	_, err := os.Stat(filepath.Join(dirPath, swap.ZswapMaxFile))
+	return err == nil
+}
 
-	return v1.ContainerState{}, false
+func setSwapLimit(dirPath string, swapLimit int64) error {
+	err := cgroups.WriteFile(dirPath, "memory.swap.max", strconv.FormatInt(swapLimit, 10))
+	return err
 }
@@ -0,0 +1,13 @@
+package limited_swap_manager
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestLimitedSwapManager(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "LimitedSwapManager Suite")
+}
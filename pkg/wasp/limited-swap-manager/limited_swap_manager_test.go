@@ -0,0 +1,138 @@
+package limited_swap_manager
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	mi = 1024 * 1024
+	gi = 1024 * mi
+)
+
+var _ = Describe("Limited swap manager", func() {
+	DescribeTable("calcMemoryHigh", func(request, limit int64, factor float64, expected int64, expectedOk bool) {
+		memoryHigh, ok := calcMemoryHigh(request, limit, 16*gi, factor)
+		Expect(ok).To(Equal(expectedOk))
+		Expect(memoryHigh).To(Equal(expected))
+	},
+		Entry("should place memory.high between the request and the limit", int64(1*gi), int64(2*gi), 0.5, int64(1536*mi), true),
+		Entry("should use the node memory when there is no limit", int64(0), int64(0), 0.5, int64(8*gi), true),
+		Entry("should round down to a page", int64(0), int64(3*4096), 0.5, int64(4096), true),
+		Entry("should not set memory.high at the limit", int64(1*gi), int64(2*gi), 1.0, int64(0), false),
+		Entry("should not set memory.high at the request", int64(1*gi), int64(2*gi), 0.0, int64(0), false),
+	)
+	DescribeTable("calcSwapHigh", func(swapLimit int64, factor float64, expected int64, expectedOk bool) {
+		swapHigh, ok := calcSwapHigh(swapLimit, factor)
+		Expect(ok).To(Equal(expectedOk))
+		Expect(swapHigh).To(Equal(expected))
+	},
+		Entry("should set memory.swap.high to a fraction of memory.swap.max", int64(1*gi), 0.75, int64(768*mi), true),
+		Entry("should round down to a page", int64(3*4096), 0.5, int64(4096), true),
+		Entry("should not set memory.swap.high when disabled", int64(1*gi), 0.0, int64(0), false),
+		Entry("should not set memory.swap.high at memory.swap.max", int64(1*gi), 1.0, int64(0), false),
+		Entry("should not set memory.swap.high without swap", int64(0), 0.5, int64(0), false),
+	)
+	It("should protect the parent cgroups with the sum of the protection of the pods beneath them", func() {
+		burstable := filepath.Join(cgroup.CgroupPathBase, "kubepods.slice", "kubepods-burstable.slice")
+		protection := ancestorsProtection(map[string]protectedCgroup{
+			"ns/a": {dirPath: filepath.Join(burstable, "kubepods-burstable-poda.slice"), bytes: 1 * gi},
+			"ns/b": {dirPath: filepath.Join(burstable, "kubepods-burstable-podb.slice"), bytes: 2 * gi},
+			"ns/c": {dirPath: filepath.Join(cgroup.CgroupPathBase, "kubepods.slice", "kubepods-podc.slice"), bytes: 4 * gi},
+		})
+		Expect(protection).To(Equal(map[string]int64{
+			burstable: 3 * gi,
+			filepath.Join(cgroup.CgroupPathBase, "kubepods.slice"): 7 * gi,
+		}))
+	})
+	It("should reset the protection of the kubepods slices once disabled", func() {
+		cgroups.TestMode = true
+		DeferCleanup(func() { cgroups.TestMode = false })
+		base := GinkgoT().TempDir()
+		kubepods := filepath.Join(base, "kubepods.slice")
+		burstable := filepath.Join(kubepods, "kubepods-burstable.slice")
+		Expect(os.MkdirAll(filepath.Join(burstable, "kubepods-burstable-poda.slice"), 0755)).To(Succeed())
+		Expect(kubepodsSlices(base)).To(Equal([]string{kubepods, burstable}))
+
+		Expect(cgroups.WriteFile(kubepods, "memory.low", "1073741824")).To(Succeed())
+		Expect(resetMemoryProtection(base)).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(kubepods, "memory.low"))).To(BeEquivalentTo("0"))
+	})
+	It("should reset the protection of the other mode", func() {
+		cgroups.TestMode = true
+		DeferCleanup(func() { cgroups.TestMode = false })
+		dir := GinkgoT().TempDir()
+		mp, err := newMemoryProtection(MemoryProtectionLow)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mp.otherFile()).To(Equal("memory.min"))
+
+		Expect(cgroups.WriteFile(dir, "memory.min", "1073741824")).To(Succeed())
+		Expect(resetProtection(dir, mp.otherFile())).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, "memory.min"))).To(BeEquivalentTo("0"))
+	})
+	DescribeTable("calcZswapMax", func(swapLimit int64, factor float64, expected int64, expectedOk bool) {
+		zswapMax, ok := calcZswapMax(swapLimit, factor)
+		Expect(ok).To(Equal(expectedOk))
+		Expect(zswapMax).To(Equal(expected))
+	},
+		Entry("should set memory.zswap.max to a fraction of memory.swap.max", int64(1*gi), 0.5, int64(512*mi), true),
+		Entry("should not exceed memory.swap.max", int64(1*gi), 2.0, int64(1*gi), true),
+		Entry("should lift memory.zswap.max when disabled", int64(1*gi), 0.0, int64(0), false),
+	)
+	It("should only lift the throttles it wrote", func() {
+		cgroups.TestMode = true
+		DeferCleanup(func() { cgroups.TestMode = false })
+		dir := GinkgoT().TempDir()
+		t := newThrottles()
+		// e.g. set by the kubelet MemoryQoS feature
+		Expect(cgroups.WriteFile(dir, "memory.high", "2147483648")).To(Succeed())
+		Expect(t.set("ns/a", dir, "memory.high", 0, false)).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, "memory.high"))).To(BeEquivalentTo("2147483648"))
+
+		Expect(t.set("ns/a", dir, "memory.high", 1536*mi, true)).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, "memory.high"))).To(BeEquivalentTo("1610612736"))
+		Expect(t.set("ns/a", dir, "memory.high", 0, false)).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, "memory.high"))).To(BeEquivalentTo("max"))
+	})
+	It("should lift the throttles of containers without swap", func() {
+		cgroups.TestMode = true
+		DeferCleanup(func() { cgroups.TestMode = false })
+		dir := GinkgoT().TempDir()
+		t := newThrottles()
+		Expect(t.set("ns/a", dir, "memory.high", 1536*mi, true)).To(Succeed())
+		Expect(t.set("ns/a", dir, "memory.swap.high", 768*mi, true)).To(Succeed())
+		Expect(t.liftContainer("ns/a", dir)).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, "memory.high"))).To(BeEquivalentTo("max"))
+		Expect(os.ReadFile(filepath.Join(dir, "memory.swap.high"))).To(BeEquivalentTo("max"))
+		Expect(t.written).To(BeEmpty())
+	})
+	It("should drain the queued pods once stopped", func() {
+		stop := make(chan struct{})
+		lsm := &LimitedSwapManager{
+			podLister: v1lister.NewPodLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+			podQueue:  workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+			throttles: newThrottles(),
+			stop:      stop,
+		}
+		lsm.throttling.Store(&Throttling{})
+		for _, key := range []string{"ns/a", "ns/b", "ns/c"} {
+			lsm.podQueue.Add(key)
+		}
+		close(stop)
+
+		lsm.Run(2, time.Hour)
+		Expect(lsm.podQueue.Len()).To(BeZero())
+		Expect(lsm.LastProcessed()).ToNot(BeZero())
+		Expect(lsm.LastReconciled()).ToNot(BeZero())
+	})
+})
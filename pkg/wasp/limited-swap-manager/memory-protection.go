@@ -0,0 +1,288 @@
+package limited_swap_manager
+
+import (
+	"fmt"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	v1 "k8s.io/api/core/v1"
+	kubeapiqos "k8s.io/kubernetes/pkg/apis/core/v1/helper/qos"
+	kubelettypes "k8s.io/kubernetes/pkg/kubelet/types"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	// MemoryProtectionAnnotation opts a pod in for memory protection, critical and guaranteed pods are always protected
+	MemoryProtectionAnnotation = "wasp.io/memory-protection"
+
+	// MemoryProtectionLow protects the memory requests with memory.low, best-effort protection
+	MemoryProtectionLow = "low"
+	// MemoryProtectionMin protects the memory requests with memory.min, hard protection
+	MemoryProtectionMin = "min"
+)
+
+// kubepodsCgroups are the kubepods cgroup and its QoS cgroups, with the systemd and the cgroupfs naming. The
+// guaranteed pods sit right under the kubepods cgroup.
+var kubepodsCgroups = []struct {
+	root string
+	qos  []string
+}{
+	{root: "kubepods.slice", qos: []string{"kubepods-burstable.slice", "kubepods-besteffort.slice"}},
+	{root: "kubepods", qos: []string{"burstable", "besteffort"}},
+}
+
+// memoryProtection shields the memory requests of protected pods from reclaim by setting memory.low or memory.min
+// on their cgroups. The protection of a cgroup is bounded by the protection of its ancestors, so the parent cgroups
+// of the pods are protected with the sum of the protection of the pods beneath them, and lowered again when a
+// protected pod goes away.
+type memoryProtection struct {
+	lock sync.Mutex
+	// file is memory.low or memory.min
+	file string
+	// podCgroups maps the key of each protected pod to its cgroup and protected bytes
+	podCgroups map[string]protectedCgroup
+	// ancestors holds the parent cgroups that were protected so far
+	ancestors map[string]bool
+}
+
+type protectedCgroup struct {
+	dirPath string
+	bytes   int64
+}
+
+func newMemoryProtection(mode string) (*memoryProtection, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case MemoryProtectionLow, MemoryProtectionMin:
+		return &memoryProtection{
+			file:       "memory." + mode,
+			podCgroups: make(map[string]protectedCgroup),
+			ancestors:  make(map[string]bool),
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid memory protection %q, should be %q or %q", mode, MemoryProtectionLow, MemoryProtectionMin)
+}
+
+// rebuild restores the protection of the pods and of their ancestors on startup, from the pods running on the node.
+// The kubepods slices that were protected before the restart, for pods that went away since, are lowered again, and
+// the protection left by a previous run with the other mode is reset.
+func (mp *memoryProtection) rebuild(pods []*v1.Pod) error {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	var errs []error
+	for _, pod := range pods {
+		if err := resetPodProtection(pod, mp.otherFile()); err != nil {
+			errs = append(errs, err)
+		}
+		if !shouldProtectMemory(pod) {
+			continue
+		}
+		var podBytes int64
+		for _, container := range pod.Spec.Containers {
+			if containerState, exist := cgroup.GetContainerState(pod, container); exist && containerState.Running != nil {
+				podBytes += container.Resources.Requests.Memory().Value()
+			}
+		}
+		if podBytes == 0 {
+			continue
+		}
+		podPath, err := cgroup.GetPodCgroupPath(pod)
+		if err != nil {
+			log.Log.Infof("LimitedSwapManager: couldn't restore the memory protection of pod %v/%v: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		mp.podCgroups[pod.Namespace+"/"+pod.Name] = protectedCgroup{dirPath: podPath, bytes: podBytes}
+	}
+	for _, dirPath := range kubepodsSlices(cgroup.CgroupPathBase) {
+		mp.ancestors[dirPath] = true
+		if err := resetProtection(dirPath, mp.otherFile()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := mp.syncAncestors(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to restore the memory protection: %v", errs)
+	}
+	return nil
+}
+
+// otherFile is the protection file of the mode that isn't used
+func (mp *memoryProtection) otherFile() string {
+	if mp.file == "memory.low" {
+		return "memory.min"
+	}
+	return "memory.low"
+}
+
+// resetPodProtection resets a protection file of the cgroups of a pod and of its running containers
+func resetPodProtection(pod *v1.Pod, file string) error {
+	podPath, err := cgroup.GetPodCgroupPath(pod)
+	if err != nil {
+		// the pod has no running containers
+		return nil
+	}
+	dirPaths, err := cgroup.GetRunningContainersCgroupPaths(pod)
+	if err != nil {
+		return err
+	}
+	for _, dirPath := range append(dirPaths, podPath) {
+		if err := resetProtection(dirPath, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetProtection writes 0 to a protection file of a cgroup, unless it is already unprotected
+func resetProtection(dirPath, file string) error {
+	protection, err := cgroup.ReadUint64(dirPath, file)
+	if err != nil || protection == 0 {
+		return nil
+	}
+	if err := cgroups.WriteFile(dirPath, file, "0"); err != nil {
+		return err
+	}
+	log.Log.Infof("LimitedSwapManager: reset %v of %v", file, dirPath)
+	return nil
+}
+
+// resetMemoryProtection lowers the protection left on the kubepods slices by a previous run with memory protection
+// enabled, as the protection of the pods is bounded by it
+func resetMemoryProtection(base string) error {
+	var errs []error
+	for _, dirPath := range kubepodsSlices(base) {
+		for _, file := range []string{"memory.low", "memory.min"} {
+			if err := resetProtection(dirPath, file); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to reset the memory protection of the kubepods slices: %v", errs)
+	}
+	return nil
+}
+
+// kubepodsSlices returns the kubepods cgroup and its QoS cgroups found under the cgroup root
+func kubepodsSlices(base string) []string {
+	var slices []string
+	for _, c := range kubepodsCgroups {
+		rootPath := filepath.Join(base, c.root)
+		if _, err := os.Stat(rootPath); err != nil {
+			continue
+		}
+		slices = append(slices, rootPath)
+		for _, qos := range c.qos {
+			if _, err := os.Stat(filepath.Join(rootPath, qos)); err == nil {
+				slices = append(slices, filepath.Join(rootPath, qos))
+			}
+		}
+	}
+	return slices
+}
+
+func shouldProtectMemory(pod *v1.Pod) bool {
+	return kubelettypes.IsCriticalPod(pod) ||
+		kubeapiqos.GetPodQOS(pod) == v1.PodQOSGuaranteed ||
+		pod.Annotations[MemoryProtectionAnnotation] == "true"
+}
+
+// protect sets the protection of the running containers of the pod to their memory requests
+func (mp *memoryProtection) protect(key string, pod *v1.Pod) error {
+	var podBytes int64
+	for _, container := range pod.Spec.Containers {
+		containerState, exist := cgroup.GetContainerState(pod, container)
+		if !exist || containerState.Running == nil {
+			continue
+		}
+		containerUID, err := cgroup.GetContainerUID(pod, container)
+		if err != nil {
+			return err
+		}
+		dirPath, err := cgroup.GetContainerCgroupPath(containerUID)
+		if err != nil {
+			return err
+		}
+		bytes := container.Resources.Requests.Memory().Value()
+		if err := cgroups.WriteFile(dirPath, mp.file, strconv.FormatInt(bytes, 10)); err != nil {
+			return err
+		}
+		podBytes += bytes
+	}
+	if podBytes == 0 {
+		return mp.release(key)
+	}
+
+	podPath, err := cgroup.GetPodCgroupPath(pod)
+	if err != nil {
+		return err
+	}
+	if err := cgroups.WriteFile(podPath, mp.file, strconv.FormatInt(podBytes, 10)); err != nil {
+		return err
+	}
+
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	if current, ok := mp.podCgroups[key]; ok && current == (protectedCgroup{dirPath: podPath, bytes: podBytes}) {
+		return nil
+	}
+	mp.podCgroups[key] = protectedCgroup{dirPath: podPath, bytes: podBytes}
+	return mp.syncAncestors()
+}
+
+// release removes the protection of a pod that went away from its ancestors
+func (mp *memoryProtection) release(key string) error {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+	if _, ok := mp.podCgroups[key]; !ok {
+		return nil
+	}
+	delete(mp.podCgroups, key)
+	return mp.syncAncestors()
+}
+
+// syncAncestors protects every parent cgroup of the protected pods with the sum of the protection beneath it
+func (mp *memoryProtection) syncAncestors() error {
+	protection := ancestorsProtection(mp.podCgroups)
+	for dirPath := range mp.ancestors {
+		if _, ok := protection[dirPath]; !ok {
+			protection[dirPath] = 0
+		}
+	}
+
+	var errs []error
+	for dirPath, bytes := range protection {
+		err := cgroups.WriteFile(dirPath, mp.file, strconv.FormatInt(bytes, 10))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if bytes == 0 {
+			delete(mp.ancestors, dirPath)
+		} else {
+			mp.ancestors[dirPath] = true
+		}
+		log.Log.V(4).Infof("LimitedSwapManager: set %v of %v to %v", mp.file, dirPath, bytes)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to protect the parent cgroups of the pods: %v", errs)
+	}
+	return nil
+}
+
+// ancestorsProtection sums the protection of the pods under each of their parent cgroups, up to the cgroup root
+func ancestorsProtection(podCgroups map[string]protectedCgroup) map[string]int64 {
+	protection := make(map[string]int64)
+	for _, pc := range podCgroups {
+		for dirPath := filepath.Dir(pc.dirPath); dirPath != cgroup.CgroupPathBase && dirPath != "/" && dirPath != "."; dirPath = filepath.Dir(dirPath) {
+			protection[dirPath] += pc.bytes
+		}
+	}
+	return protection
+}
@@ -0,0 +1,91 @@
+package limited_swap_manager
+
+import (
+	"errors"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// throttles remembers the throttles wasp wrote to the cgroups of the containers of each pod. Only those are lifted
+// once they don't apply anymore, so that the memory.high set by the kubelet MemoryQoS feature is left alone. The
+// throttles written before the agent restarted aren't known, they are kept until they apply again.
+type throttles struct {
+	lock sync.Mutex
+	// written maps the key of each pod to the throttles written to the cgroups of its containers
+	written map[string]map[throttle]bool
+}
+
+type throttle struct {
+	dirPath string
+	file    string
+}
+
+func newThrottles() *throttles {
+	return &throttles{
+		written: make(map[string]map[throttle]bool),
+	}
+}
+
+// set writes a throttle of a container of the pod when it applies, and lifts it with "max" otherwise
+func (t *throttles) set(key, dirPath, file string, limit int64, ok bool) error {
+	if !ok {
+		return t.lift(key, throttle{dirPath: dirPath, file: file})
+	}
+	if err := cgroups.WriteFile(dirPath, file, strconv.FormatInt(limit, 10)); err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.written[key] == nil {
+		t.written[key] = make(map[throttle]bool)
+	}
+	t.written[key][throttle{dirPath: dirPath, file: file}] = true
+	return nil
+}
+
+// liftContainer lifts all the throttles written to the cgroup of a container of the pod
+func (t *throttles) liftContainer(key, dirPath string) error {
+	t.lock.Lock()
+	var written []throttle
+	for th := range t.written[key] {
+		if th.dirPath == dirPath {
+			written = append(written, th)
+		}
+	}
+	t.lock.Unlock()
+	for _, th := range written {
+		if err := t.lift(key, th); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lift writes "max" to a throttle that was written before. Lifting a throttle the kernel doesn't support is a no-op.
+func (t *throttles) lift(key string, th throttle) error {
+	t.lock.Lock()
+	written := t.written[key][th]
+	t.lock.Unlock()
+	if !written {
+		return nil
+	}
+	if err := cgroups.WriteFile(th.dirPath, th.file, "max"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.written[key], th)
+	if len(t.written[key]) == 0 {
+		delete(t.written, key)
+	}
+	return nil
+}
+
+// forget drops the throttles of a pod that went away, along with its cgroups
+func (t *throttles) forget(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.written, key)
+}
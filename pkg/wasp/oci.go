@@ -2,19 +2,28 @@ package wasp
 
 import (
 	"fmt"
+	agent_config "github.com/openshift-virtualization/wasp-agent/pkg/wasp/agent-config"
 	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/config"
 	oci_hook_render "github.com/openshift-virtualization/wasp-agent/pkg/wasp/oci-hook-render"
 	"k8s.io/klog/v2"
 	"os"
+	"path/filepath"
 )
 
 const (
+	// hostRoot is where the root of the host, or the host directories wasp-agent uses, are mounted
+	hostRoot         = "/host"
 	hookTemplateFile = "/app/OCI-hook/hookscript.template"
-	hookScriptPath   = "/host/opt/oci-hook-swap.sh"
-	// CrioConfigPath is the default location for the conf file.
-	CrioConfigPath = "/host/etc/crio/crio.conf"
-	// CrioConfigDropInPath is the default location for the drop-in config files.
-	CrioConfigDropInPath = "/host/etc/crio/crio.conf.d"
+	hookScriptPath   = hostRoot + "/opt/oci-hook-swap.sh"
+	hookFile         = "swap-for-burstable.json"
+	// CrioConfigPath is the default host location for the conf file.
+	CrioConfigPath = "/etc/crio/crio.conf"
+	// CrioConfigDropInPath is the default host location for the drop-in config files.
+	CrioConfigDropInPath = "/etc/crio/crio.conf.d"
+	// OCIHooksDir is the default host location of the OCI hooks of CRI-O
+	OCIHooksDir = "/run/containers/oci/hooks.d"
+	// CRISocketPath is the default host location of the CRI-O socket
+	CRISocketPath = "/var/run/crio/crio.sock"
 )
 
 type crioConfiguration interface {
@@ -25,13 +34,13 @@ type hookRenderer interface {
 	Render() error
 }
 
-func setOCIHook() error {
-	err := setupHookScript()
+func setOCIHook(hostPaths agent_config.HostPaths) error {
+	err := setupHookScript(hostPaths)
 	if err != nil {
 		return err
 	}
 
-	err = moveFile("/app/OCI-hook/swap-for-burstable.json", "/host/run/containers/oci/hooks.d/swap-for-burstable.json")
+	err = moveFile(filepath.Join("/app/OCI-hook", hookFile), filepath.Join(hostRoot, hostPaths.OCIHooksDir, hookFile))
 	if err != nil {
 		return err
 	}
@@ -39,8 +48,24 @@ func setOCIHook() error {
 	return nil
 }
 
-func setupHookScript() error {
-	crioConfig := crioConfiguration(config.New(CrioConfigPath, CrioConfigDropInPath))
+// removeOCIHook removes the OCI hook from the host, before its script so that no container is created with a hook
+// missing its script
+func removeOCIHook(hostPaths agent_config.HostPaths) error {
+	for _, path := range []string{filepath.Join(hostRoot, hostPaths.OCIHooksDir, hookFile), hookScriptPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// newCrioConfig reads the CRI-O configuration from its host locations
+func newCrioConfig(hostPaths agent_config.HostPaths) *config.Config {
+	return config.New(filepath.Join(hostRoot, hostPaths.CrioConfig), filepath.Join(hostRoot, hostPaths.CrioConfigDropIn))
+}
+
+func setupHookScript(hostPaths agent_config.HostPaths) error {
+	crioConfig := crioConfiguration(newCrioConfig(hostPaths))
 	runtime, err := crioConfig.GetRuntime()
 	if err != nil {
 		return err
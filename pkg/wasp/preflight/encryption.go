@@ -0,0 +1,81 @@
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SwapEncryptionAnnotation reports on the node the encryption of each of its swap areas, e.g.
+// {"/dev/dm-1":"dm-crypt","/dev/zram0":"in-memory"}
+const SwapEncryptionAnnotation = "wasp.io/swap-encryption"
+
+// checkSwapEncryption reports the encryption of the swap areas on the node, and fails when encryption is required
+// and a swap area stores pages in cleartext
+func (c *Checker) checkSwapEncryption() *Failure {
+	encryptions, err := swap.ReadEncryptions()
+	if err != nil && c.requireEncryptedSwap {
+		return &Failure{Reason: SwapEncryptionUnknownReason, Message: err.Error()}
+	} else if err != nil {
+		log.Log.Errorf("Preflight: %v", err)
+		return nil
+	}
+	if err := c.reportSwapEncryption(encryptions); err != nil {
+		log.Log.Errorf("Preflight: failed to report the swap encryption on node %v: %v", c.nodeName, err)
+	}
+	if !c.requireEncryptedSwap {
+		return nil
+	}
+	return checkEncryptions(encryptions)
+}
+
+func checkEncryptions(encryptions map[string]swap.Encryption) *Failure {
+	var unencrypted []string
+	for filename, encryption := range encryptions {
+		if !encryption.Encrypted() {
+			unencrypted = append(unencrypted, filename)
+		}
+	}
+	if len(unencrypted) == 0 {
+		return nil
+	}
+	sort.Strings(unencrypted)
+	return &Failure{
+		Reason:  UnencryptedSwapReason,
+		Message: fmt.Sprintf("swap %v is not encrypted, swap is refused to pods", strings.Join(unencrypted, ", ")),
+	}
+}
+
+// reportSwapEncryption annotates the node with the encryption of its swap areas when it changes
+func (c *Checker) reportSwapEncryption(encryptions map[string]swap.Encryption) error {
+	if c.reportedEncryptions != nil && reflect.DeepEqual(c.reportedEncryptions, encryptions) {
+		return nil
+	}
+	value, err := json.Marshal(encryptions)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				SwapEncryptionAnnotation: string(value),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.waspCli.CoreV1().Nodes().Patch(context.Background(), c.nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	c.reportedEncryptions = encryptions
+	return nil
+}
@@ -0,0 +1,128 @@
+package preflight
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+const (
+	nodeSwapFeatureGate = "NodeSwap"
+	noSwapBehavior      = "NoSwap"
+
+	kubeletConfigKind = "KubeletConfiguration"
+	// hostPrefix is where the root of the host is mounted, the processes of the host are seen in /proc as the agent
+	// shares the PID namespace of the host
+	hostPrefix = "/host"
+	procPath   = "/proc"
+)
+
+// kubeletConfigPaths are the usual locations of the kubelet config file, on OpenShift and on kubeadm clusters, used
+// when the --config flag of the kubelet can't be found. On kubeadm clusters /etc/kubernetes/kubelet.conf is the
+// kubeconfig of the kubelet, which is skipped as it isn't a KubeletConfiguration.
+var kubeletConfigPaths = []string{
+	"/etc/kubernetes/kubelet.conf",
+	"/var/lib/kubelet/config.yaml",
+}
+
+// kubeletConfig holds the few fields of the KubeletConfiguration the checks look at
+type kubeletConfig struct {
+	Kind         string          `json:"kind,omitempty"`
+	FailSwapOn   *bool           `json:"failSwapOn,omitempty"`
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+	MemorySwap   struct {
+		SwapBehavior string `json:"swapBehavior,omitempty"`
+	} `json:"memorySwap,omitempty"`
+}
+
+// kubeletProcess is the running kubelet
+type kubeletProcess struct {
+	// root is where the paths of the kubelet resolve, the directories of the kubelet aren't mounted in the agent
+	root string
+	// configFlag is the value of the --config flag of the kubelet, empty when it has none
+	configFlag string
+}
+
+// readKubeletConfig reads the config file the kubelet runs with, as found in its command line, or else the first
+// KubeletConfiguration found at the usual locations
+func (c *Checker) readKubeletConfig() (kubeletConfig, string, error) {
+	root, paths := hostPrefix, kubeletConfigPaths
+	if kubelet, found := findKubelet(procPath); found {
+		root = kubelet.root
+		if kubelet.configFlag != "" {
+			paths = []string{kubelet.configFlag}
+		}
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(filepath.Join(root, path))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return kubeletConfig{}, "", err
+		}
+		config, err := parseKubeletConfig(content)
+		if err != nil {
+			return kubeletConfig{}, "", fmt.Errorf("invalid kubelet config %v: %v", path, err)
+		}
+		if config.Kind != kubeletConfigKind {
+			continue
+		}
+		return config, path, nil
+	}
+	return kubeletConfig{}, "", fmt.Errorf("no %v found in %v", kubeletConfigKind, strings.Join(paths, ", "))
+}
+
+// findKubelet looks the running kubelet up in procPath
+func findKubelet(procPath string) (kubeletProcess, bool) {
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		return kubeletProcess{}, false
+	}
+	for _, entry := range entries {
+		cmdline, err := os.ReadFile(filepath.Join(procPath, entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+		if filepath.Base(args[0]) != "kubelet" {
+			continue
+		}
+		kubelet := kubeletProcess{root: filepath.Join(procPath, entry.Name(), "root")}
+		for i, arg := range args {
+			if value, found := strings.CutPrefix(arg, "--config="); found {
+				kubelet.configFlag = value
+			} else if arg == "--config" && i+1 < len(args) {
+				kubelet.configFlag = args[i+1]
+			}
+		}
+		return kubelet, true
+	}
+	return kubeletProcess{}, false
+}
+
+// parseKubeletConfig parses a KubeletConfiguration, either in YAML or in JSON
+func parseKubeletConfig(content []byte) (kubeletConfig, error) {
+	var config kubeletConfig
+	err := yaml.Unmarshal(content, &config)
+	return config, err
+}
+
+// checkKubeletConfig makes sure the kubelet starts on a node with swap, and leaves the swap of the pods to wasp-agent
+func checkKubeletConfig(config kubeletConfig, source string) *Failure {
+	if config.FailSwapOn == nil || *config.FailSwapOn {
+		return &Failure{
+			Reason:  FailSwapOnReason,
+			Message: fmt.Sprintf("failSwapOn of the kubelet must be false (%v)", source),
+		}
+	}
+	if config.FeatureGates[nodeSwapFeatureGate] || (config.MemorySwap.SwapBehavior != "" && config.MemorySwap.SwapBehavior != noSwapBehavior) {
+		return &Failure{
+			Reason:  NodeSwapEnabledReason,
+			Message: fmt.Sprintf("the %v feature gate and swapBehavior of the kubelet conflict with wasp-agent (%v)", nodeSwapFeatureGate, source),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/openshift-virtualization/wasp-agent/pkg/client"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
+	"golang.org/x/sys/unix"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// NodeSwapReadyCondition tells whether the node meets the requirements of wasp-agent
+	NodeSwapReadyCondition v1.NodeConditionType = "NodeSwapReady"
+
+	ReadyReason                    = "SwapReady"
+	KubeletConfigUnavailableReason = "KubeletConfigUnavailable"
+	FailSwapOnReason               = "FailSwapOnEnabled"
+	NodeSwapEnabledReason          = "NodeSwapFeatureEnabled"
+	CgroupV1Reason                 = "CgroupV2Required"
+	SwapNotEnabledReason           = "SwapNotEnabled"
+	RuntimeUnavailableReason       = "RuntimeUnavailable"
+	UnsupportedRuntimeReason       = "UnsupportedRuntime"
+	SwapEncryptionUnknownReason    = "SwapEncryptionUnknown"
+	UnencryptedSwapReason          = "UnencryptedSwap"
+
+	crioRuntimeName = "cri-o"
+	runtimeTimeout  = 10 * time.Second
+)
+
+// supportedOCIRuntimes are the OCI runtimes the hook knows how to update
+var supportedOCIRuntimes = []string{"runc", "crun"}
+
+// Failure is a failed check, its reason is reported on the NodeSwapReady condition
+type Failure struct {
+	Reason  string
+	Message string
+}
+
+// CrioConfiguration detects the default OCI runtime of CRI-O
+type CrioConfiguration interface {
+	GetRuntime() (string, error)
+}
+
+// Checker verifies that the node can run workloads with swap: the kubelet tolerates swap and doesn't manage it
+// itself, the node uses cgroup v2, swap is enabled, and the runtime is CRI-O with a supported OCI runtime.
+// The encryption of the swap areas is reported on the node, and checked when encrypted swap is required.
+// The result is published as the NodeSwapReady condition of the node, on startup and then periodically.
+type Checker struct {
+	waspCli    client.WaspClient
+	nodeName   string
+	crioConfig CrioConfiguration
+	interval   time.Duration
+	// requireEncryptedSwap fails the checks when a swap area stores pages in cleartext
+	requireEncryptedSwap bool
+	ready                *bool
+	// lastTransitionAt is resent on every report, the strategic merge patch would otherwise clear it
+	lastTransitionAt    time.Time
+	reportedEncryptions map[string]swap.Encryption
+	stop                <-chan struct{}
+}
+
+func NewChecker(waspCli client.WaspClient,
+	nodeName string,
+	crioConfig CrioConfiguration,
+	interval time.Duration,
+	requireEncryptedSwap bool,
+	stop <-chan struct{},
+) *Checker {
+	return &Checker{
+		waspCli:              waspCli,
+		nodeName:             nodeName,
+		crioConfig:           crioConfig,
+		interval:             interval,
+		requireEncryptedSwap: requireEncryptedSwap,
+		stop:                 stop,
+	}
+}
+
+func (c *Checker) Run() {
+	defer utilruntime.HandleCrash()
+	log.Log.Infof("Starting preflight Checker")
+	defer log.Log.Infof("Shutting down preflight Checker")
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.Report()
+		}
+	}
+}
+
+// Report runs the checks, logs the failures and publishes the NodeSwapReady condition
+func (c *Checker) Report() []Failure {
+	failures := c.Check()
+	for _, failure := range failures {
+		log.Log.Errorf("Preflight: %v: %v", failure.Reason, failure.Message)
+	}
+	if err := c.setCondition(failures, time.Now()); err != nil {
+		log.Log.Errorf("Preflight: failed to set the %v condition of node %v: %v", NodeSwapReadyCondition, c.nodeName, err)
+	}
+	return failures
+}
+
+// Check runs all the checks and returns the failed ones
+func (c *Checker) Check() []Failure {
+	var failures []Failure
+	for _, check := range []func() *Failure{
+		c.checkKubelet,
+		checkCgroupV2,
+		checkSwapEnabled,
+		c.checkSwapEncryption,
+		c.checkRuntime,
+	} {
+		if failure := check(); failure != nil {
+			failures = append(failures, *failure)
+		}
+	}
+	return failures
+}
+
+func (c *Checker) checkKubelet() *Failure {
+	config, source, err := c.readKubeletConfig()
+	if err != nil {
+		return &Failure{Reason: KubeletConfigUnavailableReason, Message: err.Error()}
+	}
+	return checkKubeletConfig(config, source)
+}
+
+func checkCgroupV2() *Failure {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(cgroup.CgroupPathBase, &statfs); err != nil {
+		return &Failure{Reason: CgroupV1Reason, Message: fmt.Sprintf("failed to stat %v: %v", cgroup.CgroupPathBase, err)}
+	}
+	if statfs.Type != unix.CGROUP2_SUPER_MAGIC {
+		return &Failure{Reason: CgroupV1Reason, Message: "the node doesn't use cgroup v2"}
+	}
+	return nil
+}
+
+func checkSwapEnabled() *Failure {
+	devices, err := swap.ReadSwaps()
+	if err != nil {
+		return &Failure{Reason: SwapNotEnabledReason, Message: err.Error()}
+	}
+	return checkSwapDevices(devices)
+}
+
+func checkSwapDevices(devices []swap.Device) *Failure {
+	if len(devices) == 0 {
+		return &Failure{Reason: SwapNotEnabledReason, Message: "no swap is enabled on the node"}
+	}
+	return nil
+}
+
+func (c *Checker) checkRuntime() *Failure {
+	version, err := cgroup.GetRuntimeVersion(runtimeTimeout)
+	if err != nil {
+		return &Failure{Reason: RuntimeUnavailableReason, Message: fmt.Sprintf("failed to reach the CRI runtime: %v", err)}
+	}
+	ociRuntime, err := c.crioConfig.GetRuntime()
+	if err != nil {
+		return &Failure{Reason: UnsupportedRuntimeReason, Message: fmt.Sprintf("failed to read the CRI-O config: %v", err)}
+	}
+	return checkRuntimes(version.RuntimeName, ociRuntime)
+}
+
+func checkRuntimes(criRuntime, ociRuntime string) *Failure {
+	if criRuntime != crioRuntimeName {
+		return &Failure{Reason: UnsupportedRuntimeReason, Message: fmt.Sprintf("the CRI runtime is %v, only CRI-O is supported", criRuntime)}
+	}
+	for _, supported := range supportedOCIRuntimes {
+		if ociRuntime == supported {
+			return nil
+		}
+	}
+	return &Failure{
+		Reason:  UnsupportedRuntimeReason,
+		Message: fmt.Sprintf("the OCI runtime is %v, supported runtimes are %v", ociRuntime, strings.Join(supportedOCIRuntimes, ", ")),
+	}
+}
+
+// condition builds the NodeSwapReady condition, with the reason of the first failure and the messages of all of them
+func condition(failures []Failure, now, transitionAt time.Time) v1.NodeCondition {
+	condition := v1.NodeCondition{
+		Type:               NodeSwapReadyCondition,
+		Status:             v1.ConditionTrue,
+		LastHeartbeatTime:  metav1.NewTime(now),
+		LastTransitionTime: metav1.NewTime(transitionAt),
+		Reason:             ReadyReason,
+		Message:            "The node is ready to run workloads with swap",
+	}
+	if len(failures) > 0 {
+		messages := make([]string, len(failures))
+		for i, failure := range failures {
+			messages[i] = failure.Message
+		}
+		condition.Status = v1.ConditionFalse
+		condition.Reason = failures[0].Reason
+		condition.Message = strings.Join(messages, "; ")
+	}
+	return condition
+}
+
+func (c *Checker) setCondition(failures []Failure, now time.Time) error {
+	ready := len(failures) == 0
+	transitionAt := c.lastTransitionAt
+	if c.ready == nil || *c.ready != ready {
+		transitionAt = now
+	}
+	condition := condition(failures, now, transitionAt)
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []v1.NodeCondition{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.waspCli.CoreV1().Nodes().PatchStatus(context.Background(), c.nodeName, patch)
+	if err != nil {
+		return err
+	}
+	c.ready = &ready
+	c.lastTransitionAt = transitionAt
+	return nil
+}
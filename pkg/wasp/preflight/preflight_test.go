@@ -0,0 +1,112 @@
+package preflight
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
+	v1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Preflight", func() {
+	DescribeTable("checkKubeletConfig", func(content string, expectedReason string) {
+		config, err := parseKubeletConfig([]byte(content))
+		Expect(err).ToNot(HaveOccurred())
+		failure := checkKubeletConfig(config, "test")
+		if expectedReason == "" {
+			Expect(failure).To(BeNil())
+		} else {
+			Expect(failure).ToNot(BeNil())
+			Expect(failure.Reason).To(Equal(expectedReason))
+		}
+	},
+		Entry("failSwapOn defaults to true", "kind: KubeletConfiguration\n", FailSwapOnReason),
+		Entry("failSwapOn true", "kind: KubeletConfiguration\nfailSwapOn: true\n", FailSwapOnReason),
+		Entry("failSwapOn false", "kind: KubeletConfiguration\nfailSwapOn: false\n", ""),
+		Entry("failSwapOn false in JSON", `{"kind": "KubeletConfiguration", "failSwapOn": false}`, ""),
+		Entry("NodeSwap feature gate", "kind: KubeletConfiguration\nfailSwapOn: false\nfeatureGates:\n  NodeSwap: true\n", NodeSwapEnabledReason),
+		Entry("NodeSwap feature gate disabled", "kind: KubeletConfiguration\nfailSwapOn: false\nfeatureGates:\n  NodeSwap: false\n", ""),
+		Entry("LimitedSwap behavior", "kind: KubeletConfiguration\nfailSwapOn: false\nmemorySwap:\n  swapBehavior: LimitedSwap\n", NodeSwapEnabledReason),
+		Entry("NoSwap behavior", "kind: KubeletConfiguration\nfailSwapOn: false\nmemorySwap:\n  swapBehavior: NoSwap\n", ""),
+	)
+
+	It("should tell a kubeconfig from a KubeletConfiguration", func() {
+		config, err := parseKubeletConfig([]byte("apiVersion: v1\nkind: Config\nclusters: []\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.Kind).ToNot(Equal(kubeletConfigKind))
+	})
+
+	It("should find the config file of the running kubelet", func() {
+		proc := GinkgoT().TempDir()
+		for pid, cmdline := range map[string]string{
+			"1":    "/usr/lib/systemd/systemd\x00--switched-root\x00",
+			"1234": "/usr/bin/kubelet\x00--config=/var/lib/kubelet/config.yaml\x00--v=2\x00",
+		} {
+			Expect(os.MkdirAll(filepath.Join(proc, pid), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(proc, pid, "cmdline"), []byte(cmdline), 0644)).To(Succeed())
+		}
+		kubelet, found := findKubelet(proc)
+		Expect(found).To(BeTrue())
+		Expect(kubelet.root).To(Equal(filepath.Join(proc, "1234", "root")))
+		Expect(kubelet.configFlag).To(Equal("/var/lib/kubelet/config.yaml"))
+
+		Expect(os.WriteFile(filepath.Join(proc, "1234", "cmdline"), []byte("kubelet\x00--config\x00/etc/kubernetes/kubelet.conf\x00"), 0644)).To(Succeed())
+		kubelet, found = findKubelet(proc)
+		Expect(found).To(BeTrue())
+		Expect(kubelet.configFlag).To(Equal("/etc/kubernetes/kubelet.conf"))
+	})
+
+	It("should require swap", func() {
+		Expect(checkSwapDevices(nil).Reason).To(Equal(SwapNotEnabledReason))
+		Expect(checkSwapDevices([]swap.Device{{Filename: "/swapfile"}})).To(BeNil())
+	})
+
+	It("should fail on unencrypted swap", func() {
+		Expect(checkEncryptions(map[string]swap.Encryption{
+			"/dev/dm-1":  swap.EncryptionDMCrypt,
+			"/dev/zram0": swap.EncryptionInMemory,
+		})).To(BeNil())
+
+		failure := checkEncryptions(map[string]swap.Encryption{
+			"/dev/dm-1":     swap.EncryptionEphemeralKey,
+			"/var/swapfile": swap.EncryptionNone,
+		})
+		Expect(failure.Reason).To(Equal(UnencryptedSwapReason))
+		Expect(failure.Message).To(ContainSubstring("/var/swapfile"))
+		Expect(failure.Message).ToNot(ContainSubstring("/dev/dm-1"))
+	})
+
+	DescribeTable("checkRuntimes", func(criRuntime, ociRuntime string, supported bool) {
+		failure := checkRuntimes(criRuntime, ociRuntime)
+		if supported {
+			Expect(failure).To(BeNil())
+		} else {
+			Expect(failure.Reason).To(Equal(UnsupportedRuntimeReason))
+		}
+	},
+		Entry("CRI-O with runc", "cri-o", "runc", true),
+		Entry("CRI-O with crun", "cri-o", "crun", true),
+		Entry("CRI-O with kata", "cri-o", "kata", false),
+		Entry("containerd", "containerd", "runc", false),
+	)
+
+	It("should report the first failure reason and all the messages", func() {
+		now := time.Now()
+		transitionAt := now.Add(-time.Hour)
+		ready := condition(nil, now, transitionAt)
+		Expect(ready.Status).To(Equal(v1.ConditionTrue))
+		Expect(ready.Reason).To(Equal(ReadyReason))
+		Expect(ready.LastTransitionTime.Time).To(Equal(transitionAt))
+
+		notReady := condition([]Failure{
+			{Reason: FailSwapOnReason, Message: "a"},
+			{Reason: SwapNotEnabledReason, Message: "b"},
+		}, now, now)
+		Expect(notReady.Status).To(Equal(v1.ConditionFalse))
+		Expect(notReady.Reason).To(Equal(FailSwapOnReason))
+		Expect(notReady.Message).To(Equal("a; b"))
+	})
+})
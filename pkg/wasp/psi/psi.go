@@ -0,0 +1,101 @@
+package psi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// NodeMemoryPressurePath is the host wide memory pressure file
+	NodeMemoryPressurePath = "/host/proc/pressure/memory"
+	// CgroupMemoryPressureFile is the memory pressure file of a cgroup v2 directory
+	CgroupMemoryPressureFile = "memory.pressure"
+)
+
+// Line is a single line of a pressure file. Averages are percentages of wall time
+// in which tasks were stalled, total is the accumulated stall time in microseconds.
+type Line struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64
+}
+
+// Stats holds the share of time in which some or all non-idle tasks were stalled
+type Stats struct {
+	Some Line
+	Full Line
+}
+
+// ReadNodeMemoryPressure reads the memory pressure of the whole node
+func ReadNodeMemoryPressure() (Stats, error) {
+	return ReadFile(NodeMemoryPressurePath)
+}
+
+// ReadCgroupMemoryPressure reads the memory pressure of the given cgroup directory
+func ReadCgroupMemoryPressure(dirPath string) (Stats, error) {
+	return ReadFile(filepath.Join(dirPath, CgroupMemoryPressureFile))
+}
+
+func ReadFile(path string) (Stats, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Stats{}, err
+	}
+	return Parse(string(content))
+}
+
+// Parse parses the content of a pressure file, e.g.
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func Parse(content string) (Stats, error) {
+	var stats Stats
+	for _, l := range strings.Split(strings.TrimSpace(content), "\n") {
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+		line, err := parseLine(fields[1:])
+		if err != nil {
+			return Stats{}, fmt.Errorf("malformed pressure line %q: %v", l, err)
+		}
+		switch fields[0] {
+		case "some":
+			stats.Some = line
+		case "full":
+			stats.Full = line
+		default:
+			return Stats{}, fmt.Errorf("unknown pressure line %q", l)
+		}
+	}
+	return stats, nil
+}
+
+func parseLine(fields []string) (Line, error) {
+	var line Line
+	for _, field := range fields {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return Line{}, fmt.Errorf("field %q is not a key=value pair", field)
+		}
+		var err error
+		switch key {
+		case "avg10":
+			line.Avg10, err = strconv.ParseFloat(value, 64)
+		case "avg60":
+			line.Avg60, err = strconv.ParseFloat(value, 64)
+		case "avg300":
+			line.Avg300, err = strconv.ParseFloat(value, 64)
+		case "total":
+			line.Total, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return Line{}, err
+		}
+	}
+	return line, nil
+}
@@ -0,0 +1,13 @@
+package psi
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPSI(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "PSI Suite")
+}
@@ -0,0 +1,24 @@
+package psi
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PSI", func() {
+	It("should parse a memory pressure file", func() {
+		stats, err := Parse("some avg10=1.50 avg60=0.75 avg300=0.10 total=12345\nfull avg10=0.50 avg60=0.25 avg300=0.05 total=678\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats).To(Equal(Stats{
+			Some: Line{Avg10: 1.5, Avg60: 0.75, Avg300: 0.1, Total: 12345},
+			Full: Line{Avg10: 0.5, Avg60: 0.25, Avg300: 0.05, Total: 678},
+		}))
+	})
+
+	It("should fail on malformed content", func() {
+		_, err := Parse("some avg10=abc")
+		Expect(err).To(HaveOccurred())
+		_, err = Parse("other avg10=1.00")
+		Expect(err).To(HaveOccurred())
+	})
+})
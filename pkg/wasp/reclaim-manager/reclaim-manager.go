@@ -0,0 +1,225 @@
+package reclaim_manager
+
+import (
+	"fmt"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/psi"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	v1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	kubeapiqos "k8s.io/kubernetes/pkg/apis/core/v1/helper/qos"
+	kubelettypes "k8s.io/kubernetes/pkg/kubelet/types"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ProactiveReclaimAnnotation opts the burstable containers of a pod in for proactive reclaim
+	ProactiveReclaimAnnotation = "wasp.io/proactive-reclaim"
+
+	pageSize = 4 * 1024
+)
+
+// Options configures the proactive reclaim
+type Options struct {
+	// Interval between two reclaim passes, a container is reclaimed from at most once per pass
+	Interval time.Duration
+	// ReclaimFactor is the fraction of the memory.current of an idle container reclaimed per pass
+	ReclaimFactor float64
+	// MaxBytesPerInterval bounds the memory reclaimed from all the containers of the node per pass
+	MaxBytesPerInterval uint64
+	// MaxIdleCPUMillicores is the CPU usage under which a container is considered idle, zero disables the check
+	MaxIdleCPUMillicores float64
+	// MaxIdleMemoryPressureSomeAvg60 is the memory PSI under which a container is considered idle, zero disables the check
+	MaxIdleMemoryPressureSomeAvg60 float64
+}
+
+type cpuSample struct {
+	timestamp time.Time
+	usageUsec uint64
+}
+
+// ReclaimManager writes to memory.reclaim of idle burstable containers that opted in, pushing their
+// cold pages to swap ahead of time instead of waiting for the global reclaim under memory pressure
+type ReclaimManager struct {
+	podLister v1lister.PodLister
+	nodeName  string
+	options   Options
+	// pendingOptions replace the options on the next pass, but for the interval
+	pendingOptions atomic.Pointer[Options]
+	cpuSamples     map[string]cpuSample
+	stop           <-chan struct{}
+}
+
+func NewReclaimManager(podInformer cache.SharedIndexInformer,
+	nodeName string,
+	options Options,
+	stop <-chan struct{},
+) *ReclaimManager {
+	return &ReclaimManager{
+		podLister:  v1lister.NewPodLister(podInformer.GetIndexer()),
+		nodeName:   nodeName,
+		options:    options,
+		cpuSamples: make(map[string]cpuSample),
+		stop:       stop,
+	}
+}
+
+func (rm *ReclaimManager) Run() {
+	defer utilruntime.HandleCrash()
+	log.Log.Infof("Starting ReclaimManager")
+	defer log.Log.Infof("Shutting down ReclaimManager")
+
+	// returns once stopped and done with the current iteration
+	wait.Until(rm.reclaim, rm.options.Interval, rm.stop)
+}
+
+// SetOptions replaces the options of the next reclaim passes, the interval between the passes only changes once the
+// agent restarts
+func (rm *ReclaimManager) SetOptions(options Options) {
+	rm.pendingOptions.Store(&options)
+}
+
+// applyOptions applies the options set since the last pass
+func (rm *ReclaimManager) applyOptions() {
+	options := rm.pendingOptions.Swap(nil)
+	if options == nil {
+		return
+	}
+	options.Interval = rm.options.Interval
+	if *options == rm.options {
+		return
+	}
+	log.Log.Infof("ReclaimManager: options changed from %+v to %+v", rm.options, *options)
+	rm.options = *options
+}
+
+func (rm *ReclaimManager) reclaim() {
+	rm.applyOptions()
+	now := time.Now()
+	pods, err := rm.podLister.List(labels.Everything())
+	if err != nil {
+		log.Log.Errorf("ReclaimManager: %v", err)
+		return
+	}
+
+	samples := make(map[string]cpuSample)
+	budget := rm.options.MaxBytesPerInterval
+	for _, pod := range pods {
+		if !rm.optedIn(pod) {
+			continue
+		}
+		paths, err := cgroup.GetRunningContainersCgroupPaths(pod)
+		if err != nil {
+			log.Log.V(4).Infof("ReclaimManager: couldn't get the cgroups of pod %v/%v: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		for _, dirPath := range paths {
+			usageUsec, err := readCPUUsage(dirPath)
+			if err != nil {
+				log.Log.V(4).Infof("ReclaimManager: %v", err)
+				continue
+			}
+			sample := cpuSample{timestamp: now, usageUsec: usageUsec}
+			samples[dirPath] = sample
+
+			previous, ok := rm.cpuSamples[dirPath]
+			if !ok || budget == 0 {
+				continue
+			}
+			idle, err := rm.isIdle(dirPath, previous, sample)
+			if err != nil {
+				log.Log.V(4).Infof("ReclaimManager: %v", err)
+				continue
+			}
+			if !idle {
+				continue
+			}
+
+			memoryCurrent, err := cgroup.ReadUint64(dirPath, "memory.current")
+			if err != nil {
+				log.Log.V(4).Infof("ReclaimManager: %v", err)
+				continue
+			}
+			amount := calcReclaimAmount(memoryCurrent, rm.options.ReclaimFactor, budget)
+			if amount == 0 {
+				continue
+			}
+			// the kernel fails the write with EAGAIN when it couldn't reclaim the whole amount, which is expected
+			// for containers with little cold memory, so the budget is consumed either way
+			if err := cgroups.WriteFile(dirPath, "memory.reclaim", strconv.FormatUint(amount, 10)); err != nil {
+				log.Log.V(4).Infof("ReclaimManager: couldn't reclaim %v bytes from %v: %v", amount, dirPath, err)
+			} else {
+				log.Log.V(3).Infof("ReclaimManager: reclaimed %v bytes from pod %v/%v", amount, pod.Namespace, pod.Name)
+			}
+			budget -= amount
+		}
+	}
+	rm.cpuSamples = samples
+}
+
+// optedIn tells whether the pod runs on the node, is burstable and asked for proactive reclaim
+func (rm *ReclaimManager) optedIn(pod *v1.Pod) bool {
+	return pod.Spec.NodeName == rm.nodeName &&
+		pod.Status.Phase == v1.PodRunning &&
+		pod.Annotations[ProactiveReclaimAnnotation] == "true" &&
+		kubeapiqos.GetPodQOS(pod) == v1.PodQOSBurstable &&
+		!kubelettypes.IsCriticalPod(pod)
+}
+
+func (rm *ReclaimManager) isIdle(dirPath string, previous, current cpuSample) (bool, error) {
+	if rm.options.MaxIdleCPUMillicores > 0 &&
+		cpuMillicores(previous, current) > rm.options.MaxIdleCPUMillicores {
+		return false, nil
+	}
+	if rm.options.MaxIdleMemoryPressureSomeAvg60 > 0 {
+		pressure, err := psi.ReadCgroupMemoryPressure(dirPath)
+		if err != nil {
+			return false, err
+		}
+		if pressure.Some.Avg60 > rm.options.MaxIdleMemoryPressureSomeAvg60 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// cpuMillicores returns the average CPU usage between two samples
+func cpuMillicores(previous, current cpuSample) float64 {
+	elapsed := current.timestamp.Sub(previous.timestamp)
+	if elapsed <= 0 || current.usageUsec < previous.usageUsec {
+		return 0
+	}
+	return float64(current.usageUsec-previous.usageUsec) / float64(elapsed.Microseconds()) * 1000
+}
+
+// calcReclaimAmount returns how much to reclaim from a container, rounded down to a page and bounded by the budget
+func calcReclaimAmount(memoryCurrent uint64, reclaimFactor float64, budget uint64) uint64 {
+	amount := uint64(float64(memoryCurrent)*reclaimFactor) / pageSize * pageSize
+	if amount > budget {
+		amount = budget / pageSize * pageSize
+	}
+	return amount
+}
+
+// readCPUUsage reads usage_usec from the cpu.stat file of the cgroup
+func readCPUUsage(dirPath string) (uint64, error) {
+	content, err := cgroups.ReadFile(dirPath, "cpu.stat")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("usage_usec not found in %v/cpu.stat", dirPath)
+}
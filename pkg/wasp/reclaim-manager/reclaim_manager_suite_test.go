@@ -0,0 +1,13 @@
+package reclaim_manager
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestReclaimManager(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ReclaimManager Suite")
+}
@@ -0,0 +1,70 @@
+package reclaim_manager
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPod(annotations map[string]string, requests, limits v1.ResourceList) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", Annotations: annotations},
+		Spec: v1.PodSpec{
+			NodeName: "node",
+			Containers: []v1.Container{
+				{Name: "c", Resources: v1.ResourceRequirements{Requests: requests, Limits: limits}},
+			},
+		},
+		Status: v1.PodStatus{Phase: v1.PodRunning},
+	}
+}
+
+var _ = Describe("Reclaim manager", func() {
+	Context("optedIn", func() {
+		rm := &ReclaimManager{nodeName: "node"}
+		optIn := map[string]string{ProactiveReclaimAnnotation: "true"}
+		burstable := v1.ResourceList{v1.ResourceMemory: resource.MustParse("100Mi")}
+
+		It("should select burstable pods that opted in", func() {
+			Expect(rm.optedIn(newPod(optIn, burstable, nil))).To(BeTrue())
+		})
+
+		It("should ignore pods that didn't opt in", func() {
+			Expect(rm.optedIn(newPod(nil, burstable, nil))).To(BeFalse())
+		})
+
+		It("should ignore guaranteed pods", func() {
+			guaranteed := v1.ResourceList{
+				v1.ResourceMemory: resource.MustParse("100Mi"),
+				v1.ResourceCPU:    resource.MustParse("100m"),
+			}
+			Expect(rm.optedIn(newPod(optIn, guaranteed, guaranteed))).To(BeFalse())
+		})
+	})
+
+	It("should apply the options set since the last pass but for the interval", func() {
+		rm := &ReclaimManager{options: Options{Interval: time.Minute, ReclaimFactor: 0.05}}
+		rm.SetOptions(Options{Interval: time.Hour, ReclaimFactor: 0.1, MaxBytesPerInterval: 4096})
+		rm.applyOptions()
+		Expect(rm.options).To(Equal(Options{Interval: time.Minute, ReclaimFactor: 0.1, MaxBytesPerInterval: 4096}))
+	})
+
+	It("should compute the average CPU usage in millicores", func() {
+		start := time.Now()
+		previous := cpuSample{timestamp: start, usageUsec: 1000000}
+		current := cpuSample{timestamp: start.Add(10 * time.Second), usageUsec: 1500000}
+		Expect(cpuMillicores(previous, current)).To(Equal(50.0))
+	})
+
+	DescribeTable("calcReclaimAmount", func(memoryCurrent uint64, factor float64, budget, expected uint64) {
+		Expect(calcReclaimAmount(memoryCurrent, factor, budget)).To(Equal(expected))
+	},
+		Entry("should reclaim a fraction of the container memory", uint64(1024*pageSize), 0.5, uint64(1024*pageSize), uint64(512*pageSize)),
+		Entry("should round down to a page", uint64(3*pageSize), 0.5, uint64(1024*pageSize), uint64(pageSize)),
+		Entry("should not exceed the budget", uint64(1024*pageSize), 0.5, uint64(10*pageSize+1), uint64(10*pageSize)),
+	)
+})
@@ -0,0 +1,26 @@
+package operator
+
+import (
+	_ "embed"
+
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// waspAgentCRD is generated from pkg/apis by controller-gen, see make generate
+//
+//go:embed crds/wasp.io_waspagents.yaml
+var waspAgentCRD []byte
+
+func createCRDs(_ *FactoryArgs) []client.Object {
+	return []client.Object{createWaspAgentCRD()}
+}
+
+func createWaspAgentCRD() *extv1.CustomResourceDefinition {
+	crd := &extv1.CustomResourceDefinition{}
+	if err := yaml.Unmarshal(waspAgentCRD, crd); err != nil {
+		panic(err)
+	}
+	return crd
+}
@@ -0,0 +1,177 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	waspv1 "github.com/openshift-virtualization/wasp-agent/pkg/apis/wasp/v1alpha1"
+	utils2 "github.com/openshift-virtualization/wasp-agent/pkg/util"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/args"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// CSVPackageName is the OLM package of wasp-operator
+	CSVPackageName = operatorName
+	// minKubeVersion is the first release serving the v1 ValidatingAdmissionPolicy of the node restriction
+	minKubeVersion = "1.30.0"
+)
+
+// CreateClusterServiceVersion creates the CSV installing wasp-operator with OLM. The operator owns the WaspAgent CRD,
+// its cluster permissions are the ones of the wasp-operator ClusterRole. The CSV is built as an unstructured object,
+// since the OLM API isn't vendored.
+func CreateClusterServiceVersion(data *ClusterServiceVersionData) (*unstructured.Unstructured, error) {
+	deployment := createOperatorDeployment(&FactoryArgs{
+		NamespacedArgs: args.FactoryArgs{
+			OperatorVersion: data.OperatorVersion,
+			Verbosity:       data.Verbosity,
+			PullPolicy:      data.ImagePullPolicy,
+			Namespace:       data.Namespace,
+		},
+		Image: data.OperatorImage,
+	})
+	deployment.Spec.Template.Spec.ImagePullSecrets = data.ImagePullSecrets
+	deploymentSpec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&deployment.Spec)
+	if err != nil {
+		return nil, err
+	}
+	var rules []interface{}
+	for _, rule := range getOperatorClusterPolicyRules() {
+		r, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&rule)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	almExamples, err := json.Marshal([]interface{}{createExampleWaspAgent()})
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := map[string]interface{}{
+		"alm-examples":   string(almExamples),
+		"capabilities":   "Basic Install",
+		"categories":     "OpenShift Optional",
+		"containerImage": data.OperatorImage,
+		"description":    "Swap for the burstable workloads of Kubernetes and OpenShift nodes",
+	}
+	if data.Namespace != "" {
+		annotations["operatorframework.io/suggested-namespace"] = data.Namespace
+	}
+	spec := map[string]interface{}{
+		"displayName": "WASP Agent",
+		"description": "wasp-operator deploys wasp-agent, which grants swap to the burstable workloads of the nodes " +
+			"through an OCI hook, and protects the nodes from swap pressure by evicting pods and live migrating VMs.",
+		"version":        strings.TrimPrefix(data.CsvVersion, "v"),
+		"maturity":       "alpha",
+		"minKubeVersion": minKubeVersion,
+		"keywords":       []interface{}{"swap", "memory", "overcommit", "virtualization"},
+		"provider": map[string]interface{}{
+			"name": "OpenShift Virtualization",
+		},
+		"links": []interface{}{
+			map[string]interface{}{
+				"name": "Source Code",
+				"url":  "https://github.com/openshift-virtualization/wasp-agent",
+			},
+		},
+		"installModes": []interface{}{
+			installMode("OwnNamespace", true),
+			installMode("SingleNamespace", false),
+			installMode("MultiNamespace", false),
+			installMode("AllNamespaces", true),
+		},
+		"customresourcedefinitions": map[string]interface{}{
+			"owned": []interface{}{
+				map[string]interface{}{
+					"name":        "waspagents." + waspv1.SchemeGroupVersion.Group,
+					"version":     waspv1.SchemeGroupVersion.Version,
+					"kind":        "WaspAgent",
+					"displayName": "WASP Agent",
+					"description": "Deploys wasp-agent on the nodes",
+				},
+			},
+		},
+		"install": map[string]interface{}{
+			"strategy": "deployment",
+			"spec": map[string]interface{}{
+				"clusterPermissions": []interface{}{
+					map[string]interface{}{
+						"serviceAccountName": utils2.WaspOperatorServiceAccountName,
+						"rules":              rules,
+					},
+				},
+				"deployments": []interface{}{
+					map[string]interface{}{
+						"name":  deployment.Name,
+						"label": toInterfaceMap(deployment.Labels),
+						"spec":  deploymentSpec,
+					},
+				},
+			},
+		},
+		"relatedImages": []interface{}{
+			map[string]interface{}{
+				"name":  operatorName,
+				"image": data.OperatorImage,
+			},
+		},
+	}
+	if data.ReplacesCsvVersion != "" {
+		spec["replaces"] = csvName(data.ReplacesCsvVersion)
+	}
+	if data.IconBase64 != "" {
+		spec["icon"] = []interface{}{
+			map[string]interface{}{
+				"base64data": data.IconBase64,
+				"mediatype":  "image/png",
+			},
+		}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "operators.coreos.com/v1alpha1",
+		"kind":       "ClusterServiceVersion",
+		"metadata": map[string]interface{}{
+			// OLM installs the CSV in the namespace of the operator group
+			"name":        csvName(data.CsvVersion),
+			"namespace":   "placeholder",
+			"annotations": annotations,
+		},
+		"spec": spec,
+	}}, nil
+}
+
+func csvName(version string) string {
+	return fmt.Sprintf("%s.v%s", CSVPackageName, strings.TrimPrefix(version, "v"))
+}
+
+func installMode(mode string, supported bool) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      mode,
+		"supported": supported,
+	}
+}
+
+// createExampleWaspAgent creates the WaspAgent suggested by the console, which deploys wasp-agent with its defaults
+func createExampleWaspAgent() map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": waspv1.SchemeGroupVersion.String(),
+		"kind":       "WaspAgent",
+		"metadata": map[string]interface{}{
+			"name": "wasp",
+		},
+		"spec": map[string]interface{}{},
+	}
+}
+
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range m {
+		result[key] = value
+	}
+	return result
+}
@@ -3,8 +3,10 @@ package operator
 import (
 	"fmt"
 	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/args"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
 	utils "kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk/resources"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -13,6 +15,27 @@ import (
 type FactoryArgs struct {
 	NamespacedArgs args.FactoryArgs
 	Image          string
+	// Placement restricts the nodes wasp-agent runs on, on top of the tolerations it always has
+	Placement sdkapi.NodePlacement
+	// Env is added to the environment of wasp-agent
+	Env []corev1.EnvVar
+	// AgentConfig is the config.yaml of wasp-agent, rendered in the wasp-agent-config ConfigMap when set, e.g. from
+	// the policy of the WaspAgent CR. Without it the ConfigMap is left to the cluster admin.
+	AgentConfig string
+	// PodAnnotations are added to the pod template of wasp-agent
+	PodAnnotations map[string]string
+	// Resources replaces the default resource requests of wasp-agent when set
+	Resources *corev1.ResourceRequirements
+	// PriorityClassName replaces system-node-critical when set
+	PriorityClassName string
+	// UpdateStrategy replaces the default rolling update of the wasp-agent DaemonSet when set
+	UpdateStrategy *appsv1.DaemonSetUpdateStrategy
+	// SwapDisabledPriorityClasses are the priority classes whose pods get no swap from wasp-webhook
+	SwapDisabledPriorityClasses []string
+	// Flavour is either FlavourOpenShift, the default, or FlavourKubernetes
+	Flavour string
+	// SwapProvisioning mounts the root of the host with FlavourKubernetes, for wasp-agent to provision swap
+	SwapProvisioning bool
 }
 
 type factoryFunc func(*FactoryArgs) []client.Object
@@ -42,11 +65,14 @@ func CreateOperatorResourceGroup(group string, args *FactoryArgs) ([]client.Obje
 }
 
 var waspFactoryFunctions = map[string]factoryFunc{
-	"wasp-cluster-rbac": createClusterRBAC,
+	"wasp-cluster-rbac": aggregateFactoryFunc(createClusterRBAC, createNodeRestriction),
 	"wasp-rbac":         createNamespacedRBAC,
 	"wasp-daemonset":    createDaemonSet,
 	"wasp-prom-rule":    createPrometheusRule,
-	"everything":        aggregateFactoryFunc(createClusterRBAC, createNamespacedRBAC, createDaemonSet, createPrometheusRule),
+	"wasp-webhook":      createWebhook,
+	"everything":        aggregateFactoryFunc(createClusterRBAC, createNodeRestriction, createNamespacedRBAC, createDaemonSet, createPrometheusRule, createWebhook),
+	"wasp-crd":          createCRDs,
+	"wasp-operator":     aggregateFactoryFunc(createOperatorRBAC, createOperator),
 }
 
 // ClusterServiceVersionData - Data arguments used to create wasp's CSV manifest
@@ -0,0 +1,53 @@
+package operator
+
+import (
+	"fmt"
+
+	secv1 "github.com/openshift/api/security/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	// FlavourOpenShift deploys wasp-agent with a SecurityContextConstraints granting its privileges
+	FlavourOpenShift = "openshift"
+	// FlavourKubernetes deploys wasp-agent in a namespace labelled for the privileged Pod Security level
+	FlavourKubernetes = "kubernetes"
+
+	podSecurityPrivileged = "privileged"
+)
+
+// PodSecurityLabels admit the privileged wasp-agent pods in its namespace on clusters enforcing Pod Security
+var PodSecurityLabels = map[string]string{
+	"pod-security.kubernetes.io/enforce": podSecurityPrivileged,
+	"pod-security.kubernetes.io/audit":   podSecurityPrivileged,
+	"pod-security.kubernetes.io/warn":    podSecurityPrivileged,
+}
+
+// ValidateFlavour fails on flavours the resource factories don't know
+func ValidateFlavour(flavour string) error {
+	if flavour != FlavourOpenShift && flavour != FlavourKubernetes {
+		return fmt.Errorf("unknown flavour %q, expected %s or %s", flavour, FlavourOpenShift, FlavourKubernetes)
+	}
+	return nil
+}
+
+// DetectFlavour probes the API for the SecurityContextConstraints of OpenShift
+func DetectFlavour(client discovery.DiscoveryInterface) (string, error) {
+	resources, err := client.ServerResourcesForGroupVersion(secv1.GroupVersion.String())
+	if errors.IsNotFound(err) {
+		return FlavourKubernetes, nil
+	} else if err != nil {
+		return "", err
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Kind == "SecurityContextConstraints" {
+			return FlavourOpenShift, nil
+		}
+	}
+	return FlavourKubernetes, nil
+}
+
+func isOpenShift(args *FactoryArgs) bool {
+	return args.Flavour != FlavourKubernetes
+}
@@ -0,0 +1,118 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	utils2 "github.com/openshift-virtualization/wasp-agent/pkg/util"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	nodeRestrictionName = "wasp-agent-node-restriction"
+	// nodeNameExtra is set on the tokens of the service accounts bound to a pod, to the node of the pod
+	nodeNameExtra = "authentication.kubernetes.io/node-name"
+)
+
+// nodeSpecFields are the fields of the node spec wasp-agent never writes, it only cordons the node and taints it
+// with swapPressureTaintKey
+var nodeSpecFields = []string{"podCIDR", "podCIDRs", "providerID", "configSource", "externalID"}
+
+// createNodeRestriction restricts the node writes granted to wasp-agent to the node it runs on, RBAC can't scope
+// them to a single node. The policy and its binding are built as unstructured objects, since the vendored API only
+// has the beta versions of ValidatingAdmissionPolicy.
+func createNodeRestriction(args *FactoryArgs) []client.Object {
+	return []client.Object{
+		createNodeRestrictionPolicy(args.NamespacedArgs.Namespace),
+		createNodeRestrictionPolicyBinding(),
+	}
+}
+
+func createNodeRestrictionPolicy(namespace string) *unstructured.Unstructured {
+	userName := fmt.Sprintf("system:serviceaccount:%s:%s", namespace, utils2.OperatorServiceAccountName)
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "admissionregistration.k8s.io/v1",
+		"kind":       "ValidatingAdmissionPolicy",
+		"metadata": map[string]interface{}{
+			"name":   nodeRestrictionName,
+			"labels": labelsMap(),
+		},
+		"spec": map[string]interface{}{
+			"failurePolicy": "Fail",
+			"matchConstraints": map[string]interface{}{
+				"resourceRules": []interface{}{
+					map[string]interface{}{
+						"apiGroups":   []interface{}{""},
+						"apiVersions": []interface{}{"v1"},
+						"operations":  []interface{}{"UPDATE"},
+						"resources":   []interface{}{"nodes", "nodes/status"},
+					},
+				},
+			},
+			"matchConditions": []interface{}{
+				map[string]interface{}{
+					"name":       "wasp-agent",
+					"expression": fmt.Sprintf("request.userInfo.username == %q", userName),
+				},
+			},
+			"validations": []interface{}{
+				map[string]interface{}{
+					"expression":        fmt.Sprintf("%[1]q in request.userInfo.extra && request.userInfo.extra[%[1]q] == [object.metadata.name]", nodeNameExtra),
+					"messageExpression": `"wasp-agent may only update the node it runs on, not " + object.metadata.name`,
+					"reason":            "Forbidden",
+				},
+				map[string]interface{}{
+					"expression": "(has(object.metadata.labels) ? object.metadata.labels : {}) == " +
+						"(has(oldObject.metadata.labels) ? oldObject.metadata.labels : {})",
+					"message": "wasp-agent may not change the labels of the node",
+					"reason":  "Forbidden",
+				},
+				map[string]interface{}{
+					"expression": nodeSpecUnchangedExpression(),
+					"message":    fmt.Sprintf("wasp-agent may only change spec.unschedulable and the %v taint of the node", swapPressureTaintKey),
+					"reason":     "Forbidden",
+				},
+			},
+		},
+	}}
+}
+
+// nodeSpecUnchangedExpression checks that the node spec is unchanged, except for unschedulable and the taints keyed
+// swapPressureTaintKey
+func nodeSpecUnchangedExpression() string {
+	var conditions []string
+	for _, field := range nodeSpecFields {
+		conditions = append(conditions, fmt.Sprintf("has(object.spec.%[1]s) == has(oldObject.spec.%[1]s) && "+
+			"(!has(object.spec.%[1]s) || object.spec.%[1]s == oldObject.spec.%[1]s)", field))
+	}
+	otherTaints := func(object string) string {
+		return fmt.Sprintf("(has(%[1]s.spec.taints) ? %[1]s.spec.taints.filter(t, t.key != %[2]q) : [])", object, swapPressureTaintKey)
+	}
+	conditions = append(conditions, otherTaints("object")+" == "+otherTaints("oldObject"))
+	return "(" + strings.Join(conditions, ") && (") + ")"
+}
+
+func createNodeRestrictionPolicyBinding() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "admissionregistration.k8s.io/v1",
+		"kind":       "ValidatingAdmissionPolicyBinding",
+		"metadata": map[string]interface{}{
+			"name":   nodeRestrictionName,
+			"labels": labelsMap(),
+		},
+		"spec": map[string]interface{}{
+			"policyName":        nodeRestrictionName,
+			"validationActions": []interface{}{"Deny"},
+		},
+	}}
+}
+
+func labelsMap() map[string]interface{} {
+	labels := make(map[string]interface{})
+	for key, value := range utils2.ResourceBuilder.WithOperatorLabels(nil) {
+		labels[key] = value
+	}
+	return labels
+}
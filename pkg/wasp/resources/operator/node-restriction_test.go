@@ -0,0 +1,46 @@
+package operator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ = Describe("Node restriction", func() {
+	validations := func() []string {
+		policy := createNodeRestrictionPolicy("wasp")
+		list, found, err := unstructured.NestedSlice(policy.Object, "spec", "validations")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		var expressions []string
+		for _, validation := range list {
+			expressions = append(expressions, validation.(map[string]interface{})["expression"].(string))
+		}
+		return expressions
+	}
+
+	It("should match the service account of the namespace", func() {
+		policy := createNodeRestrictionPolicy("wasp-system")
+		conditions, _, err := unstructured.NestedSlice(policy.Object, "spec", "matchConditions")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(conditions[0].(map[string]interface{})["expression"]).To(Equal(`request.userInfo.username == "system:serviceaccount:wasp-system:wasp"`))
+	})
+
+	It("should keep the labels of the node", func() {
+		Expect(validations()).To(ContainElement(And(
+			ContainSubstring("object.metadata.labels"),
+			ContainSubstring("oldObject.metadata.labels"),
+		)))
+	})
+
+	It("should keep the spec of the node but unschedulable and the swap pressure taint", func() {
+		expression := nodeSpecUnchangedExpression()
+		for _, field := range nodeSpecFields {
+			Expect(expression).To(ContainSubstring("object.spec." + field + " == oldObject.spec." + field))
+		}
+		Expect(expression).To(ContainSubstring(`object.spec.taints.filter(t, t.key != "wasp.io/swap-pressure")`))
+		Expect(expression).To(ContainSubstring(`oldObject.spec.taints.filter(t, t.key != "wasp.io/swap-pressure")`))
+		Expect(expression).ToNot(ContainSubstring("unschedulable"))
+		Expect(validations()).To(ContainElement(expression))
+	})
+})
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"github.com/openshift-virtualization/wasp-agent/pkg/monitoring/rules"
 	utils2 "github.com/openshift-virtualization/wasp-agent/pkg/util"
+	"path/filepath"
 
 	secv1 "github.com/openshift/api/security/v1"
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -13,16 +15,26 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/pointer"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
 	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk/resources"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
-	roleName        = "wasp"
-	clusterRoleName = roleName + "-cluster"
-	promRuleName    = "wasp-rules"
+	roleName             = "wasp"
+	clusterRoleName      = roleName + "-cluster"
+	promRuleName         = "wasp-rules"
+	metricsName          = "wasp-agent-metrics"
+	swapPressureTaintKey = "wasp.io/swap-pressure"
+	// AgentConfigMapName is the ConfigMap holding the config.yaml of wasp-agent, mounted at agentConfigDir
+	AgentConfigMapName = "wasp-agent-config"
+	agentConfigDir     = "/etc/wasp"
+	agentConfigFile    = "config.yaml"
 )
 
+// getClusterPolicyRules returns the rules of wasp-agent. The agent reads the pods and the node it runs on, records
+// events, and writes the conditions, taints and annotations of its own node, which the node restriction policy
+// enforces. Evicting pods and live migrating VMs is how it relieves swap pressure.
 func getClusterPolicyRules() []rbacv1.PolicyRule {
 	rules := []rbacv1.PolicyRule{
 		{
@@ -33,8 +45,79 @@ func getClusterPolicyRules() []rbacv1.PolicyRule {
 				"pods",
 			},
 			Verbs: []string{
-				"delete",
+				"get",
+				"list",
 				"watch",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"nodes",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"patch",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"nodes/status",
+			},
+			Verbs: []string{
+				"patch",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"events",
+			},
+			Verbs: []string{
+				"create",
+				"patch",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"pods/eviction",
+			},
+			Verbs: []string{
+				"create",
+			},
+		},
+		{
+			APIGroups: []string{
+				"kubevirt.io",
+			},
+			Resources: []string{
+				"virtualmachineinstances",
+			},
+			Verbs: []string{
+				"get",
+			},
+		},
+		{
+			APIGroups: []string{
+				"kubevirt.io",
+			},
+			Resources: []string{
+				"virtualmachineinstancemigrations",
+			},
+			Verbs: []string{
+				"create",
 				"list",
 			},
 		},
@@ -58,10 +141,13 @@ func createClusterRBAC(args *FactoryArgs) []client.Object {
 	}
 }
 func createNamespacedRBAC(args *FactoryArgs) []client.Object {
-	return []client.Object{
+	objects := []client.Object{
 		createServiceAccount(args.NamespacedArgs.Namespace),
-		CreateSCC(args.NamespacedArgs.Namespace, utils2.OperatorServiceAccountName),
 	}
+	if isOpenShift(args) {
+		objects = append(objects, CreateSCC(args.NamespacedArgs.Namespace, utils2.OperatorServiceAccountName))
+	}
+	return objects
 }
 func createServiceAccount(namespace string) *corev1.ServiceAccount {
 	return utils2.ResourceBuilder.CreateOperatorServiceAccount(utils2.OperatorServiceAccountName, namespace)
@@ -71,19 +157,193 @@ func createPrometheusRule(args *FactoryArgs) []client.Object {
 	if args.NamespacedArgs.DeployPrometheusRule == "true" {
 		return []client.Object{
 			rules.CreatePrometheusRule(promRuleName, args.NamespacedArgs.Namespace),
+			createMetricsService(args.NamespacedArgs.Namespace),
+			createServiceMonitor(args.NamespacedArgs.Namespace),
 		}
 	}
 
 	return nil
 }
 
+func createMetricsService(namespace string) *corev1.Service {
+	service := utils2.ResourceBuilder.CreateService(metricsName, "name", "wasp", nil)
+	service.Namespace = namespace
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	service.Spec.Ports = []corev1.ServicePort{
+		{
+			Name:       utils2.MetricsPortName,
+			Port:       utils2.MetricsPort,
+			TargetPort: intstr.FromString(utils2.MetricsPortName),
+			Protocol:   corev1.ProtocolTCP,
+		},
+	}
+	return service
+}
+
+func createServiceMonitor(namespace string) *promv1.ServiceMonitor {
+	return &promv1.ServiceMonitor{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       promv1.ServiceMonitorsKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      metricsName,
+			Namespace: namespace,
+			Labels:    resources.WithLabels(make(map[string]string), utils2.DaemonSetLabels),
+		},
+		Spec: promv1.ServiceMonitorSpec{
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": "wasp",
+				},
+			},
+			NamespaceSelector: promv1.NamespaceSelector{
+				MatchNames: []string{namespace},
+			},
+			Endpoints: []promv1.Endpoint{
+				{
+					Port: utils2.MetricsPortName,
+					Path: utils2.MetricsPath,
+				},
+			},
+		},
+	}
+}
+
 func createDaemonSet(args *FactoryArgs) []client.Object {
-	return []client.Object{
-		createWaspDaemonSet(args.NamespacedArgs.Namespace,
-			args.NamespacedArgs.Verbosity,
-			args.Image,
-			args.NamespacedArgs.PullPolicy),
+	ds := createWaspDaemonSet(args.NamespacedArgs.Namespace,
+		args.NamespacedArgs.Verbosity,
+		args.Image,
+		args.NamespacedArgs.PullPolicy)
+	setPlacement(&ds.Spec.Template.Spec, args.Placement)
+	if !isOpenShift(args) {
+		setHostVolume(&ds.Spec.Template.Spec, args.SwapProvisioning)
+	}
+	setConfigVolume(&ds.Spec.Template.Spec)
+	setWorkload(ds, args)
+	if args.AgentConfig != "" {
+		return []client.Object{ds, createAgentConfigMap(args.NamespacedArgs.Namespace, args.AgentConfig)}
 	}
+	return []client.Object{ds}
+}
+
+// createAgentConfigMap creates the ConfigMap mounted by setConfigVolume
+func createAgentConfigMap(namespace, config string) *corev1.ConfigMap {
+	configMap := utils2.ResourceBuilder.CreateConfigMap(AgentConfigMapName)
+	configMap.Namespace = namespace
+	configMap.Data = map[string]string{agentConfigFile: config}
+	return configMap
+}
+
+// setWorkload applies the environment, pod annotations, resources, priority class and update strategy of the factory
+// arguments
+func setWorkload(ds *appsv1.DaemonSet, args *FactoryArgs) {
+	container := &ds.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env, args.Env...)
+	for key, value := range args.PodAnnotations {
+		ds.Spec.Template.Annotations[key] = value
+	}
+	if args.Resources != nil {
+		container.Resources = *args.Resources
+	}
+	if args.PriorityClassName != "" {
+		ds.Spec.Template.Spec.PriorityClassName = args.PriorityClassName
+	}
+	if args.UpdateStrategy != nil {
+		ds.Spec.UpdateStrategy = *args.UpdateStrategy
+	}
+}
+
+// hostPath is a host directory mounted at the same path under /host
+type hostPath struct {
+	name     string
+	path     string
+	pathType corev1.HostPathType
+}
+
+// hostPaths are the host directories wasp-agent uses, when it doesn't need the root of the host. The swap files and
+// the kubelet config, whose locations aren't known in advance, are read through the root of the processes of the
+// host in /proc.
+var hostPaths = []hostPath{
+	// the cgroup fs, the block devices, zswap and zram
+	{name: "host-sys", path: "/sys", pathType: corev1.HostPathDirectory},
+	// the memory pressure, the swap areas and the processes of the host
+	{name: "host-proc", path: "/proc", pathType: corev1.HostPathDirectory},
+	{name: "host-crio-config", path: "/etc/crio", pathType: corev1.HostPathDirectory},
+	{name: "host-crio-socket", path: "/var/run/crio", pathType: corev1.HostPathDirectory},
+	// the OCI hooks, CRI-O reads both directories by default
+	{name: "host-run-oci-hooks", path: "/run/containers/oci/hooks.d", pathType: corev1.HostPathDirectoryOrCreate},
+	{name: "host-etc-oci-hooks", path: "/etc/containers/oci/hooks.d", pathType: corev1.HostPathDirectoryOrCreate},
+	// the script of the OCI hook
+	{name: "host-opt", path: "/opt", pathType: corev1.HostPathDirectoryOrCreate},
+}
+
+// setHostVolume mounts the host directories wasp-agent uses under /host, or the root of the host when swap
+// provisioning creates a swap file or formats a partition at a path that isn't known in advance. Unlike on OpenShift
+// the host isn't mounted at /rootfs, cadvisor then reads the processes of the host from /proc.
+func setHostVolume(podSpec *corev1.PodSpec, swapProvisioning bool) {
+	paths := hostPaths
+	if swapProvisioning {
+		paths = []hostPath{{name: "host", path: "/", pathType: corev1.HostPathDirectory}}
+	}
+	podSpec.Volumes = nil
+	podSpec.Containers[0].VolumeMounts = nil
+	for _, path := range paths {
+		pathType := path.pathType
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: path.name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: path.path,
+					Type: &pathType,
+				},
+			},
+		})
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      path.name,
+			MountPath: filepath.Join("/host", path.path),
+		})
+	}
+}
+
+// setConfigVolume mounts the optional wasp-agent ConfigMap, whose changes are picked up without restarting the pods
+func setConfigVolume(podSpec *corev1.PodSpec) {
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "config",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: AgentConfigMapName},
+				Optional:             boolPtr(true),
+			},
+		},
+	})
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "config",
+		MountPath: agentConfigDir,
+		ReadOnly:  true,
+	})
+}
+
+func createProbe(path string, initialDelaySeconds, failureThreshold int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromString(utils2.MetricsPortName),
+			},
+		},
+		InitialDelaySeconds: initialDelaySeconds,
+		PeriodSeconds:       10,
+		TimeoutSeconds:      5,
+		FailureThreshold:    failureThreshold,
+	}
+}
+
+// setPlacement applies the node placement, its tolerations come in addition to the default ones
+func setPlacement(podSpec *corev1.PodSpec, placement sdkapi.NodePlacement) {
+	podSpec.NodeSelector = placement.NodeSelector
+	podSpec.Affinity = placement.Affinity
+	podSpec.Tolerations = append(podSpec.Tolerations, placement.Tolerations...)
 }
 
 func createDaemonSetEnvVar(verbosity string) []corev1.EnvVar {
@@ -117,6 +377,16 @@ func createWaspDaemonSet(namespace, verbosity, waspImage, pullPolicy string) *ap
 		SecurityContext: &corev1.SecurityContext{
 			Privileged: boolPtr(true),
 		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          utils2.MetricsPortName,
+				ContainerPort: utils2.MetricsPort,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+		// the liveness only fails when the OCI hook was removed or the workers are stuck, see initHealthChecker
+		LivenessProbe:  createProbe(utils2.LivenessPath, 30, 6),
+		ReadinessProbe: createProbe(utils2.ReadinessPath, 5, 3),
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      "host",
@@ -161,7 +431,7 @@ func createWaspDaemonSet(namespace, verbosity, waspImage, pullPolicy string) *ap
 					ServiceAccountName:            "wasp",
 					HostPID:                       true,
 					HostUsers:                     boolPtr(true),
-					TerminationGracePeriodSeconds: int64Ptr(5),
+					TerminationGracePeriodSeconds: int64Ptr(30),
 					Containers:                    []corev1.Container{container},
 					Volumes: []corev1.Volume{
 						{
@@ -182,6 +452,13 @@ func createWaspDaemonSet(namespace, verbosity, waspImage, pullPolicy string) *ap
 						},
 					},
 					PriorityClassName: "system-node-critical",
+					Tolerations: []corev1.Toleration{
+						{
+							Key:      swapPressureTaintKey,
+							Operator: corev1.TolerationOpExists,
+							Effect:   corev1.TaintEffectNoSchedule,
+						},
+					},
 				},
 			},
 			UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
@@ -0,0 +1,66 @@
+package operator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("wasp-agent DaemonSet", func() {
+	createPodSpec := func(flavour string, swapProvisioning bool) corev1.PodSpec {
+		objects := createDaemonSet(&FactoryArgs{Flavour: flavour, SwapProvisioning: swapProvisioning})
+		Expect(objects).To(HaveLen(1))
+		return objects[0].(*appsv1.DaemonSet).Spec.Template.Spec
+	}
+
+	hostPathsOf := func(podSpec corev1.PodSpec) map[string]string {
+		mountPaths := make(map[string]string)
+		for _, mount := range podSpec.Containers[0].VolumeMounts {
+			mountPaths[mount.Name] = mount.MountPath
+		}
+		result := make(map[string]string)
+		for _, volume := range podSpec.Volumes {
+			if volume.HostPath != nil {
+				result[volume.HostPath.Path] = mountPaths[volume.Name]
+			}
+		}
+		return result
+	}
+
+	It("should only mount the host directories wasp-agent uses on kubernetes", func() {
+		paths := hostPathsOf(createPodSpec(FlavourKubernetes, false))
+		Expect(paths).ToNot(HaveKey("/"))
+		Expect(paths).To(HaveLen(len(hostPaths)))
+		Expect(paths).To(HaveKeyWithValue("/sys", "/host/sys"))
+		Expect(paths).To(HaveKeyWithValue("/proc", "/host/proc"))
+		Expect(paths).To(HaveKeyWithValue("/etc/crio", "/host/etc/crio"))
+		Expect(paths).To(HaveKeyWithValue("/var/run/crio", "/host/var/run/crio"))
+		Expect(paths).To(HaveKeyWithValue("/run/containers/oci/hooks.d", "/host/run/containers/oci/hooks.d"))
+	})
+
+	It("should mount the root of the host on kubernetes for swap provisioning", func() {
+		Expect(hostPathsOf(createPodSpec(FlavourKubernetes, true))).To(Equal(map[string]string{"/": "/host"}))
+	})
+
+	It("should mount the config of wasp-agent", func() {
+		podSpec := createPodSpec(FlavourKubernetes, false)
+		Expect(podSpec.Volumes).To(ContainElement(HaveField("Name", "config")))
+		Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(HaveField("MountPath", agentConfigDir)))
+	})
+
+	It("should render the config of wasp-agent when set", func() {
+		args := &FactoryArgs{
+			AgentConfig:    "apiVersion: wasp.io/v1alpha1\nkind: WaspAgentConfig\n",
+			PodAnnotations: map[string]string{"operator.wasp.io/startupPolicy": "{}"},
+		}
+		args.NamespacedArgs.Namespace = "wasp"
+		objects := createDaemonSet(args)
+		Expect(objects).To(HaveLen(2))
+		Expect(objects[0].(*appsv1.DaemonSet).Spec.Template.Annotations).To(HaveKeyWithValue("operator.wasp.io/startupPolicy", "{}"))
+		configMap := objects[1].(*corev1.ConfigMap)
+		Expect(configMap.Name).To(Equal(AgentConfigMapName))
+		Expect(configMap.Namespace).To(Equal("wasp"))
+		Expect(configMap.Data).To(HaveKeyWithValue("config.yaml", args.AgentConfig))
+	})
+})
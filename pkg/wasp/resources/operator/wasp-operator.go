@@ -0,0 +1,248 @@
+package operator
+
+import (
+	utils2 "github.com/openshift-virtualization/wasp-agent/pkg/util"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	operatorName            = "wasp-operator"
+	operatorClusterRoleName = operatorName + "-cluster"
+)
+
+// getOperatorClusterPolicyRules returns the rules of wasp-operator: managing the WaspAgent CR and the objects it
+// owns, plus the rules of wasp-agent and wasp-webhook themselves, which it must hold to grant them
+func getOperatorClusterPolicyRules() []rbacv1.PolicyRule {
+	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{
+				"wasp.io",
+			},
+			Resources: []string{
+				"waspagents",
+				"waspagents/status",
+				"waspagents/finalizers",
+			},
+			Verbs: []string{
+				"*",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"serviceaccounts",
+				"services",
+				"configmaps",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"update",
+				"delete",
+			},
+		},
+		{
+			APIGroups: []string{
+				"apps",
+			},
+			Resources: []string{
+				"daemonsets",
+				"deployments",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"update",
+				"delete",
+			},
+		},
+		{
+			APIGroups: []string{
+				"rbac.authorization.k8s.io",
+			},
+			Resources: []string{
+				"clusterroles",
+				"clusterrolebindings",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"update",
+				"delete",
+			},
+		},
+		{
+			APIGroups: []string{
+				"security.openshift.io",
+			},
+			Resources: []string{
+				"securitycontextconstraints",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"update",
+				"delete",
+			},
+		},
+		{
+			APIGroups: []string{
+				"monitoring.coreos.com",
+			},
+			Resources: []string{
+				"prometheusrules",
+				"servicemonitors",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"update",
+				"delete",
+			},
+		},
+		{
+			APIGroups: []string{
+				"admissionregistration.k8s.io",
+			},
+			Resources: []string{
+				"validatingadmissionpolicies",
+				"validatingadmissionpolicybindings",
+				"mutatingwebhookconfigurations",
+				"validatingwebhookconfigurations",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"update",
+				"patch",
+				"delete",
+			},
+		},
+		{
+			APIGroups: []string{
+				"cert-manager.io",
+			},
+			Resources: []string{
+				"issuers",
+				"certificates",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"update",
+				"patch",
+				"delete",
+			},
+		},
+		{
+			APIGroups: []string{
+				"coordination.k8s.io",
+			},
+			Resources: []string{
+				"leases",
+			},
+			Verbs: []string{
+				"get",
+				"create",
+				"update",
+			},
+		},
+	}
+	rules = append(rules, getClusterPolicyRules()...)
+	return append(rules, getWebhookClusterPolicyRules()...)
+}
+
+func createOperatorRBAC(args *FactoryArgs) []client.Object {
+	return []client.Object{
+		utils2.ResourceBuilder.CreateOperatorServiceAccount(utils2.WaspOperatorServiceAccountName, args.NamespacedArgs.Namespace),
+		utils2.ResourceBuilder.CreateOperatorClusterRole(operatorClusterRoleName, getOperatorClusterPolicyRules()),
+		utils2.ResourceBuilder.CreateOperatorClusterRoleBinding(utils2.WaspOperatorServiceAccountName, operatorClusterRoleName, utils2.WaspOperatorServiceAccountName, args.NamespacedArgs.Namespace),
+	}
+}
+
+func createOperator(args *FactoryArgs) []client.Object {
+	return []client.Object{
+		createOperatorDeployment(args),
+	}
+}
+
+func createOperatorEnvVar(args *FactoryArgs) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name:  "OPERATOR_VERSION",
+			Value: args.NamespacedArgs.OperatorVersion,
+		},
+		{
+			Name:  "WASP_IMAGE",
+			Value: args.Image,
+		},
+		{
+			Name:  "VERBOSITY",
+			Value: args.NamespacedArgs.Verbosity,
+		},
+		{
+			Name:  "PULL_POLICY",
+			Value: args.NamespacedArgs.PullPolicy,
+		},
+		{
+			Name: "OPERATOR_NAMESPACE",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: "metadata.namespace",
+				},
+			},
+		},
+	}
+}
+
+func createOperatorDeployment(args *FactoryArgs) *appsv1.Deployment {
+	container := corev1.Container{
+		Name:            operatorName,
+		Image:           args.Image,
+		ImagePullPolicy: corev1.PullPolicy(args.NamespacedArgs.PullPolicy),
+		Command:         []string{"/app/wasp-operator"},
+		Env:             createOperatorEnvVar(args),
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("150Mi"),
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: boolPtr(false),
+			RunAsNonRoot:             boolPtr(true),
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+			},
+			SeccompProfile: &corev1.SeccompProfile{
+				Type: corev1.SeccompProfileTypeRuntimeDefault,
+			},
+		},
+	}
+	podSpec := corev1.PodSpec{
+		Containers:        []corev1.Container{container},
+		PriorityClassName: "system-cluster-critical",
+	}
+	return utils2.ResourceBuilder.CreateOperatorDeployment(operatorName, args.NamespacedArgs.Namespace, "name", operatorName, utils2.WaspOperatorServiceAccountName, 1, podSpec)
+}
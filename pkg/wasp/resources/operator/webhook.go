@@ -0,0 +1,337 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	utils2 "github.com/openshift-virtualization/wasp-agent/pkg/util"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	webhookName           = "wasp-webhook"
+	webhookCertSecretName = webhookName + "-certs"
+	webhookPortName       = "webhook"
+	webhookHealthPortName = "health"
+	// WebhookOptOutLabel keeps the pods of the namespaces labelled with WebhookOptOutLabel=disabled away from the webhook
+	WebhookOptOutLabel = "wasp.io/swap-policy-webhook"
+)
+
+// createWebhook creates the optional wasp-webhook, which stamps the swap policy annotations on pods at admission and
+// rejects contradictory ones. It fails open, a pod is admitted as is when the webhook is unavailable. Its serving
+// certificate is issued by the service CA on OpenShift, and by cert-manager on Kubernetes.
+func createWebhook(args *FactoryArgs) []client.Object {
+	if args.NamespacedArgs.DeployWebhook != "true" {
+		return nil
+	}
+	namespace := args.NamespacedArgs.Namespace
+	objects := []client.Object{
+		utils2.ResourceBuilder.CreateOperatorServiceAccount(webhookName, namespace),
+		utils2.ResourceBuilder.CreateOperatorClusterRole(webhookName, getWebhookClusterPolicyRules()),
+		utils2.ResourceBuilder.CreateOperatorClusterRoleBinding(webhookName, webhookName, webhookName, namespace),
+		createWebhookService(args),
+		createWebhookDeployment(args),
+		createMutatingWebhookConfiguration(args),
+		createValidatingWebhookConfiguration(args),
+	}
+	if !isOpenShift(args) {
+		objects = append(objects, createWebhookIssuer(namespace), createWebhookCertificate(namespace))
+	}
+	return objects
+}
+
+// getWebhookClusterPolicyRules returns the rules of wasp-webhook, which reads the defaults set on the namespaces
+func getWebhookClusterPolicyRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"namespaces",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+			},
+		},
+	}
+}
+
+func createWebhookService(args *FactoryArgs) *corev1.Service {
+	service := utils2.ResourceBuilder.CreateService(webhookName, "name", webhookName, nil)
+	service.Namespace = args.NamespacedArgs.Namespace
+	if isOpenShift(args) {
+		service.Annotations = map[string]string{
+			"service.beta.openshift.io/serving-cert-secret-name": webhookCertSecretName,
+		}
+	}
+	service.Spec.Ports = []corev1.ServicePort{
+		{
+			Name:       webhookPortName,
+			Port:       443,
+			TargetPort: intstr.FromString(webhookPortName),
+			Protocol:   corev1.ProtocolTCP,
+		},
+	}
+	return service
+}
+
+func createWebhookDeployment(args *FactoryArgs) *appsv1.Deployment {
+	container := corev1.Container{
+		Name:            webhookName,
+		Image:           args.Image,
+		ImagePullPolicy: corev1.PullPolicy(args.NamespacedArgs.PullPolicy),
+		Command:         []string{"/app/wasp-webhook"},
+		Args:            []string{"-v", args.NamespacedArgs.Verbosity},
+		Env: []corev1.EnvVar{
+			{
+				Name:  "SWAP_DISABLED_PRIORITY_CLASSES",
+				Value: strings.Join(args.SwapDisabledPriorityClasses, ","),
+			},
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          webhookPortName,
+				ContainerPort: utils2.WebhookPort,
+				Protocol:      corev1.ProtocolTCP,
+			},
+			{
+				Name:          webhookHealthPortName,
+				ContainerPort: utils2.WebhookHealthPort,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+		LivenessProbe:  createWebhookProbe(utils2.LivenessPath),
+		ReadinessProbe: createWebhookProbe(utils2.ReadinessPath),
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("50Mi"),
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: boolPtr(false),
+			RunAsNonRoot:             boolPtr(true),
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+			},
+			SeccompProfile: &corev1.SeccompProfile{
+				Type: corev1.SeccompProfileTypeRuntimeDefault,
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "certs",
+				MountPath: utils2.WebhookCertDir,
+				ReadOnly:  true,
+			},
+		},
+	}
+	podSpec := corev1.PodSpec{
+		Containers:        []corev1.Container{container},
+		PriorityClassName: "system-cluster-critical",
+		Volumes: []corev1.Volume{
+			{
+				Name: "certs",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: webhookCertSecretName,
+					},
+				},
+			},
+		},
+	}
+	return utils2.ResourceBuilder.CreateOperatorDeployment(webhookName, args.NamespacedArgs.Namespace, "name", webhookName, webhookName, 2, podSpec)
+}
+
+func createWebhookProbe(path string) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromString(webhookHealthPortName),
+			},
+		},
+		PeriodSeconds: 10,
+	}
+}
+
+func createMutatingWebhookConfiguration(args *FactoryArgs) *admissionregistrationv1.MutatingWebhookConfiguration {
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionregistrationv1.SchemeGroupVersion.String(),
+			Kind:       "MutatingWebhookConfiguration",
+		},
+		ObjectMeta: webhookConfigurationMeta(args),
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{
+				Name:                    "mutate-pods.wasp.io",
+				ClientConfig:            webhookClientConfig(args.NamespacedArgs.Namespace, utils2.WebhookMutatePath),
+				Rules:                   podRules(admissionregistrationv1.Create),
+				FailurePolicy:           failurePolicyPtr(admissionregistrationv1.Ignore),
+				SideEffects:             sideEffectsPtr(admissionregistrationv1.SideEffectClassNone),
+				NamespaceSelector:       webhookNamespaceSelector(args.NamespacedArgs.Namespace),
+				MatchConditions:         webhookMatchConditions(),
+				AdmissionReviewVersions: []string{"v1"},
+				TimeoutSeconds:          int32Ptr(5),
+			},
+		},
+	}
+}
+
+func createValidatingWebhookConfiguration(args *FactoryArgs) *admissionregistrationv1.ValidatingWebhookConfiguration {
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionregistrationv1.SchemeGroupVersion.String(),
+			Kind:       "ValidatingWebhookConfiguration",
+		},
+		ObjectMeta: webhookConfigurationMeta(args),
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name:                    "validate-pods.wasp.io",
+				ClientConfig:            webhookClientConfig(args.NamespacedArgs.Namespace, utils2.WebhookValidatePath),
+				Rules:                   podRules(admissionregistrationv1.Create, admissionregistrationv1.Update),
+				FailurePolicy:           failurePolicyPtr(admissionregistrationv1.Ignore),
+				SideEffects:             sideEffectsPtr(admissionregistrationv1.SideEffectClassNone),
+				NamespaceSelector:       webhookNamespaceSelector(args.NamespacedArgs.Namespace),
+				MatchConditions:         webhookMatchConditions(),
+				AdmissionReviewVersions: []string{"v1"},
+				TimeoutSeconds:          int32Ptr(5),
+			},
+		},
+	}
+}
+
+// webhookConfigurationMeta asks the service CA or cert-manager to inject the CA of the serving certificate
+func webhookConfigurationMeta(args *FactoryArgs) metav1.ObjectMeta {
+	annotations := map[string]string{
+		"cert-manager.io/inject-ca-from": fmt.Sprintf("%s/%s", args.NamespacedArgs.Namespace, webhookName),
+	}
+	if isOpenShift(args) {
+		annotations = map[string]string{
+			"service.beta.openshift.io/inject-cabundle": "true",
+		}
+	}
+	return metav1.ObjectMeta{
+		Name:        webhookName,
+		Labels:      utils2.ResourceBuilder.WithCommonLabels(nil),
+		Annotations: annotations,
+	}
+}
+
+func webhookClientConfig(namespace, path string) admissionregistrationv1.WebhookClientConfig {
+	return admissionregistrationv1.WebhookClientConfig{
+		Service: &admissionregistrationv1.ServiceReference{
+			Namespace: namespace,
+			Name:      webhookName,
+			Path:      &path,
+			Port:      int32Ptr(443),
+		},
+	}
+}
+
+func podRules(operations ...admissionregistrationv1.OperationType) []admissionregistrationv1.RuleWithOperations {
+	scope := admissionregistrationv1.NamespacedScope
+	return []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: operations,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"pods"},
+				Scope:       &scope,
+			},
+		},
+	}
+}
+
+// webhookNamespaceSelector skips the namespace of wasp, kube-system and the namespaces opting out
+func webhookNamespaceSelector(namespace string) *metav1.LabelSelector {
+	return &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{
+				Key:      corev1.LabelMetadataName,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{namespace, metav1.NamespaceSystem},
+			},
+			{
+				Key:      WebhookOptOutLabel,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{"disabled"},
+			},
+		},
+	}
+}
+
+// webhookMatchConditions skips the openshift-* namespaces, which a label selector can't match by prefix
+func webhookMatchConditions() []admissionregistrationv1.MatchCondition {
+	return []admissionregistrationv1.MatchCondition{
+		{
+			Name:       "exclude-openshift-namespaces",
+			Expression: `!request.namespace.startsWith("openshift-")`,
+		},
+	}
+}
+
+// createWebhookIssuer creates the self-signed cert-manager issuer of the serving certificate. The cert-manager
+// objects are built as unstructured objects, since the cert-manager API isn't vendored.
+func createWebhookIssuer(namespace string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Issuer",
+		"metadata": map[string]interface{}{
+			"name":      webhookName,
+			"namespace": namespace,
+			"labels":    labelsMap(),
+		},
+		"spec": map[string]interface{}{
+			"selfSigned": map[string]interface{}{},
+		},
+	}}
+}
+
+func createWebhookCertificate(namespace string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"metadata": map[string]interface{}{
+			"name":      webhookName,
+			"namespace": namespace,
+			"labels":    labelsMap(),
+		},
+		"spec": map[string]interface{}{
+			"secretName": webhookCertSecretName,
+			"dnsNames": []interface{}{
+				fmt.Sprintf("%s.%s.svc", webhookName, namespace),
+				fmt.Sprintf("%s.%s.svc.cluster.local", webhookName, namespace),
+			},
+			"issuerRef": map[string]interface{}{
+				"kind": "Issuer",
+				"name": webhookName,
+			},
+		},
+	}}
+}
+
+func failurePolicyPtr(policy admissionregistrationv1.FailurePolicyType) *admissionregistrationv1.FailurePolicyType {
+	return &policy
+}
+
+func sideEffectsPtr(sideEffects admissionregistrationv1.SideEffectClass) *admissionregistrationv1.SideEffectClass {
+	return &sideEffects
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
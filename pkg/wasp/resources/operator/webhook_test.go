@@ -0,0 +1,33 @@
+package operator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Webhook", func() {
+	args := &FactoryArgs{}
+	args.NamespacedArgs.Namespace = "wasp"
+
+	It("should skip the namespace of wasp and kube-system", func() {
+		for _, selector := range []*metav1.LabelSelector{
+			createMutatingWebhookConfiguration(args).Webhooks[0].NamespaceSelector,
+			createValidatingWebhookConfiguration(args).Webhooks[0].NamespaceSelector,
+		} {
+			Expect(selector.MatchExpressions).To(ContainElement(metav1.LabelSelectorRequirement{
+				Key:      corev1.LabelMetadataName,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{"wasp", "kube-system"},
+			}))
+		}
+	})
+
+	It("should skip the openshift-* namespaces", func() {
+		mutating := createMutatingWebhookConfiguration(args).Webhooks[0].MatchConditions
+		validating := createValidatingWebhookConfiguration(args).Webhooks[0].MatchConditions
+		Expect(mutating).To(Equal(validating))
+		Expect(mutating).To(ConsistOf(HaveField("Expression", `!request.namespace.startsWith("openshift-")`)))
+	})
+})
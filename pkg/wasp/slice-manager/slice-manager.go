@@ -0,0 +1,410 @@
+package slice_manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/openshift-virtualization/wasp-agent/pkg/client"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/cgroup"
+	"github.com/openshift-virtualization/wasp-agent/pkg/wasp/swap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// SliceSettingsAnnotation reports on the node the settings applied to the system and kubepods slices
+	SliceSettingsAnnotation = "wasp.io/slice-settings"
+
+	SystemSlice   = "system.slice"
+	KubepodsSlice = "kubepods.slice"
+
+	subtreeControlFile = "cgroup.subtree_control"
+
+	enforceInterval = 30 * time.Second
+)
+
+// Options configures the settings enforced on the system and kubepods slices, zero values leave a setting untouched
+type Options struct {
+	// DisableSystemSliceSwap sets memory.swap.max of system.slice to 0
+	DisableSystemSliceSwap bool
+	// SystemSliceIOLatencyTarget and KubepodsSliceIOLatencyTarget are the io.latency targets on the swap disks
+	SystemSliceIOLatencyTarget   time.Duration
+	KubepodsSliceIOLatencyTarget time.Duration
+	// SystemSliceIOWeight and KubepodsSliceIOWeight are the io.weight on the swap disks, between 1 and 10000
+	SystemSliceIOWeight   uint64
+	KubepodsSliceIOWeight uint64
+}
+
+func (o Options) ioEnabled() bool {
+	return o.SystemSliceIOLatencyTarget > 0 || o.KubepodsSliceIOLatencyTarget > 0 ||
+		o.SystemSliceIOWeight > 0 || o.KubepodsSliceIOWeight > 0
+}
+
+// setting is a single value written to a cgroup file, e.g. "8:0 target=10000" to system.slice/io.latency. The
+// slice of the settings of the cgroup root is empty.
+type setting struct {
+	slice string
+	file  string
+	value string
+}
+
+// ioControllerSetting reports that wasp enabled the io controller on the cgroup root
+var ioControllerSetting = setting{file: subtreeControlFile, value: "+io"}
+
+func (s setting) key() string {
+	if s.slice == "" {
+		return s.file
+	}
+	return s.slice + "/" + s.file
+}
+
+// defaultValue returns the value that reverts the setting to the default of the kernel
+func (s setting) defaultValue() string {
+	switch s.file {
+	case "memory.swap.max":
+		return "max"
+	case "io.latency":
+		return strings.Fields(s.value)[0] + " target=0"
+	case "io.weight":
+		return strings.Fields(s.value)[0] + " default"
+	case subtreeControlFile:
+		return "-io"
+	}
+	return ""
+}
+
+// SliceManager continuously enforces the swap and IO settings of the system and kubepods slices, and reports the
+// settings that are applied in an annotation of the node. The settings reported before, that aren't desired anymore,
+// are reverted to their defaults.
+type SliceManager struct {
+	waspCli  client.WaspClient
+	nodeName string
+	options  Options
+	// pendingOptions replace the options on the next enforcement
+	pendingOptions atomic.Pointer[Options]
+	// reported is nil until the settings reported by a previous run are read from the node
+	reported map[string]string
+	stop     <-chan struct{}
+}
+
+func NewSliceManager(waspCli client.WaspClient,
+	nodeName string,
+	options Options,
+	stop <-chan struct{},
+) *SliceManager {
+	return &SliceManager{
+		waspCli:  waspCli,
+		nodeName: nodeName,
+		options:  options,
+		stop:     stop,
+	}
+}
+
+func (sm *SliceManager) Run() {
+	defer utilruntime.HandleCrash()
+	log.Log.Infof("Starting SliceManager")
+	defer log.Log.Infof("Shutting down SliceManager")
+
+	// returns once stopped and done with the current iteration
+	wait.Until(sm.enforce, enforceInterval, sm.stop)
+}
+
+// SetOptions replaces the settings enforced on the slices, the settings that aren't desired anymore are reverted on
+// the next enforcement
+func (sm *SliceManager) SetOptions(options Options) {
+	sm.pendingOptions.Store(&options)
+}
+
+// applyOptions applies the options set since the last enforcement
+func (sm *SliceManager) applyOptions() {
+	options := sm.pendingOptions.Swap(nil)
+	if options == nil || *options == sm.options {
+		return
+	}
+	log.Log.Infof("SliceManager: options changed from %+v to %+v", sm.options, *options)
+	sm.options = *options
+}
+
+func (sm *SliceManager) enforce() {
+	sm.applyOptions()
+	if sm.reported == nil {
+		reported, err := sm.readReported()
+		if err != nil {
+			log.Log.Errorf("SliceManager: failed to read the slice settings of node %v: %v", sm.nodeName, err)
+			return
+		}
+		sm.reported = reported
+	}
+	previous := reportedSettings(sm.reported)
+
+	var disks []string
+	ioControllerEnabled := false
+	if sm.options.ioEnabled() {
+		var err error
+		disks, err = swapDisks()
+		if err != nil {
+			log.Log.Errorf("SliceManager: failed to find the swap disks: %v", err)
+		}
+		ioControllerEnabled, err = enableIOController()
+		if err != nil {
+			log.Log.Errorf("SliceManager: failed to enable the io controller: %v", err)
+		}
+	}
+
+	applied := make(map[string]string)
+	desired := desiredSettings(sm.options, disks)
+	for _, s := range desired {
+		dirPath := filepath.Join(cgroup.CgroupPathBase, s.slice)
+		changed, err := ensure(dirPath, s.file, s.value)
+		if err != nil {
+			log.Log.Errorf("SliceManager: failed to set %v of %v to %q: %v", s.file, s.slice, s.value, err)
+			continue
+		}
+		if changed {
+			log.Log.Infof("SliceManager: set %v of %v to %q", s.file, s.slice, s.value)
+		}
+		addSetting(applied, s)
+	}
+	// the io controller is only disabled again when wasp enabled it
+	if sm.options.ioEnabled() && (ioControllerEnabled || containsSetting(previous, ioControllerSetting)) {
+		desired = append(desired, ioControllerSetting)
+		addSetting(applied, ioControllerSetting)
+	}
+
+	for _, s := range staleSettings(previous, desired) {
+		reverted, err := revert(s)
+		if err != nil {
+			log.Log.Errorf("SliceManager: failed to revert %v of %v to %q: %v", s.file, s.slice, s.defaultValue(), err)
+			// retried on the next enforcement
+			addSetting(applied, s)
+			continue
+		}
+		if reverted {
+			log.Log.Infof("SliceManager: reverted %v of %v to %q", s.file, s.slice, s.defaultValue())
+		}
+	}
+
+	if err := sm.report(applied); err != nil {
+		log.Log.Errorf("SliceManager: failed to report the slice settings on node %v: %v", sm.nodeName, err)
+	}
+}
+
+func addSetting(applied map[string]string, s setting) {
+	if applied[s.key()] != "" {
+		applied[s.key()] += ", "
+	}
+	applied[s.key()] += s.value
+}
+
+// reportedSettings parses the settings of the annotation of the node
+func reportedSettings(reported map[string]string) []setting {
+	var settings []setting
+	for key, values := range reported {
+		slice, file := "", key
+		if i := strings.LastIndex(key, "/"); i >= 0 {
+			slice, file = key[:i], key[i+1:]
+		}
+		for _, value := range strings.Split(values, ", ") {
+			settings = append(settings, setting{slice: slice, file: file, value: value})
+		}
+	}
+	return settings
+}
+
+// staleSettings returns the previous settings that aren't desired anymore, the io controller is disabled last
+func staleSettings(previous, desired []setting) []setting {
+	var stale []setting
+	for _, s := range previous {
+		if !containsSetting(desired, s) && s.defaultValue() != "" {
+			stale = append(stale, s)
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		return stale[i].file != subtreeControlFile && stale[j].file == subtreeControlFile
+	})
+	return stale
+}
+
+// revert writes the default value of a setting, unless the cgroup file doesn't hold the setting anymore, e.g. because
+// the swap disk went away
+func revert(s setting) (bool, error) {
+	dirPath := filepath.Join(cgroup.CgroupPathBase, s.slice)
+	content, err := cgroups.ReadFile(dirPath, s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !holdsSetting(content, s) {
+		return false, nil
+	}
+	return true, cgroups.WriteFile(dirPath, s.file, s.defaultValue())
+}
+
+// holdsSetting tells whether the content of a cgroup file holds the setting
+func holdsSetting(content string, s setting) bool {
+	if s.file == subtreeControlFile {
+		for _, controller := range strings.Fields(content) {
+			if "+"+controller == s.value {
+				return true
+			}
+		}
+		return false
+	}
+	return holdsValue(content, s.value)
+}
+
+func containsSetting(settings []setting, s setting) bool {
+	for _, candidate := range settings {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+// desiredSettings returns the settings to enforce, io settings are applied to each of the swap disks
+func desiredSettings(options Options, disks []string) []setting {
+	var settings []setting
+	if options.DisableSystemSliceSwap {
+		settings = append(settings, setting{slice: SystemSlice, file: "memory.swap.max", value: "0"})
+	}
+	for _, disk := range disks {
+		if options.SystemSliceIOLatencyTarget > 0 {
+			settings = append(settings, ioLatency(SystemSlice, disk, options.SystemSliceIOLatencyTarget))
+		}
+		if options.KubepodsSliceIOLatencyTarget > 0 {
+			settings = append(settings, ioLatency(KubepodsSlice, disk, options.KubepodsSliceIOLatencyTarget))
+		}
+		if options.SystemSliceIOWeight > 0 {
+			settings = append(settings, setting{slice: SystemSlice, file: "io.weight", value: fmt.Sprintf("%s %d", disk, options.SystemSliceIOWeight)})
+		}
+		if options.KubepodsSliceIOWeight > 0 {
+			settings = append(settings, setting{slice: KubepodsSlice, file: "io.weight", value: fmt.Sprintf("%s %d", disk, options.KubepodsSliceIOWeight)})
+		}
+	}
+	return settings
+}
+
+func ioLatency(slice, disk string, target time.Duration) setting {
+	return setting{slice: slice, file: "io.latency", value: fmt.Sprintf("%s target=%d", disk, target.Microseconds())}
+}
+
+// ensure writes the value unless the cgroup file already holds it. Files such as io.latency hold a line per disk,
+// so the value is looked up among the lines of the file.
+func ensure(dirPath, file, value string) (bool, error) {
+	content, err := cgroups.ReadFile(dirPath, file)
+	if err != nil {
+		return false, err
+	}
+	if holdsValue(content, value) {
+		return false, nil
+	}
+	return true, cgroups.WriteFile(dirPath, file, value)
+}
+
+func holdsValue(content, value string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// swapDisks returns the disks backing the active swap areas
+func swapDisks() ([]string, error) {
+	devices, err := swap.ReadSwaps()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	var disks []string
+	for _, device := range devices {
+		disk, err := device.BlockDevice()
+		if err != nil {
+			return nil, err
+		}
+		if !found[disk] {
+			found[disk] = true
+			disks = append(disks, disk)
+		}
+	}
+	sort.Strings(disks)
+	return disks, nil
+}
+
+// enableIOController makes the io controller available to the slices under the cgroup root, and reports whether it
+// had to be enabled
+func enableIOController() (bool, error) {
+	content, err := cgroups.ReadFile(cgroup.CgroupPathBase, subtreeControlFile)
+	if err != nil {
+		return false, err
+	}
+	for _, controller := range strings.Fields(content) {
+		if controller == "io" {
+			return false, nil
+		}
+	}
+	if err := cgroups.WriteFile(cgroup.CgroupPathBase, subtreeControlFile, "+io"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readReported reads the settings reported on the node by a previous run
+func (sm *SliceManager) readReported() (map[string]string, error) {
+	node, err := sm.waspCli.CoreV1().Nodes().Get(context.Background(), sm.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	reported := make(map[string]string)
+	value, ok := node.Annotations[SliceSettingsAnnotation]
+	if !ok {
+		return reported, nil
+	}
+	if err := json.Unmarshal([]byte(value), &reported); err != nil {
+		log.Log.Errorf("SliceManager: ignoring the invalid slice settings of node %v: %v", sm.nodeName, err)
+		return make(map[string]string), nil
+	}
+	return reported, nil
+}
+
+// report annotates the node with the applied settings when they change
+func (sm *SliceManager) report(applied map[string]string) error {
+	if reflect.DeepEqual(sm.reported, applied) {
+		return nil
+	}
+	value, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				SliceSettingsAnnotation: string(value),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = sm.waspCli.CoreV1().Nodes().Patch(context.Background(), sm.nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	sm.reported = applied
+	return nil
+}
@@ -0,0 +1,13 @@
+package slice_manager
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSliceManager(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SliceManager Suite")
+}
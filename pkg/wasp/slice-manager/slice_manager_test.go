@@ -0,0 +1,73 @@
+package slice_manager
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Slice manager", func() {
+	It("should return the settings to enforce for each swap disk", func() {
+		settings := desiredSettings(Options{
+			DisableSystemSliceSwap:       true,
+			SystemSliceIOLatencyTarget:   10 * time.Millisecond,
+			KubepodsSliceIOLatencyTarget: 50 * time.Millisecond,
+			KubepodsSliceIOWeight:        50,
+		}, []string{"8:0"})
+		Expect(settings).To(Equal([]setting{
+			{slice: SystemSlice, file: "memory.swap.max", value: "0"},
+			{slice: SystemSlice, file: "io.latency", value: "8:0 target=10000"},
+			{slice: KubepodsSlice, file: "io.latency", value: "8:0 target=50000"},
+			{slice: KubepodsSlice, file: "io.weight", value: "8:0 50"},
+		}))
+	})
+
+	It("should apply the options set since the last enforcement", func() {
+		sm := NewSliceManager(nil, "node", Options{SystemSliceIOWeight: 50}, nil)
+		sm.applyOptions()
+		Expect(sm.options).To(Equal(Options{SystemSliceIOWeight: 50}))
+
+		sm.SetOptions(Options{DisableSystemSliceSwap: true})
+		sm.applyOptions()
+		Expect(sm.options).To(Equal(Options{DisableSystemSliceSwap: true}))
+	})
+
+	It("should leave the slices untouched by default", func() {
+		Expect(desiredSettings(Options{}, []string{"8:0"})).To(BeEmpty())
+	})
+
+	It("should revert the settings that aren't desired anymore", func() {
+		previous := reportedSettings(map[string]string{
+			"system.slice/memory.swap.max": "0",
+			"system.slice/io.latency":      "8:0 target=10000, 8:16 target=10000",
+			"kubepods.slice/io.weight":     "8:16 50",
+			"cgroup.subtree_control":       "+io",
+		})
+		desired := []setting{
+			{slice: SystemSlice, file: "io.latency", value: "8:0 target=10000"},
+		}
+		stale := staleSettings(previous, desired)
+		Expect(stale).To(HaveLen(4))
+		Expect(stale[3]).To(Equal(ioControllerSetting))
+		var defaults []string
+		for _, s := range stale {
+			defaults = append(defaults, s.key()+": "+s.defaultValue())
+		}
+		Expect(defaults).To(ConsistOf(
+			"system.slice/memory.swap.max: max",
+			"system.slice/io.latency: 8:16 target=0",
+			"kubepods.slice/io.weight: 8:16 default",
+			"cgroup.subtree_control: -io",
+		))
+	})
+
+	DescribeTable("holdsValue", func(content, value string, expected bool) {
+		Expect(holdsValue(content, value)).To(Equal(expected))
+	},
+		Entry("should find a single value", "0\n", "0", true),
+		Entry("should find the value of a disk", "default 100\n8:0 50\n", "8:0 50", true),
+		Entry("should detect a different value", "default 100\n8:0 50\n", "8:0 200", false),
+		Entry("should detect a missing disk", "", "8:0 target=10000", false),
+	)
+})
@@ -0,0 +1,198 @@
+package swap
+
+import (
+	"bufio"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Encryption tells how the pages written to a swap area are protected at rest
+type Encryption string
+
+const (
+	// EncryptionDMCrypt is a swap area on a dm-crypt device, e.g. LUKS, whose key persists across reboots
+	EncryptionDMCrypt Encryption = "dm-crypt"
+	// EncryptionEphemeralKey is a swap area on a dm-crypt device keyed from /dev/urandom on every boot
+	EncryptionEphemeralKey Encryption = "ephemeral-key"
+	// EncryptionInMemory is a zram swap area without a backing device, its pages never reach a disk
+	EncryptionInMemory Encryption = "in-memory"
+	// EncryptionNone is a swap file or partition stored in cleartext
+	EncryptionNone Encryption = "none"
+
+	crypttabPath = hostRootPath + "/etc/crypttab"
+	// dmCryptUUIDPrefix prefixes the device-mapper uuid of dm-crypt devices, e.g. CRYPT-LUKS2-<uuid>-<name>
+	dmCryptUUIDPrefix = "CRYPT-"
+	// dmCryptPlainUUIDPrefix is used by plain dm-crypt devices, which is how swap with a random key is set up
+	dmCryptPlainUUIDPrefix = "CRYPT-PLAIN-"
+)
+
+// Encrypted tells whether the swapped out pages are kept away from the disks in cleartext
+func (e Encryption) Encrypted() bool {
+	return e != EncryptionNone
+}
+
+// Encryption detects how the swap area is encrypted. The block devices stacked under the swap area, e.g. LVM on
+// top of LUKS, are walked through sysfs, and the area is encrypted only if all the devices it relies on are. A zram
+// device writes its idle and incompressible pages to its backing device, if any, so it is only as encrypted as it.
+func (d Device) Encryption() (Encryption, error) {
+	if name := filepath.Base(d.Filename); strings.HasPrefix(name, zramPrefix) {
+		backingDev, err := zramBackingDev(sysBlockPath, name)
+		if err != nil {
+			return "", err
+		}
+		if backingDev == "" {
+			return EncryptionInMemory, nil
+		}
+		return Device{Filename: backingDev, Type: TypePartition}.Encryption()
+	}
+	var stat unix.Stat_t
+	if err := unix.Stat(filepath.Join(hostRootPath, d.Filename), &stat); err != nil {
+		return "", err
+	}
+	dev := stat.Dev
+	if d.Type == TypePartition {
+		dev = stat.Rdev
+	}
+	randomKeyNames, err := readRandomKeyNames()
+	if err != nil {
+		return "", err
+	}
+	disk, err := wholeDisk(fmt.Sprintf("%d:%d", unix.Major(uint64(dev)), unix.Minor(uint64(dev))))
+	if err != nil {
+		return "", err
+	}
+	return stackEncryption(filepath.Join(sysDevBlockPath, disk), randomKeyNames)
+}
+
+// zramBackingDev returns the backing device of a zram device, or an empty string when it has none
+func zramBackingDev(sysBlockPath, name string) (string, error) {
+	backingDev, err := readSysfsValue(filepath.Join(sysBlockPath, name, "backing_dev"))
+	if err != nil || backingDev == "none" {
+		return "", err
+	}
+	return backingDev, nil
+}
+
+func stackEncryption(devPath string, randomKeyNames map[string]bool) (Encryption, error) {
+	uuid, err := readSysfsValue(filepath.Join(devPath, "dm", "uuid"))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(uuid, dmCryptUUIDPrefix) {
+		name, err := readSysfsValue(filepath.Join(devPath, "dm", "name"))
+		if err != nil {
+			return "", err
+		}
+		return dmCryptEncryption(uuid, name, randomKeyNames), nil
+	}
+
+	slaves, err := os.ReadDir(filepath.Join(devPath, "slaves"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if len(slaves) == 0 {
+		return EncryptionNone, nil
+	}
+	var encryptions []Encryption
+	for _, slave := range slaves {
+		encryption, err := stackEncryption(filepath.Join(devPath, "slaves", slave.Name()), randomKeyNames)
+		if err != nil {
+			return "", err
+		}
+		encryptions = append(encryptions, encryption)
+	}
+	return weakest(encryptions), nil
+}
+
+// dmCryptEncryption tells apart the dm-crypt devices with an ephemeral key, either declared as such in the
+// crypttab or set up in plain mode, from those with a persistent key
+func dmCryptEncryption(uuid, name string, randomKeyNames map[string]bool) Encryption {
+	if randomKeyNames[name] || strings.HasPrefix(uuid, dmCryptPlainUUIDPrefix) {
+		return EncryptionEphemeralKey
+	}
+	return EncryptionDMCrypt
+}
+
+// weakest returns the least protective of the encryptions of the devices backing a swap area
+func weakest(encryptions []Encryption) Encryption {
+	rank := map[Encryption]int{
+		EncryptionNone:         0,
+		EncryptionDMCrypt:      1,
+		EncryptionEphemeralKey: 2,
+		EncryptionInMemory:     3,
+	}
+	result := EncryptionInMemory
+	for _, encryption := range encryptions {
+		if rank[encryption] < rank[result] {
+			result = encryption
+		}
+	}
+	return result
+}
+
+// readRandomKeyNames returns the names of the crypttab devices keyed from /dev/urandom or /dev/random
+func readRandomKeyNames() (map[string]bool, error) {
+	file, err := os.Open(crypttabPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseCrypttab(bufio.NewScanner(file))
+}
+
+// parseCrypttab parses "name device key options" lines, e.g. "swap /dev/sda2 /dev/urandom swap,cipher=aes-xts-plain64"
+func parseCrypttab(scanner *bufio.Scanner) (map[string]bool, error) {
+	names := make(map[string]bool)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[2] == "/dev/urandom" || fields[2] == "/dev/random" {
+			names[fields[0]] = true
+		}
+	}
+	return names, scanner.Err()
+}
+
+func readSysfsValue(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// ReadEncryptions returns the encryption of each of the active swap areas, by filename
+func ReadEncryptions() (map[string]Encryption, error) {
+	devices, err := ReadSwaps()
+	if err != nil {
+		return nil, err
+	}
+	encryptions := make(map[string]Encryption, len(devices))
+	for _, device := range devices {
+		encryption, err := device.Encryption()
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect the encryption of swap %v: %v", device.Filename, err)
+		}
+		encryptions[device.Filename] = encryption
+	}
+	return encryptions, nil
+}
+
+// AllEncrypted tells whether none of the swap areas stores pages in cleartext
+func AllEncrypted(encryptions map[string]Encryption) bool {
+	for _, encryption := range encryptions {
+		if !encryption.Encrypted() {
+			return false
+		}
+	}
+	return true
+}
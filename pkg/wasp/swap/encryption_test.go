@@ -0,0 +1,82 @@
+package swap
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Swap encryption", func() {
+	var sysfs string
+
+	// addDevice creates the sysfs directory of a block device, with its device-mapper uuid and name when set
+	addDevice := func(path, uuid, name string) string {
+		devPath := filepath.Join(sysfs, path)
+		Expect(os.MkdirAll(devPath, 0755)).To(Succeed())
+		if uuid != "" {
+			Expect(os.MkdirAll(filepath.Join(devPath, "dm"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(devPath, "dm", "uuid"), []byte(uuid+"\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(devPath, "dm", "name"), []byte(name+"\n"), 0644)).To(Succeed())
+		}
+		return devPath
+	}
+
+	BeforeEach(func() {
+		sysfs = GinkgoT().TempDir()
+	})
+
+	It("should report a plain disk as unencrypted", func() {
+		devPath := addDevice("sda", "", "")
+		Expect(stackEncryption(devPath, nil)).To(Equal(EncryptionNone))
+	})
+
+	It("should report a LUKS device as dm-crypt", func() {
+		devPath := addDevice("dm-0", "CRYPT-LUKS2-0123-luks-0123", "luks-0123")
+		Expect(stackEncryption(devPath, nil)).To(Equal(EncryptionDMCrypt))
+	})
+
+	It("should report a device keyed from /dev/urandom in the crypttab as ephemeral", func() {
+		devPath := addDevice("dm-0", "CRYPT-LUKS2-0123-swap", "swap")
+		Expect(stackEncryption(devPath, map[string]bool{"swap": true})).To(Equal(EncryptionEphemeralKey))
+	})
+
+	It("should report a plain dm-crypt device as ephemeral", func() {
+		devPath := addDevice("dm-0", "CRYPT-PLAIN-swap", "swap")
+		Expect(stackEncryption(devPath, nil)).To(Equal(EncryptionEphemeralKey))
+	})
+
+	It("should find the encryption below a logical volume", func() {
+		devPath := addDevice("dm-1", "LVM-abcd", "vg-swap")
+		addDevice("dm-1/slaves/dm-0", "CRYPT-LUKS2-0123-luks-0123", "luks-0123")
+		Expect(stackEncryption(devPath, nil)).To(Equal(EncryptionDMCrypt))
+	})
+
+	It("should report a volume spanning an unencrypted disk as unencrypted", func() {
+		devPath := addDevice("dm-1", "LVM-abcd", "vg-swap")
+		addDevice("dm-1/slaves/dm-0", "CRYPT-LUKS2-0123-luks-0123", "luks-0123")
+		addDevice("dm-1/slaves/sdb", "", "")
+		Expect(stackEncryption(devPath, nil)).To(Equal(EncryptionNone))
+	})
+
+	It("should find the backing device of zram", func() {
+		Expect(os.MkdirAll(filepath.Join(sysfs, "zram0"), 0755)).To(Succeed())
+		Expect(zramBackingDev(sysfs, "zram0")).To(BeEmpty())
+		Expect(os.WriteFile(filepath.Join(sysfs, "zram0", "backing_dev"), []byte("none\n"), 0644)).To(Succeed())
+		Expect(zramBackingDev(sysfs, "zram0")).To(BeEmpty())
+		Expect(os.WriteFile(filepath.Join(sysfs, "zram0", "backing_dev"), []byte("/dev/sdb1\n"), 0644)).To(Succeed())
+		Expect(zramBackingDev(sysfs, "zram0")).To(Equal("/dev/sdb1"))
+	})
+
+	It("should parse the devices keyed from a random source in the crypttab", func() {
+		names, err := parseCrypttab(bufio.NewScanner(strings.NewReader(
+			"# name device key options\n" +
+				"swap /dev/sda2 /dev/urandom swap,cipher=aes-xts-plain64\n" +
+				"luks-0123 UUID=0123 none luks\n")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(names).To(Equal(map[string]bool{"swap": true}))
+	})
+})
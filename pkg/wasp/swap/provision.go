@@ -0,0 +1,335 @@
+package swap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const (
+	pageSize = 4 * 1024
+	// swapSignature is written by mkswap at the end of the first page of a swap area
+	swapSignature = "SWAPSPACE2"
+	// minFreeDiskFraction is the share of the filesystem that has to remain free once the swap file is allocated
+	minFreeDiskFraction = 0.1
+)
+
+// unsupportedFilesystems can't hold a swap file, either because the kernel can't swap to them, or because
+// swapping to them would make the node depend on the network or on its own memory
+var unsupportedFilesystems = map[int64]string{
+	unix.OVERLAYFS_SUPER_MAGIC: "overlay",
+	unix.TMPFS_MAGIC:           "tmpfs",
+	unix.NFS_SUPER_MAGIC:       "nfs",
+	unix.CIFS_SUPER_MAGIC:      "cifs",
+	unix.SMB2_SUPER_MAGIC:      "smb2",
+	unix.CEPH_SUPER_MAGIC:      "ceph",
+	unix.FUSE_SUPER_MAGIC:      "fuse",
+	unix.V9FS_MAGIC:            "9p",
+}
+
+// Size describes the size of the swap to provision, exactly one of the fields has to be set
+type Size struct {
+	Bytes uint64
+	// RAMFraction sizes the swap as a fraction of the node memory
+	RAMFraction float64
+	// MemoryOverCommitPercent sizes the swap according to the NODE_SWAP_SPACE formula:
+	// NODE_SWAP_SPACE = NODE_RAM * (MEMORY_OVER_COMMIT_PERCENT / 100% - 1)
+	MemoryOverCommitPercent float64
+}
+
+// Calculate returns the swap size for a node with the given memory, rounded down to a page
+func (s Size) Calculate(nodeMemory uint64) (uint64, error) {
+	set := 0
+	var size uint64
+	if s.Bytes > 0 {
+		set++
+		size = s.Bytes
+	}
+	if s.RAMFraction > 0 {
+		set++
+		size = uint64(float64(nodeMemory) * s.RAMFraction)
+	}
+	if s.MemoryOverCommitPercent > 0 {
+		set++
+		if s.MemoryOverCommitPercent <= 100 {
+			return 0, fmt.Errorf("memory over-commit percent must be above 100, got %v", s.MemoryOverCommitPercent)
+		}
+		size = uint64(float64(nodeMemory) * (s.MemoryOverCommitPercent/100 - 1))
+	}
+	if set != 1 {
+		return 0, fmt.Errorf("exactly one of the swap size, the RAM fraction or the memory over-commit percent must be set")
+	}
+	size = size / pageSize * pageSize
+	if size == 0 {
+		return 0, fmt.Errorf("swap size must be at least a page")
+	}
+	return size, nil
+}
+
+// ProvisionOptions configures the swap area created by the agent
+type ProvisionOptions struct {
+	// Path on the host of the swap file to create, or of the partition to use
+	Path string
+	// Size of the swap file, partitions are used whole
+	Size Size
+	// FormatDevice formats a block device as swap even though it holds a filesystem, a partition table or any other
+	// signature. A block device that is in use is never formatted.
+	FormatDevice bool
+}
+
+// Provision creates, formats and enables the swap area unless it is already active. A block device is used
+// whole, and formatted unless it already holds a swap area, provided it isn't in use and holds no data. Otherwise a
+// swap file is allocated, provided the filesystem supports swap files and has enough free space.
+func Provision(options ProvisionOptions, nodeMemory uint64) error {
+	active, err := isActive(options.Path)
+	if err != nil {
+		return err
+	}
+	if active {
+		log.Log.Infof("Swap %v is already active", options.Path)
+		return nil
+	}
+
+	hostPath := filepath.Join(HostPrefix, options.Path)
+	var stat unix.Stat_t
+	err = unix.Stat(hostPath, &stat)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && stat.Mode&unix.S_IFMT == unix.S_IFBLK {
+		if err := preparePartition(options.Path, stat.Rdev, options.FormatDevice); err != nil {
+			return err
+		}
+	} else {
+		size, err := options.Size.Calculate(nodeMemory)
+		if err != nil {
+			return err
+		}
+		if err := prepareSwapFile(options.Path, size); err != nil {
+			return err
+		}
+	}
+
+	if err := RunOnHost("swapon", options.Path); err != nil {
+		return err
+	}
+	log.Log.Infof("Swap %v enabled", options.Path)
+	return nil
+}
+
+func isActive(path string) (bool, error) {
+	devices, err := ReadSwaps()
+	if err != nil {
+		return false, err
+	}
+	for _, device := range devices {
+		if device.Filename == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func preparePartition(path string, rdev uint64, format bool) error {
+	if err := checkDeviceUnused(path, rdev); err != nil {
+		return err
+	}
+	hasSignature, err := hasSwapSignature(filepath.Join(HostPrefix, path))
+	if err != nil {
+		return err
+	}
+	if hasSignature {
+		return nil
+	}
+	signature, err := deviceSignature(path)
+	if err != nil {
+		return err
+	}
+	if signature != "" && !format {
+		return fmt.Errorf("refusing to format %v as swap, it holds a %v signature", path, signature)
+	}
+	log.Log.Infof("Formatting %v as swap", path)
+	return RunOnHost("mkswap", path)
+}
+
+func prepareSwapFile(path string, size uint64) error {
+	hostPath := filepath.Join(HostPrefix, path)
+	if err := checkFilesystem(filepath.Dir(hostPath), size); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(hostPath)
+	switch {
+	case err == nil && uint64(info.Size()) == size:
+		log.Log.Infof("Reusing swap file %v", path)
+	case err == nil:
+		log.Log.Infof("Re-creating swap file %v of %v bytes with %v bytes", path, info.Size(), size)
+		if err := os.Remove(hostPath); err != nil {
+			return err
+		}
+		fallthrough
+	case os.IsNotExist(err):
+		if err := allocate(hostPath, size); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	return RunOnHost("mkswap", path)
+}
+
+// checkFilesystem makes sure the filesystem of dirPath can hold a swap file of the given size
+func checkFilesystem(dirPath string, size uint64) error {
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(dirPath, &statfs); err != nil {
+		return err
+	}
+	if name, unsupported := unsupportedFilesystems[int64(statfs.Type)]; unsupported {
+		return fmt.Errorf("refusing to create a swap file on %v, it is on a %v filesystem", dirPath, name)
+	}
+	return checkFreeSpace(statfs.Bavail*uint64(statfs.Bsize), statfs.Blocks*uint64(statfs.Bsize), size)
+}
+
+func checkFreeSpace(available, total, size uint64) error {
+	minFree := uint64(float64(total) * minFreeDiskFraction)
+	if available < size+minFree {
+		return fmt.Errorf("not enough free disk space for %v bytes of swap, %v bytes available and %v bytes must remain free", size, available, minFree)
+	}
+	return nil
+}
+
+func allocate(hostPath string, size uint64) error {
+	file, err := os.OpenFile(hostPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := unix.Fallocate(int(file.Fd()), 0, 0, int64(size)); err != nil {
+		os.Remove(hostPath)
+		return fmt.Errorf("failed to allocate %v bytes for %v: %v", size, hostPath, err)
+	}
+	return nil
+}
+
+// hasSwapSignature tells whether the file or device holds a swap area formatted by mkswap
+func hasSwapSignature(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	signature := make([]byte, len(swapSignature))
+	_, err = file.ReadAt(signature, pageSize-int64(len(swapSignature)))
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return bytes.Equal(signature, []byte(swapSignature)), nil
+}
+
+// checkDeviceUnused refuses a block device that is in use under any of its names: mounted, active as swap, split in
+// partitions, or held by another device such as a device-mapper target, a RAID array or an LVM volume group
+func checkDeviceUnused(path string, rdev uint64) error {
+	devNumber := fmt.Sprintf("%d:%d", unix.Major(rdev), unix.Minor(rdev))
+	sysPath := filepath.Join(HostPrefix, "sys/dev/block", devNumber)
+	holders, err := os.ReadDir(filepath.Join(sysPath, "holders"))
+	if err != nil {
+		return err
+	}
+	if len(holders) > 0 {
+		return fmt.Errorf("refusing to use %v as swap, it is held by %v", path, holders[0].Name())
+	}
+	entries, err := os.ReadDir(sysPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(sysPath, entry.Name(), "partition")); err == nil {
+			return fmt.Errorf("refusing to use %v as swap, it holds partition %v", path, entry.Name())
+		}
+	}
+
+	mountinfo, err := os.ReadFile(filepath.Join(HostPrefix, "proc/1/mountinfo"))
+	if err != nil {
+		return err
+	}
+	if mountPoint, mounted := findMount(mountinfo, devNumber); mounted {
+		return fmt.Errorf("refusing to use %v as swap, it is mounted on %v", path, mountPoint)
+	}
+
+	devices, err := ReadSwaps()
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		var stat unix.Stat_t
+		if err := unix.Stat(filepath.Join(HostPrefix, device.Filename), &stat); err != nil {
+			continue
+		}
+		if stat.Mode&unix.S_IFMT == unix.S_IFBLK && stat.Rdev == rdev {
+			return fmt.Errorf("refusing to use %v as swap, it is active as swap %v", path, device.Filename)
+		}
+	}
+	return nil
+}
+
+// findMount returns the mount point of the filesystem of a device in the content of a mountinfo file, given the
+// major:minor number of the device
+func findMount(mountinfo []byte, devNumber string) (string, bool) {
+	for _, line := range bytes.Split(mountinfo, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) > 4 && string(fields[2]) == devNumber {
+			return string(fields[4]), true
+		}
+	}
+	return "", false
+}
+
+// deviceSignature probes a block device for a filesystem, a partition table or any other signature, with blkid. It
+// returns the type of the signature, or an empty string when the device holds none.
+func deviceSignature(path string) (string, error) {
+	output, err := exec.Command("nsenter", "--target", "1", "--mount", "--", "blkid", "-p", "-o", "export", path).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		// blkid found nothing
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("blkid %v failed: %v", path, err)
+	}
+	return parseSignature(output), nil
+}
+
+// parseSignature returns the type of the signature from the output of blkid -o export
+func parseSignature(output []byte) string {
+	values := make(map[string]string)
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		if key, value, found := bytes.Cut(line, []byte("=")); found {
+			values[string(key)] = string(value)
+		}
+	}
+	for _, key := range []string{"TYPE", "PTTYPE"} {
+		if values[key] != "" {
+			return values[key]
+		}
+	}
+	return "unknown"
+}
+
+// RunOnHost runs a command in the mount namespace of the host, so that host paths are recorded as such by the kernel
+func RunOnHost(name string, args ...string) error {
+	cmd := exec.Command("nsenter", append([]string{"--target", "1", "--mount", "--", name}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %v failed: %v: %s", name, args, err, output)
+	}
+	return nil
+}
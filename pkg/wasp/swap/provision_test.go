@@ -0,0 +1,83 @@
+package swap
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const gi = 1024 * 1024 * 1024
+
+var _ = Describe("Provision", func() {
+	DescribeTable("Size.Calculate", func(size Size, expected uint64) {
+		Expect(size.Calculate(16 * gi)).To(Equal(expected))
+	},
+		Entry("should use the given bytes", Size{Bytes: 5 * gi}, uint64(5*gi)),
+		Entry("should use a fraction of the RAM", Size{RAMFraction: 0.25}, uint64(4*gi)),
+		Entry("should follow the NODE_SWAP_SPACE formula", Size{MemoryOverCommitPercent: 150}, uint64(8*gi)),
+		Entry("should round down to a page", Size{Bytes: pageSize + 1}, uint64(pageSize)),
+	)
+
+	DescribeTable("Size.Calculate should fail", func(size Size) {
+		_, err := size.Calculate(16 * gi)
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("without a size", Size{}),
+		Entry("with more than one size", Size{Bytes: gi, RAMFraction: 0.5}),
+		Entry("without over-commit", Size{MemoryOverCommitPercent: 100}),
+		Entry("below a page", Size{Bytes: pageSize - 1}),
+	)
+
+	It("should keep a share of the disk free", func() {
+		Expect(checkFreeSpace(50*gi, 100*gi, 40*gi)).To(Succeed())
+		Expect(checkFreeSpace(50*gi, 100*gi, 41*gi)).ToNot(Succeed())
+	})
+
+	It("should find the mount of a device by its number", func() {
+		mountinfo := []byte("22 1 253:0 / / rw,relatime shared:1 - xfs /dev/mapper/root rw\n" +
+			"23 22 8:1 / /boot rw,relatime shared:2 - xfs /dev/sda1 rw\n")
+		mountPoint, mounted := findMount(mountinfo, "253:0")
+		Expect(mounted).To(BeTrue())
+		Expect(mountPoint).To(Equal("/"))
+		mountPoint, mounted = findMount(mountinfo, "8:1")
+		Expect(mounted).To(BeTrue())
+		Expect(mountPoint).To(Equal("/boot"))
+		_, mounted = findMount(mountinfo, "8:0")
+		Expect(mounted).To(BeFalse())
+	})
+
+	DescribeTable("parseSignature", func(output, expected string) {
+		Expect(parseSignature([]byte(output))).To(Equal(expected))
+	},
+		Entry("should return the filesystem", "DEVNAME=/dev/sdb\nUUID=1234\nTYPE=xfs\nUSAGE=filesystem\n", "xfs"),
+		Entry("should return the partition table", "DEVNAME=/dev/sdb\nPTUUID=1234\nPTTYPE=gpt\n", "gpt"),
+		Entry("should report signatures without a type", "DEVNAME=/dev/sdb\n", "unknown"),
+	)
+
+	Context("hasSwapSignature", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "swapfile")
+		})
+
+		It("should detect a swap area", func() {
+			content := make([]byte, 2*pageSize)
+			copy(content[pageSize-len(swapSignature):], swapSignature)
+			Expect(os.WriteFile(path, content, 0600)).To(Succeed())
+			Expect(hasSwapSignature(path)).To(BeTrue())
+		})
+
+		It("should not detect a swap area on an unformatted file", func() {
+			Expect(os.WriteFile(path, make([]byte, 2*pageSize), 0600)).To(Succeed())
+			Expect(hasSwapSignature(path)).To(BeFalse())
+		})
+
+		It("should not detect a swap area on a file smaller than a page", func() {
+			Expect(os.WriteFile(path, []byte("data"), 0600)).To(Succeed())
+			Expect(hasSwapSignature(path)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,132 @@
+package swap
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	HostPrefix = "/host"
+	// ProcSwapsPath lists the active swap devices of the host
+	ProcSwapsPath   = HostPrefix + "/proc/swaps"
+	sysDevBlockPath = HostPrefix + "/sys/dev/block"
+	// hostRootPath reaches the files of the host outside of the directories mounted under HostPrefix, such as the
+	// swap files, through the root of its init process
+	hostRootPath = HostPrefix + "/proc/1/root"
+
+	TypePartition = "partition"
+	TypeFile      = "file"
+)
+
+// Device is an active swap area, as listed in /proc/swaps. Sizes are in KiB.
+type Device struct {
+	Filename string
+	Type     string
+	Size     uint64
+	Used     uint64
+	Priority int
+}
+
+// ReadSwaps returns the active swap areas of the host
+func ReadSwaps() ([]Device, error) {
+	content, err := os.ReadFile(ProcSwapsPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSwaps(string(content))
+}
+
+// ParseSwaps parses the content of /proc/swaps, e.g.
+//
+//	Filename				Type		Size		Used		Priority
+//	/dev/dm-1                               partition	8388604		0		-2
+func ParseSwaps(content string) ([]Device, error) {
+	var devices []Device
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid swaps line %q", line)
+		}
+		size, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in swaps line %q: %v", line, err)
+		}
+		used, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid used in swaps line %q: %v", line, err)
+		}
+		priority, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority in swaps line %q: %v", line, err)
+		}
+		devices = append(devices, Device{
+			// spaces and tabs in the path are escaped by the kernel
+			Filename: unescape(fields[0]),
+			Type:     fields[1],
+			Size:     size,
+			Used:     used,
+			Priority: priority,
+		})
+	}
+	return devices, nil
+}
+
+func unescape(path string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(path)
+}
+
+// BlockDevice returns the "major:minor" number of the disk backing the swap area. For a swap file this is the
+// disk of the filesystem holding the file, and partitions are resolved to their whole disk.
+func (d Device) BlockDevice() (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(filepath.Join(hostRootPath, d.Filename), &stat); err != nil {
+		return "", err
+	}
+	dev := stat.Dev
+	if d.Type == TypePartition {
+		dev = stat.Rdev
+	}
+	return wholeDisk(fmt.Sprintf("%d:%d", unix.Major(uint64(dev)), unix.Minor(uint64(dev))))
+}
+
+// wholeDisk resolves a partition to the disk it belongs to, through sysfs
+func wholeDisk(majorMinor string) (string, error) {
+	devPath := filepath.Join(sysDevBlockPath, majorMinor)
+	if _, err := os.Stat(filepath.Join(devPath, "partition")); err != nil {
+		if os.IsNotExist(err) {
+			return majorMinor, nil
+		}
+		return "", err
+	}
+	partitionPath, err := filepath.EvalSymlinks(devPath)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(partitionPath), "dev"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// UsedBytes sums the swap used on the given swap areas
+func UsedBytes(devices []Device) uint64 {
+	var used uint64
+	for _, device := range devices {
+		used += device.Used * 1024
+	}
+	return used
+}
+
+// Off disables the swap area, the kernel moves the swapped out pages back to memory
+func Off(device Device) error {
+	return RunOnHost("swapoff", device.Filename)
+}
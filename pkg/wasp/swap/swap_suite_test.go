@@ -0,0 +1,13 @@
+package swap
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSwap(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Swap Suite")
+}
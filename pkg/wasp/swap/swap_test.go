@@ -0,0 +1,30 @@
+package swap
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseSwaps", func() {
+	It("should parse the swap areas", func() {
+		devices, err := ParseSwaps("Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n" +
+			"/dev/dm-1                               partition\t8388604\t\t1024\t\t-2\n" +
+			"/var/lib/swap\\040file                   file\t\t4194300\t\t0\t\t10\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devices).To(Equal([]Device{
+			{Filename: "/dev/dm-1", Type: TypePartition, Size: 8388604, Used: 1024, Priority: -2},
+			{Filename: "/var/lib/swap file", Type: TypeFile, Size: 4194300, Used: 0, Priority: 10},
+		}))
+	})
+
+	It("should return no swap area when swap is off", func() {
+		devices, err := ParseSwaps("Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devices).To(BeEmpty())
+	})
+
+	It("should fail on a malformed line", func() {
+		_, err := ParseSwaps("Filename\tType\tSize\tUsed\tPriority\n/dev/sda2 partition\n")
+		Expect(err).To(HaveOccurred())
+	})
+})
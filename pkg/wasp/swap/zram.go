@@ -0,0 +1,119 @@
+package swap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	zramControlPath = HostPrefix + "/sys/class/zram-control"
+	sysBlockPath    = HostPrefix + "/sys/block"
+	zramPrefix      = "zram"
+)
+
+// ZramOptions configures a zram device used as a swap tier, in memory and compressed
+type ZramOptions struct {
+	// Size is the uncompressed size of the device
+	Size uint64
+	// Compressor is the compression algorithm, e.g. lzo-rle or zstd, empty keeps the kernel default
+	Compressor string
+	// Priority of the device among the swap areas, it should be above the priority of the disk swap
+	Priority int
+}
+
+// SetupZram creates, formats and enables a zram swap device, unless a zram device is already used as swap
+func SetupZram(options ZramOptions) error {
+	devices, err := ReadSwaps()
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		if strings.HasPrefix(filepath.Base(device.Filename), zramPrefix) {
+			return nil
+		}
+	}
+	if options.Size == 0 {
+		return fmt.Errorf("zram size must be set")
+	}
+
+	if err := RunOnHost("modprobe", "zram", "num_devices=0"); err != nil {
+		return err
+	}
+	content, err := os.ReadFile(filepath.Join(zramControlPath, "hot_add"))
+	if err != nil {
+		return fmt.Errorf("failed to add a zram device: %v", err)
+	}
+	name := zramPrefix + strings.TrimSpace(string(content))
+	devicePath := filepath.Join(sysBlockPath, name)
+	if options.Compressor != "" {
+		if err := os.WriteFile(filepath.Join(devicePath, "comp_algorithm"), []byte(options.Compressor), 0644); err != nil {
+			return fmt.Errorf("failed to set the compressor of %v to %v: %v", name, options.Compressor, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(devicePath, "disksize"), []byte(strconv.FormatUint(options.Size, 10)), 0644); err != nil {
+		return fmt.Errorf("failed to set the size of %v: %v", name, err)
+	}
+
+	if err := RunOnHost("mkswap", "/dev/"+name); err != nil {
+		return err
+	}
+	return RunOnHost("swapon", "--priority", strconv.Itoa(options.Priority), "/dev/"+name)
+}
+
+// ZramStats reports the usage of a zram device, from its mm_stat file
+type ZramStats struct {
+	Device string
+	// OrigDataBytes is the uncompressed size of the data stored in the device
+	OrigDataBytes uint64
+	// ComprDataBytes is the compressed size of the data stored in the device
+	ComprDataBytes uint64
+	// MemUsedBytes is the memory used by the device, including the allocator overhead
+	MemUsedBytes uint64
+}
+
+// ReadZramStats reads the usage of the zram devices of the host
+func ReadZramStats() ([]ZramStats, error) {
+	paths, err := filepath.Glob(filepath.Join(sysBlockPath, zramPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	var stats []ZramStats
+	for _, devicePath := range paths {
+		content, err := os.ReadFile(filepath.Join(devicePath, "mm_stat"))
+		if err != nil {
+			return nil, err
+		}
+		deviceStats, err := parseMMStat(filepath.Base(devicePath), string(content))
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, deviceStats)
+	}
+	return stats, nil
+}
+
+// parseMMStat parses the mm_stat file of a zram device, whose first columns are
+// orig_data_size compr_data_size mem_used_total
+func parseMMStat(device, content string) (ZramStats, error) {
+	fields := strings.Fields(content)
+	if len(fields) < 3 {
+		return ZramStats{}, fmt.Errorf("invalid mm_stat of %v: %q", device, content)
+	}
+	var values [3]uint64
+	for i := range values {
+		value, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return ZramStats{}, fmt.Errorf("invalid mm_stat of %v: %v", device, err)
+		}
+		values[i] = value
+	}
+	return ZramStats{
+		Device:         device,
+		OrigDataBytes:  values[0],
+		ComprDataBytes: values[1],
+		MemUsedBytes:   values[2],
+	}, nil
+}
@@ -0,0 +1,130 @@
+package swap
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	zswapParametersPath = HostPrefix + "/sys/module/zswap/parameters"
+	meminfoPath         = HostPrefix + "/proc/meminfo"
+	vmstatPath          = HostPrefix + "/proc/vmstat"
+
+	// ZswapMaxFile limits the compressed size a cgroup may keep in the zswap pool, available since kernel 5.19
+	ZswapMaxFile = "memory.zswap.max"
+)
+
+// ZswapOptions configures zswap, the compressed cache in front of the swap devices.
+// Empty values leave the corresponding parameter untouched.
+type ZswapOptions struct {
+	// Compressor is the compression algorithm, e.g. lzo or zstd
+	Compressor string
+	// Zpool is the allocator of the compressed pool, e.g. zsmalloc
+	Zpool string
+	// MaxPoolPercent is the maximal share of the memory the compressed pool may use
+	MaxPoolPercent int
+}
+
+// ConfigureZswap sets the zswap parameters and enables it
+func ConfigureZswap(options ZswapOptions) error {
+	parameters := [][2]string{
+		{"compressor", options.Compressor},
+		{"zpool", options.Zpool},
+	}
+	if options.MaxPoolPercent > 0 {
+		parameters = append(parameters, [2]string{"max_pool_percent", strconv.Itoa(options.MaxPoolPercent)})
+	}
+	parameters = append(parameters, [2]string{"enabled", "Y"})
+
+	for _, parameter := range parameters {
+		name, value := parameter[0], parameter[1]
+		if value == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(zswapParametersPath, name), []byte(value), 0644); err != nil {
+			return fmt.Errorf("failed to set zswap %v to %v: %v", name, value, err)
+		}
+	}
+	return nil
+}
+
+// ZswapStats reports the usage of the zswap pool
+type ZswapStats struct {
+	// PoolBytes is the memory used by the compressed pool
+	PoolBytes uint64
+	// StoredBytes is the uncompressed size of the pages held by the pool
+	StoredBytes uint64
+	// WrittenBackPages counts the pages written back from the pool to the swap devices
+	WrittenBackPages uint64
+	// StoredPagesTotal and LoadedPagesTotal count the pages stored in and loaded from the pool
+	StoredPagesTotal uint64
+	LoadedPagesTotal uint64
+}
+
+// CompressionRatio is the ratio between the uncompressed and the compressed size of the pool
+func (s ZswapStats) CompressionRatio() float64 {
+	if s.PoolBytes == 0 {
+		return 0
+	}
+	return float64(s.StoredBytes) / float64(s.PoolBytes)
+}
+
+// ZswapEnabled tells whether zswap is enabled on the host
+func ZswapEnabled() (bool, error) {
+	content, err := os.ReadFile(filepath.Join(zswapParametersPath, "enabled"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(content)) == "Y", nil
+}
+
+// ReadZswapStats reads the zswap usage from /proc/meminfo and /proc/vmstat
+func ReadZswapStats() (ZswapStats, error) {
+	meminfo, err := readKeyValues(meminfoPath)
+	if err != nil {
+		return ZswapStats{}, err
+	}
+	vmstat, err := readKeyValues(vmstatPath)
+	if err != nil {
+		return ZswapStats{}, err
+	}
+	return zswapStats(meminfo, vmstat), nil
+}
+
+func zswapStats(meminfo, vmstat map[string]uint64) ZswapStats {
+	return ZswapStats{
+		PoolBytes:        meminfo["Zswap"] * 1024,
+		StoredBytes:      meminfo["Zswapped"] * 1024,
+		WrittenBackPages: vmstat["zswpwb"],
+		StoredPagesTotal: vmstat["zswpout"],
+		LoadedPagesTotal: vmstat["zswpin"],
+	}
+}
+
+// readKeyValues parses files made of "key value [unit]" lines, such as /proc/meminfo and /proc/vmstat
+func readKeyValues(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,49 @@
+package swap
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compressed swap", func() {
+	It("should read zswap stats from meminfo and vmstat", func() {
+		dir := GinkgoT().TempDir()
+		meminfo := filepath.Join(dir, "meminfo")
+		vmstat := filepath.Join(dir, "vmstat")
+		Expect(os.WriteFile(meminfo, []byte("MemTotal:       16384000 kB\nZswap:             1024 kB\nZswapped:          3072 kB\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(vmstat, []byte("pswpin 10\nzswpin 20\nzswpout 30\nzswpwb 5\n"), 0644)).To(Succeed())
+
+		meminfoValues, err := readKeyValues(meminfo)
+		Expect(err).ToNot(HaveOccurred())
+		vmstatValues, err := readKeyValues(vmstat)
+		Expect(err).ToNot(HaveOccurred())
+
+		stats := zswapStats(meminfoValues, vmstatValues)
+		Expect(stats).To(Equal(ZswapStats{
+			PoolBytes:        1024 * 1024,
+			StoredBytes:      3072 * 1024,
+			WrittenBackPages: 5,
+			StoredPagesTotal: 30,
+			LoadedPagesTotal: 20,
+		}))
+		Expect(stats.CompressionRatio()).To(Equal(3.0))
+	})
+
+	It("should report no compression ratio for an empty pool", func() {
+		Expect(ZswapStats{}.CompressionRatio()).To(BeZero())
+	})
+
+	It("should parse the mm_stat of a zram device", func() {
+		stats, err := parseMMStat("zram0", "  4096000  1024000  1200000        0  1200000        0        0        0        0\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats).To(Equal(ZramStats{Device: "zram0", OrigDataBytes: 4096000, ComprDataBytes: 1024000, MemUsedBytes: 1200000}))
+	})
+
+	It("should fail on a malformed mm_stat", func() {
+		_, err := parseMMStat("zram0", "4096000\n")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	limited_swap_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/limited-swap-manager"
+	reclaim_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/reclaim-manager"
+	v1 "k8s.io/api/core/v1"
+	kubeapiqos "k8s.io/kubernetes/pkg/apis/core/v1/helper/qos"
+	kubelettypes "k8s.io/kubernetes/pkg/kubelet/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+const (
+	// SwapPolicySourceAnnotation records which rule decided each swap policy annotation of a pod, e.g.
+	// "proactive-reclaim=namespace,swap=virt-launcher"
+	SwapPolicySourceAnnotation = "wasp.io/swap-policy-source"
+
+	// SourcePod is an annotation set on the pod itself, it always wins
+	SourcePod = "pod"
+	// SourceQOS is a policy implied by the QoS class of the pod, only burstable pods get swap
+	SourceQOS = "qos"
+	// SourcePriorityClass is a policy implied by the priority class of the pod
+	SourcePriorityClass = "priority-class"
+	// SourceNamespace is a default set by the same annotation on the namespace of the pod
+	SourceNamespace = "namespace"
+	// SourceVirtLauncher is a default of the virt-launcher pods of KubeVirt VMs
+	SourceVirtLauncher = "virt-launcher"
+	// SourceDefault is the policy wasp-agent applies to pods without annotations
+	SourceDefault = "default"
+)
+
+// policyAnnotations are the pod annotations stamped by the webhook, the namespace annotations with the same keys
+// are the defaults of the pods of the namespace
+var policyAnnotations = []string{
+	limited_swap_manager.SwapAnnotation,
+	limited_swap_manager.MemoryProtectionAnnotation,
+	reclaim_manager.ProactiveReclaimAnnotation,
+}
+
+// Policy stamps the swap policy annotations on pods, and rejects the pods with contradictory annotations.
+// An annotation set on the pod always wins. Otherwise, the QoS class and the priority class of the pod come
+// first, as wasp-agent enforces them anyway, then the defaults of the namespace, then the defaults of the
+// virt-launcher pods: swap. Proactive reclaim is only set on the pod or as a default of its namespace.
+type Policy struct {
+	// SwapDisabledPriorityClasses are the priority classes whose pods get no swap, on top of the critical ones
+	SwapDisabledPriorityClasses []string
+}
+
+type decision struct {
+	value  string
+	source string
+}
+
+// Default returns the annotations to add to the pod, along with the SwapPolicySourceAnnotation recording the
+// decisions. The namespace may be nil when it couldn't be read.
+func (p *Policy) Default(pod *v1.Pod, namespace *v1.Namespace) map[string]string {
+	burstable := kubeapiqos.GetPodQOS(pod) == v1.PodQOSBurstable
+	critical := kubelettypes.IsCriticalPod(pod)
+	virtLauncher := isVirtLauncher(pod)
+
+	decisions := map[string]decision{}
+	decide := func(annotation, value, source string) {
+		if _, decided := decisions[annotation]; !decided {
+			decisions[annotation] = decision{value, source}
+		}
+	}
+	for _, annotation := range policyAnnotations {
+		if value, ok := pod.Annotations[annotation]; ok {
+			decide(annotation, value, SourcePod)
+		}
+	}
+
+	if !burstable {
+		decide(limited_swap_manager.SwapAnnotation, limited_swap_manager.SwapDisabled, SourceQOS)
+	}
+	if kubeapiqos.GetPodQOS(pod) == v1.PodQOSGuaranteed {
+		decide(limited_swap_manager.MemoryProtectionAnnotation, "true", SourceQOS)
+	}
+	if critical {
+		decide(limited_swap_manager.SwapAnnotation, limited_swap_manager.SwapDisabled, SourcePriorityClass)
+		decide(limited_swap_manager.MemoryProtectionAnnotation, "true", SourcePriorityClass)
+	}
+	if p.swapDisabled(pod.Spec.PriorityClassName) {
+		decide(limited_swap_manager.SwapAnnotation, limited_swap_manager.SwapDisabled, SourcePriorityClass)
+	}
+
+	if namespace != nil {
+		for _, annotation := range policyAnnotations {
+			value, ok := namespace.Annotations[annotation]
+			if !ok || validateValue(annotation, value) != nil {
+				continue
+			}
+			// proactive reclaim only applies to burstable pods that aren't critical
+			if annotation == reclaim_manager.ProactiveReclaimAnnotation && (!burstable || critical) {
+				continue
+			}
+			decide(annotation, value, SourceNamespace)
+		}
+	}
+
+	if virtLauncher && burstable && !critical {
+		decide(limited_swap_manager.SwapAnnotation, limited_swap_manager.SwapLimited, SourceVirtLauncher)
+	}
+	decide(limited_swap_manager.SwapAnnotation, limited_swap_manager.SwapLimited, SourceDefault)
+
+	annotations := map[string]string{}
+	var sources []string
+	for annotation, d := range decisions {
+		if d.source != SourcePod {
+			annotations[annotation] = d.value
+		}
+		sources = append(sources, fmt.Sprintf("%s=%s", strings.TrimPrefix(annotation, "wasp.io/"), d.source))
+	}
+	sort.Strings(sources)
+	annotations[SwapPolicySourceAnnotation] = strings.Join(sources, ",")
+	return annotations
+}
+
+func (p *Policy) swapDisabled(priorityClassName string) bool {
+	if priorityClassName == "" {
+		return false
+	}
+	for _, name := range p.SwapDisabledPriorityClasses {
+		if name == priorityClassName {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate rejects the pods whose swap policy annotations are invalid, or contradict what wasp-agent enforces
+// anyway: only burstable pods that aren't critical get swap and proactive reclaim, and critical and guaranteed
+// pods always have their memory protected.
+func (p *Policy) Validate(pod *v1.Pod) error {
+	var errs []error
+	for _, annotation := range policyAnnotations {
+		if value, ok := pod.Annotations[annotation]; ok {
+			if err := validateValue(annotation, value); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	qos := kubeapiqos.GetPodQOS(pod)
+	critical := kubelettypes.IsCriticalPod(pod)
+	if pod.Annotations[limited_swap_manager.SwapAnnotation] == limited_swap_manager.SwapLimited {
+		switch {
+		case qos != v1.PodQOSBurstable:
+			errs = append(errs, fmt.Errorf("%s=%s on a %s pod, only burstable pods get swap",
+				limited_swap_manager.SwapAnnotation, limited_swap_manager.SwapLimited, qos))
+		case critical:
+			errs = append(errs, fmt.Errorf("%s=%s on a critical pod, critical pods get no swap",
+				limited_swap_manager.SwapAnnotation, limited_swap_manager.SwapLimited))
+		case p.swapDisabled(pod.Spec.PriorityClassName):
+			errs = append(errs, fmt.Errorf("%s=%s on a pod of priority class %s, which gets no swap",
+				limited_swap_manager.SwapAnnotation, limited_swap_manager.SwapLimited, pod.Spec.PriorityClassName))
+		}
+	}
+	if pod.Annotations[limited_swap_manager.MemoryProtectionAnnotation] == "false" && (qos == v1.PodQOSGuaranteed || critical) {
+		errs = append(errs, fmt.Errorf("%s=false on a %s pod, whose memory is always protected",
+			limited_swap_manager.MemoryProtectionAnnotation, describe(qos, critical)))
+	}
+	if pod.Annotations[reclaim_manager.ProactiveReclaimAnnotation] == "true" && (qos != v1.PodQOSBurstable || critical) {
+		errs = append(errs, fmt.Errorf("%s=true on a %s pod, only burstable pods are reclaimed",
+			reclaim_manager.ProactiveReclaimAnnotation, describe(qos, critical)))
+	}
+	return errors.Join(errs...)
+}
+
+func validateValue(annotation, value string) error {
+	var allowed []string
+	if annotation == limited_swap_manager.SwapAnnotation {
+		allowed = []string{limited_swap_manager.SwapLimited, limited_swap_manager.SwapDisabled}
+	} else {
+		allowed = []string{"true", "false"}
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s=%q, should be %q or %q", annotation, value, allowed[0], allowed[1])
+}
+
+func describe(qos v1.PodQOSClass, critical bool) string {
+	if critical {
+		return "critical"
+	}
+	return string(qos)
+}
+
+// isVirtLauncher tells whether the pod runs a KubeVirt VM, virt-controller creates it owned by its VMI
+func isVirtLauncher(pod *v1.Pod) bool {
+	for _, ownerReference := range pod.OwnerReferences {
+		if ownerReference.Kind == kubevirtv1.VirtualMachineInstanceGroupVersionKind.Kind &&
+			ownerReference.APIVersion == kubevirtv1.GroupVersion.String() {
+			return true
+		}
+	}
+	return false
+}
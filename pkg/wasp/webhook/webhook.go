@@ -0,0 +1,195 @@
+/*
+ * This file is part of the Wasp project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2023,Red Hat, Inc.
+ *
+ */
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/openshift-virtualization/wasp-agent/pkg/log"
+	"github.com/openshift-virtualization/wasp-agent/pkg/util"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Execute runs wasp-webhook, which stamps the swap policy annotations on pods at admission and rejects the pods
+// with contradictory annotations
+func Execute() {
+	klog.InitFlags(nil)
+	flag.Parse()
+
+	policy := &Policy{SwapDisabledPriorityClasses: splitList(os.Getenv("SWAP_DISABLED_PRIORITY_CLASSES"))}
+	log.Log.Infof("Webhook: priority classes without swap: %v", policy.SwapDisabledPriorityClasses)
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+
+	ctrl.SetLogger(klog.NewKlogr())
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), manager.Options{
+		Scheme: scheme,
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    util.WebhookPort,
+			CertDir: util.WebhookCertDir,
+		}),
+		HealthProbeBindAddress: fmt.Sprintf(":%d", util.WebhookHealthPort),
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		log.Log.Errorf("Webhook: failed to create the manager: %v", err)
+		os.Exit(1)
+	}
+
+	decoder := admission.NewDecoder(scheme)
+	server := mgr.GetWebhookServer()
+	server.Register(util.WebhookMutatePath, &webhook.Admission{Handler: &podDefaulter{
+		client:  mgr.GetClient(),
+		decoder: decoder,
+		policy:  policy,
+	}})
+	server.Register(util.WebhookValidatePath, &webhook.Admission{Handler: &podValidator{
+		decoder: decoder,
+		policy:  policy,
+	}})
+	// the namespaces are cached from the start, so that the first pods aren't admitted while the cache syncs
+	if _, err := mgr.GetCache().GetInformer(context.Background(), &v1.Namespace{}); err != nil {
+		log.Log.Errorf("Webhook: failed to watch the namespaces: %v", err)
+		os.Exit(1)
+	}
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		log.Log.Errorf("Webhook: %v", err)
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("webhook", server.StartedChecker()); err != nil {
+		log.Log.Errorf("Webhook: %v", err)
+		os.Exit(1)
+	}
+
+	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+		log.Log.Errorf("Webhook: manager exited: %v", err)
+		os.Exit(1)
+	}
+}
+
+// podDefaulter stamps the swap policy annotations on the pods being created
+type podDefaulter struct {
+	client  client.Reader
+	decoder *admission.Decoder
+	policy  *Policy
+}
+
+func (d *podDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create {
+		return admission.Allowed("")
+	}
+	pod := &v1.Pod{}
+	if err := d.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// the namespace defaults are skipped rather than failing the admission of the pod
+	namespace := &v1.Namespace{}
+	if err := d.client.Get(ctx, types.NamespacedName{Name: req.Namespace}, namespace); err != nil {
+		if !errors.IsNotFound(err) {
+			log.Log.Errorf("Webhook: failed to read namespace %v: %v", req.Namespace, err)
+		}
+		namespace = nil
+	}
+
+	annotations := d.policy.Default(pod, namespace)
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		pod.Annotations[key] = value
+	}
+	mutated, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, mutated)
+}
+
+// podValidator rejects the pods whose swap policy annotations contradict each other or the pod
+type podValidator struct {
+	decoder *admission.Decoder
+	policy  *Policy
+}
+
+func (v *podValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+	pod := &v1.Pod{}
+	if err := v.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// the pods admitted before the webhook was deployed are only checked when their policy changes
+	if req.Operation == admissionv1.Update {
+		oldPod := &v1.Pod{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldPod); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if !policyChanged(oldPod, pod) {
+			return admission.Allowed("")
+		}
+	}
+	if err := v.policy.Validate(pod); err != nil {
+		return admission.Denied(strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	return admission.Allowed("")
+}
+
+func policyChanged(oldPod, pod *v1.Pod) bool {
+	for _, annotation := range policyAnnotations {
+		if oldPod.Annotations[annotation] != pod.Annotations[annotation] {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
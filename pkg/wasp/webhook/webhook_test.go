@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	limited_swap_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/limited-swap-manager"
+	reclaim_manager "github.com/openshift-virtualization/wasp-agent/pkg/wasp/reclaim-manager"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/kubernetes/pkg/apis/scheduling"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	swap             = limited_swap_manager.SwapAnnotation
+	memoryProtection = limited_swap_manager.MemoryProtectionAnnotation
+	proactiveReclaim = reclaim_manager.ProactiveReclaimAnnotation
+	guaranteedPod    = "guaranteed"
+	burstablePod     = "burstable"
+	bestEffortPod    = "besteffort"
+	virtLauncherPod  = "virt-launcher"
+	criticalPod      = "critical"
+	batchPriorityPod = "batch"
+	batchPriority    = "batch-low"
+	namespaceName    = "default"
+)
+
+func newPod(kind string, annotations map[string]string) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: kind, Namespace: namespaceName, Annotations: annotations},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "compute"}},
+		},
+	}
+	requests := v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")}
+	limits := v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("2Gi")}
+	switch kind {
+	case guaranteedPod:
+		pod.Spec.Containers[0].Resources = v1.ResourceRequirements{Requests: limits, Limits: limits}
+	case bestEffortPod:
+	case virtLauncherPod:
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: kubevirtv1.GroupVersion.String(),
+			Kind:       kubevirtv1.VirtualMachineInstanceGroupVersionKind.Kind,
+			Name:       "vm",
+		}}
+		fallthrough
+	default:
+		pod.Spec.Containers[0].Resources = v1.ResourceRequirements{Requests: requests, Limits: limits}
+	}
+	switch kind {
+	case criticalPod:
+		priority := int32(scheduling.SystemCriticalPriority)
+		pod.Spec.PriorityClassName = "system-node-critical"
+		pod.Spec.Priority = &priority
+	case batchPriorityPod:
+		pod.Spec.PriorityClassName = batchPriority
+	}
+	return pod
+}
+
+type namespaceReader struct {
+	namespace *v1.Namespace
+}
+
+func (r *namespaceReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	if r.namespace == nil || key.Name != r.namespace.Name {
+		return errors.NewNotFound(v1.Resource("namespaces"), key.Name)
+	}
+	r.namespace.DeepCopyInto(obj.(*v1.Namespace))
+	return nil
+}
+
+func (r *namespaceReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return nil
+}
+
+func admissionRequest(operation admissionv1.Operation, pod, oldPod *v1.Pod) admission.Request {
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: operation,
+		Namespace: pod.Namespace,
+		Object:    runtime.RawExtension{Raw: toJSON(pod)},
+	}}
+	if oldPod != nil {
+		req.OldObject = runtime.RawExtension{Raw: toJSON(oldPod)}
+	}
+	return req
+}
+
+func toJSON(pod *v1.Pod) []byte {
+	raw, err := json.Marshal(pod)
+	ExpectWithOffset(2, err).ToNot(HaveOccurred())
+	return raw
+}
+
+var _ = Describe("Webhook", func() {
+	policy := &Policy{SwapDisabledPriorityClasses: []string{batchPriority}}
+
+	DescribeTable("Default", func(kind string, podAnnotations, namespaceAnnotations, expected map[string]string) {
+		var namespace *v1.Namespace
+		if namespaceAnnotations != nil {
+			namespace = &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespaceName, Annotations: namespaceAnnotations}}
+		}
+		pod := newPod(kind, podAnnotations)
+		Expect(policy.Default(pod, namespace)).To(Equal(expected))
+		for key, value := range expected {
+			pod.Annotations = mergeAnnotations(pod.Annotations, key, value)
+		}
+		Expect(policy.Validate(pod)).To(Succeed(), "stamped annotations must be valid")
+	},
+		Entry("should grant swap to burstable pods by default", burstablePod, nil, nil, map[string]string{
+			swap:                       "limited",
+			SwapPolicySourceAnnotation: "swap=default",
+		}),
+		Entry("should deny swap to guaranteed pods and protect their memory", guaranteedPod, nil, nil, map[string]string{
+			swap:                       "disabled",
+			memoryProtection:           "true",
+			SwapPolicySourceAnnotation: "memory-protection=qos,swap=qos",
+		}),
+		Entry("should deny swap to best-effort pods", bestEffortPod, nil, nil, map[string]string{
+			swap:                       "disabled",
+			SwapPolicySourceAnnotation: "swap=qos",
+		}),
+		Entry("should deny swap to critical pods and protect their memory", criticalPod, nil, nil, map[string]string{
+			swap:                       "disabled",
+			memoryProtection:           "true",
+			SwapPolicySourceAnnotation: "memory-protection=priority-class,swap=priority-class",
+		}),
+		Entry("should deny swap to the configured priority classes", batchPriorityPod, nil, nil, map[string]string{
+			swap:                       "disabled",
+			SwapPolicySourceAnnotation: "swap=priority-class",
+		}),
+		Entry("should grant swap but not proactive reclaim to virt-launcher pods", virtLauncherPod, nil, nil, map[string]string{
+			swap:                       "limited",
+			SwapPolicySourceAnnotation: "swap=virt-launcher",
+		}),
+		Entry("should leave proactive reclaim of virt-launcher pods to the namespace", virtLauncherPod, nil,
+			map[string]string{proactiveReclaim: "true"}, map[string]string{
+				swap:                       "limited",
+				proactiveReclaim:           "true",
+				SwapPolicySourceAnnotation: "proactive-reclaim=namespace,swap=virt-launcher",
+			}),
+		Entry("should prefer the namespace defaults to the virt-launcher ones", virtLauncherPod, nil,
+			map[string]string{swap: "disabled", proactiveReclaim: "false", memoryProtection: "true"}, map[string]string{
+				swap:                       "disabled",
+				proactiveReclaim:           "false",
+				memoryProtection:           "true",
+				SwapPolicySourceAnnotation: "memory-protection=namespace,proactive-reclaim=namespace,swap=namespace",
+			}),
+		Entry("should not apply contradictory namespace defaults", guaranteedPod, nil,
+			map[string]string{swap: "limited", proactiveReclaim: "true", memoryProtection: "false"}, map[string]string{
+				swap:                       "disabled",
+				memoryProtection:           "true",
+				SwapPolicySourceAnnotation: "memory-protection=qos,swap=qos",
+			}),
+		Entry("should ignore invalid namespace defaults", burstablePod, nil, map[string]string{swap: "unlimited"}, map[string]string{
+			swap:                       "limited",
+			SwapPolicySourceAnnotation: "swap=default",
+		}),
+		Entry("should keep the annotations of the pod", virtLauncherPod, map[string]string{swap: "disabled"},
+			map[string]string{swap: "limited"}, map[string]string{
+				SwapPolicySourceAnnotation: "swap=pod",
+			}),
+	)
+
+	DescribeTable("Validate", func(kind string, annotations map[string]string, message string) {
+		err := policy.Validate(newPod(kind, annotations))
+		if message == "" {
+			Expect(err).ToNot(HaveOccurred())
+		} else {
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		}
+	},
+		Entry("should admit a swap override on a burstable pod", burstablePod, map[string]string{swap: "limited"}, ""),
+		Entry("should admit disabling swap on any pod", guaranteedPod, map[string]string{swap: "disabled"}, ""),
+		Entry("should reject a swap override on a guaranteed pod", guaranteedPod, map[string]string{swap: "limited"},
+			"wasp.io/swap=limited on a Guaranteed pod"),
+		Entry("should reject a swap override on a best-effort pod", bestEffortPod, map[string]string{swap: "limited"},
+			"wasp.io/swap=limited on a BestEffort pod"),
+		Entry("should reject a swap override on a critical pod", criticalPod, map[string]string{swap: "limited"},
+			"critical pods get no swap"),
+		Entry("should reject a swap override on a priority class without swap", batchPriorityPod, map[string]string{swap: "limited"},
+			"priority class batch-low"),
+		Entry("should reject an unprotected guaranteed pod", guaranteedPod, map[string]string{memoryProtection: "false"},
+			"whose memory is always protected"),
+		Entry("should reject proactive reclaim of a critical pod", criticalPod, map[string]string{proactiveReclaim: "true"},
+			"only burstable pods are reclaimed"),
+		Entry("should reject invalid values", burstablePod, map[string]string{swap: "unlimited"},
+			`invalid wasp.io/swap="unlimited"`),
+	)
+
+	Context("podDefaulter", func() {
+		It("should patch the annotations of the pods being created", func() {
+			defaulter := &podDefaulter{
+				client: &namespaceReader{namespace: &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+					Name:        namespaceName,
+					Annotations: map[string]string{proactiveReclaim: "true"},
+				}}},
+				decoder: admission.NewDecoder(clientgoscheme.Scheme),
+				policy:  policy,
+			}
+			response := defaulter.Handle(context.Background(), admissionRequest(admissionv1.Create, newPod(burstablePod, nil), nil))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Patches).To(HaveLen(1))
+			Expect(response.Patches[0].Path).To(Equal("/metadata/annotations"))
+			Expect(response.Patches[0].Value).To(Equal(map[string]interface{}{
+				swap:                       "limited",
+				proactiveReclaim:           "true",
+				SwapPolicySourceAnnotation: "proactive-reclaim=namespace,swap=default",
+			}))
+		})
+
+		It("should stamp the pods of namespaces it can't read", func() {
+			defaulter := &podDefaulter{client: &namespaceReader{}, decoder: admission.NewDecoder(clientgoscheme.Scheme), policy: policy}
+			response := defaulter.Handle(context.Background(), admissionRequest(admissionv1.Create, newPod(guaranteedPod, nil), nil))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Patches).To(HaveLen(1))
+		})
+	})
+
+	Context("podValidator", func() {
+		validator := &podValidator{decoder: admission.NewDecoder(clientgoscheme.Scheme), policy: policy}
+
+		It("should deny contradictory pods", func() {
+			response := validator.Handle(context.Background(), admissionRequest(admissionv1.Create,
+				newPod(guaranteedPod, map[string]string{swap: "limited", memoryProtection: "false"}), nil))
+			Expect(response.Allowed).To(BeFalse())
+			Expect(response.Result.Message).To(ContainSubstring("only burstable pods get swap; wasp.io/memory-protection=false"))
+		})
+
+		It("should only check updates changing the policy", func() {
+			contradictory := newPod(guaranteedPod, map[string]string{swap: "limited"})
+			relabelled := contradictory.DeepCopy()
+			relabelled.Labels = map[string]string{"app": "db"}
+			response := validator.Handle(context.Background(), admissionRequest(admissionv1.Update, relabelled, contradictory))
+			Expect(response.Allowed).To(BeTrue())
+
+			valid := newPod(guaranteedPod, nil)
+			response = validator.Handle(context.Background(), admissionRequest(admissionv1.Update, contradictory, valid))
+			Expect(response.Allowed).To(BeFalse())
+		})
+	})
+})
+
+func mergeAnnotations(annotations map[string]string, key, value string) map[string]string {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[key] = value
+	return annotations
+}
@@ -0,0 +1,235 @@
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	wasp "github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/operator"
+
+	secv1 "github.com/openshift/api/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	chartName = "wasp-agent"
+
+	// The chart templates are generated from the resource factories with these tokens in place of the values, the
+	// tokens are then replaced by the template actions reading the values
+	imageToken        = "__WASP_IMAGE__"
+	pullPolicyToken   = "__WASP_PULL_POLICY__"
+	verbosityToken    = "__WASP_VERBOSITY__"
+	namespaceToken    = "__WASP_NAMESPACE__"
+	nodeSelectorToken = "__WASP_NODE_SELECTOR__"
+	tolerationsToken  = "__WASP_TOLERATIONS__"
+	// securityAPIToken and endToken surround the objects of the OpenShift security API, e.g. the
+	// SecurityContextConstraints, which are only rendered on the clusters serving it
+	securityAPIToken = "__WASP_IF_SECURITY_API__"
+	endToken         = "__WASP_END__"
+)
+
+var (
+	valueReplacer = strings.NewReplacer(
+		imageToken, "{{ .Values.image }}",
+		pullPolicyToken, "{{ .Values.pullPolicy }}",
+		verbosityToken, "{{ .Values.verbosity | quote }}",
+		namespaceToken, "{{ .Values.namespace }}",
+		securityAPIToken, fmt.Sprintf("{{- if .Capabilities.APIVersions.Has %q }}", secv1.GroupVersion.String()),
+		endToken, "{{- end }}",
+	)
+	// actionEscaper keeps the Go templates of the alerts, e.g. {{ $labels.node }}, away from Helm
+	actionEscaper    = strings.NewReplacer("{{", `{{"{{"}}`, "}}", `{{"}}"}}`)
+	nodeSelectorLine = regexp.MustCompile(`(?m)^( *)` + nodeSelectorToken + `: ""\n`)
+	tolerationsLine  = regexp.MustCompile(`(?m)^( *)- key: ` + tolerationsToken + `\n`)
+)
+
+type chartMetadata struct {
+	APIVersion  string `json:"apiVersion"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"appVersion"`
+}
+
+type chartValues struct {
+	Image           string              `json:"image"`
+	PullPolicy      string              `json:"pullPolicy"`
+	Namespace       string              `json:"namespace"`
+	CreateNamespace bool                `json:"createNamespace"`
+	Verbosity       string              `json:"verbosity"`
+	PrometheusRule  chartPrometheusRule `json:"prometheusRule"`
+	Webhook         chartWebhook        `json:"webhook"`
+	NodeSelector    map[string]string   `json:"nodeSelector"`
+	Tolerations     []corev1.Toleration `json:"tolerations"`
+}
+
+type chartPrometheusRule struct {
+	Enabled bool `json:"enabled"`
+}
+
+type chartWebhook struct {
+	Enabled bool `json:"enabled"`
+}
+
+// chartTemplate is a template of the chart generated from a resource group, enabled by an optional condition
+type chartTemplate struct {
+	file      string
+	group     string
+	condition string
+}
+
+var chartTemplates = []chartTemplate{
+	{file: "cluster-rbac.yaml", group: "wasp-cluster-rbac"},
+	{file: "rbac.yaml", group: "wasp-rbac"},
+	{file: "daemonset.yaml", group: "wasp-daemonset"},
+	{file: "prometheus-rule.yaml", group: "wasp-prom-rule", condition: ".Values.prometheusRule.enabled"},
+	{file: "webhook.yaml", group: "wasp-webhook", condition: ".Values.webhook.enabled"},
+}
+
+// generateHelmChart writes a chart deploying wasp-agent, whose values default to the generator flags
+func generateHelmChart(dir string) error {
+	chartDir := filepath.Join(dir, chartName)
+	if err := os.MkdirAll(filepath.Join(chartDir, "templates"), 0755); err != nil {
+		return err
+	}
+
+	workload := getFactoryArgs().Placement
+	metadata := chartMetadata{
+		APIVersion:  "v2",
+		Name:        chartName,
+		Description: "Swap for the burstable workloads of Kubernetes and OpenShift nodes",
+		Type:        "application",
+		Version:     semanticVersion(*operatorVersion),
+		AppVersion:  *operatorVersion,
+	}
+	values := chartValues{
+		Image:           *operatorImage,
+		PullPolicy:      *pullPolicy,
+		Namespace:       *namespace,
+		CreateNamespace: true,
+		Verbosity:       *verbosity,
+		PrometheusRule:  chartPrometheusRule{Enabled: *deployPrometheusRule == "true"},
+		Webhook:         chartWebhook{Enabled: *deployWebhook == "true"},
+		NodeSelector:    map[string]string{},
+		Tolerations:     []corev1.Toleration{},
+	}
+	if workload.NodeSelector != nil {
+		values.NodeSelector = workload.NodeSelector
+	}
+	if workload.Tolerations != nil {
+		values.Tolerations = workload.Tolerations
+	}
+	if err := writeYAML(filepath.Join(chartDir, "Chart.yaml"), metadata); err != nil {
+		return err
+	}
+	if err := writeYAML(filepath.Join(chartDir, "values.yaml"), values); err != nil {
+		return err
+	}
+
+	namespaceTemplate, err := marshallObjects(createNamespace(namespaceToken))
+	if err != nil {
+		return err
+	}
+	if err := writeChartTemplate(chartDir, "namespace.yaml", namespaceTemplate, ".Values.createNamespace"); err != nil {
+		return err
+	}
+
+	// The other workload flags are rendered as is in the templates
+	args := getFactoryArgs()
+	args.NamespacedArgs.Verbosity = verbosityToken
+	args.NamespacedArgs.DeployClusterResources = "true"
+	args.NamespacedArgs.DeployPrometheusRule = "true"
+	args.NamespacedArgs.DeployWebhook = "true"
+	args.NamespacedArgs.PullPolicy = pullPolicyToken
+	args.NamespacedArgs.Namespace = namespaceToken
+	args.Image = imageToken
+	args.Placement.NodeSelector = map[string]string{nodeSelectorToken: ""}
+	args.Placement.Tolerations = []corev1.Toleration{{Key: tolerationsToken}}
+	for _, t := range chartTemplates {
+		objects, err := wasp.CreateOperatorResourceGroup(t.group, args)
+		if err != nil {
+			return err
+		}
+		manifest, err := marshallChartObjects(objects...)
+		if err != nil {
+			return err
+		}
+		if err := writeChartTemplate(chartDir, t.file, manifest, t.condition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshallChartObjects marshalls the objects of a chart template, surrounding those of the OpenShift security API with
+// securityAPIToken and endToken
+func marshallChartObjects(objects ...client.Object) (string, error) {
+	var manifest strings.Builder
+	for _, object := range objects {
+		objectManifest, err := marshallObjects(object)
+		if err != nil {
+			return "", err
+		}
+		if object.GetObjectKind().GroupVersionKind().GroupVersion() == secv1.GroupVersion {
+			objectManifest = securityAPIToken + "\n" + objectManifest + endToken + "\n"
+		}
+		manifest.WriteString(objectManifest)
+	}
+	return manifest.String(), nil
+}
+
+// writeChartTemplate turns a manifest generated with the value tokens into a template of the chart
+func writeChartTemplate(chartDir, file, manifest, condition string) error {
+	template := valueReplacer.Replace(actionEscaper.Replace(manifest))
+	template = replaceIndentedLine(nodeSelectorLine, template, "{{- toYaml .Values.nodeSelector | nindent %d }}")
+	template = replaceIndentedLine(tolerationsLine, template, "{{- with .Values.tolerations }}{{ toYaml . | nindent %d }}{{- end }}")
+	if condition != "" {
+		template = fmt.Sprintf("{{- if %s }}\n%s{{- end }}\n", condition, template)
+	}
+	return os.WriteFile(filepath.Join(chartDir, "templates", file), []byte(template), 0644)
+}
+
+// replaceIndentedLine replaces the lines matched by re with an action rendering a block at the indentation of the line
+func replaceIndentedLine(re *regexp.Regexp, template, action string) string {
+	return re.ReplaceAllStringFunc(template, func(line string) string {
+		indent := len(re.FindStringSubmatch(line)[1])
+		return strings.Repeat(" ", indent) + fmt.Sprintf(action, indent) + "\n"
+	})
+}
+
+// semanticVersion makes a SemVer version out of the operator version, e.g. v0.1.0 gives 0.1.0
+func semanticVersion(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if version == "" {
+		return "0.0.0"
+	}
+	if !regexp.MustCompile(`^\d+\.\d+\.\d+`).MatchString(version) {
+		return "0.0.0-" + regexp.MustCompile(`[^0-9A-Za-z-]`).ReplaceAllString(version, "-")
+	}
+	return version
+}
+
+func writeYAML(path string, obj interface{}) error {
+	content, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	wasp "github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/operator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Helm chart", func() {
+	var chartDir string
+
+	BeforeEach(func() {
+		chartDir = GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(chartDir, "templates"), 0755)).To(Succeed())
+	})
+
+	readTemplate := func(file string) string {
+		content, err := os.ReadFile(filepath.Join(chartDir, "templates", file))
+		Expect(err).ToNot(HaveOccurred())
+		return string(content)
+	}
+
+	It("should replace the lines at their indentation", func() {
+		template := "spec:\n  nodeSelector:\n    " + nodeSelectorToken + ": \"\"\n  tolerations:\n  - key: " + tolerationsToken + "\n"
+		template = replaceIndentedLine(nodeSelectorLine, template, "{{- toYaml .Values.nodeSelector | nindent %d }}")
+		template = replaceIndentedLine(tolerationsLine, template, "{{- with .Values.tolerations }}{{ toYaml . | nindent %d }}{{- end }}")
+		Expect(template).To(Equal("spec:\n" +
+			"  nodeSelector:\n" +
+			"    {{- toYaml .Values.nodeSelector | nindent 4 }}\n" +
+			"  tolerations:\n" +
+			"  {{- with .Values.tolerations }}{{ toYaml . | nindent 2 }}{{- end }}\n"))
+	})
+
+	It("should leave the lines not matching alone", func() {
+		template := "metadata:\n  name: " + nodeSelectorToken + "\n"
+		Expect(replaceIndentedLine(nodeSelectorLine, template, "{{ . | nindent %d }}")).To(Equal(template))
+	})
+
+	It("should turn the tokens into actions and escape the actions of the manifest", func() {
+		manifest := "image: " + imageToken + "\n" +
+			"namespace: " + namespaceToken + "\n" +
+			"description: '{{ $labels.node }}'\n"
+		Expect(writeChartTemplate(chartDir, "test.yaml", manifest, "")).To(Succeed())
+		Expect(readTemplate("test.yaml")).To(Equal("image: {{ .Values.image }}\n" +
+			"namespace: {{ .Values.namespace }}\n" +
+			`description: '{{"{{"}} $labels.node {{"}}"}}'` + "\n"))
+	})
+
+	It("should render the template under its condition", func() {
+		Expect(writeChartTemplate(chartDir, "test.yaml", "kind: PrometheusRule\n", ".Values.prometheusRule.enabled")).To(Succeed())
+		Expect(readTemplate("test.yaml")).To(Equal("{{- if .Values.prometheusRule.enabled }}\nkind: PrometheusRule\n{{- end }}\n"))
+	})
+
+	It("should only render the SecurityContextConstraints on clusters serving their API", func() {
+		serviceAccount := &corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: "wasp"},
+		}
+		manifest, err := marshallChartObjects(serviceAccount, wasp.CreateSCC(namespaceToken, "wasp"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writeChartTemplate(chartDir, "rbac.yaml", manifest, "")).To(Succeed())
+
+		template := readTemplate("rbac.yaml")
+		Expect(template).To(HavePrefix("---\napiVersion: v1\nkind: ServiceAccount\n"))
+		Expect(template).To(ContainSubstring("{{- if .Capabilities.APIVersions.Has \"security.openshift.io/v1\" }}\n---\n"))
+		Expect(template).To(ContainSubstring("kind: SecurityContextConstraints\n"))
+		Expect(template).To(HaveSuffix("{{- end }}\n"))
+		Expect(template).ToNot(ContainSubstring(securityAPIToken))
+	})
+
+	DescribeTable("semanticVersion", func(version, expected string) {
+		Expect(semanticVersion(version)).To(Equal(expected))
+	},
+		Entry("release", "v0.1.0", "0.1.0"),
+		Entry("pre-release", "v0.1.0-rc.1", "0.1.0-rc.1"),
+		Entry("none", "", "0.0.0"),
+		Entry("branch", "main", "0.0.0-main"),
+	)
+})
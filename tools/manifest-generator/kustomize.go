@@ -0,0 +1,156 @@
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	wasp "github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/operator"
+	"github.com/openshift-virtualization/wasp-agent/tools/util"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type kustomization struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Resources  []string             `json:"resources"`
+	Images     []kustomizationImage `json:"images,omitempty"`
+}
+
+type kustomizationImage struct {
+	Name   string `json:"name"`
+	NewTag string `json:"newTag,omitempty"`
+}
+
+// generateKustomize writes a Kustomize base deploying wasp-agent as configured by the generator flags, and a
+// component adding each optional resource group, e.g. components/prometheus-rule and components/webhook. Overlays set
+// the image through the kustomization, and the verbosity, tolerations and node selector by patching the wasp-agent
+// DaemonSet. The namespace is set by the generator flags only, it is also part of the user name matched by the node
+// restriction policy and of the CA injection of the webhook, which the namespace of an overlay wouldn't rewrite.
+func generateKustomize(dir string) error {
+	args := getFactoryArgs()
+	args.NamespacedArgs.DeployPrometheusRule = "true"
+	args.NamespacedArgs.DeployWebhook = "true"
+
+	baseDir := filepath.Join(dir, "base")
+	base := kustomization{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+	}
+	if name, tag, ok := splitImage(*operatorImage); ok {
+		base.Images = []kustomizationImage{{Name: name, NewTag: tag}}
+	}
+	files := map[string][]client.Object{
+		"namespace.yaml": {createNamespace(*namespace)},
+	}
+	for _, t := range chartTemplates {
+		if t.condition != "" {
+			continue
+		}
+		objects, err := wasp.CreateOperatorResourceGroup(t.group, args)
+		if err != nil {
+			return err
+		}
+		files[t.file] = objects
+	}
+	base.Resources = append(base.Resources, "namespace.yaml")
+	for _, t := range chartTemplates {
+		if t.condition == "" {
+			base.Resources = append(base.Resources, t.file)
+		}
+	}
+	if err := writeKustomization(baseDir, base, files); err != nil {
+		return err
+	}
+
+	for _, t := range chartTemplates {
+		if t.condition == "" {
+			continue
+		}
+		objects, err := wasp.CreateOperatorResourceGroup(t.group, args)
+		if err != nil {
+			return err
+		}
+		component := kustomization{
+			APIVersion: "kustomize.config.k8s.io/v1alpha1",
+			Kind:       "Component",
+			Resources:  []string{t.file},
+		}
+		componentDir := filepath.Join(dir, "components", strings.TrimSuffix(t.file, ".yaml"))
+		if err := writeKustomization(componentDir, component, map[string][]client.Object{t.file: objects}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeKustomization(dir string, k kustomization, files map[string][]client.Object) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for file, objects := range files {
+		manifest, err := marshallObjects(objects...)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(manifest), 0644); err != nil {
+			return err
+		}
+	}
+	return writeYAML(filepath.Join(dir, "kustomization.yaml"), k)
+}
+
+// splitImage splits an image reference into its name and its tag
+func splitImage(image string) (string, string, bool) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") || strings.Contains(image, "@") {
+		return "", "", false
+	}
+	return image[:i], image[i+1:], true
+}
+
+// createNamespace creates the namespace of wasp-agent, labelled for the privileged Pod Security level on Kubernetes
+func createNamespace(name string) *corev1.Namespace {
+	labels := map[string]string{"wasp.io": ""}
+	if *flavour == wasp.FlavourKubernetes {
+		for key, value := range wasp.PodSecurityLabels {
+			labels[key] = value
+		}
+	}
+	return &corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+	}
+}
+
+func marshallObjects(objects ...client.Object) (string, error) {
+	var buffer bytes.Buffer
+	for _, object := range objects {
+		if err := util.MarshallObject(object, &buffer); err != nil {
+			return "", err
+		}
+	}
+	return buffer.String(), nil
+}
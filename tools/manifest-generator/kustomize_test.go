@@ -0,0 +1,19 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Kustomize base", func() {
+	DescribeTable("splitImage", func(image, name, tag string, ok bool) {
+		actualName, actualTag, actualOk := splitImage(image)
+		Expect(actualOk).To(Equal(ok))
+		Expect(actualName).To(Equal(name))
+		Expect(actualTag).To(Equal(tag))
+	},
+		Entry("tag", "quay.io/wasp/wasp-agent:v0.1.0", "quay.io/wasp/wasp-agent", "v0.1.0", true),
+		Entry("registry port", "localhost:5000/wasp-agent", "", "", false),
+		Entry("digest", "quay.io/wasp/wasp-agent@sha256:0123", "", "", false),
+	)
+})
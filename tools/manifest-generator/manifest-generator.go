@@ -18,16 +18,25 @@ import (
 	"os"
 	"path/filepath"
 	"text/template"
+	"time"
 
 	"github.com/openshift-virtualization/wasp-agent/pkg/monitoring/rules"
 	args2 "github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/args"
 	wasp "github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/operator"
 	"github.com/openshift-virtualization/wasp-agent/tools/util"
 
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	probeTimeout = 10 * time.Second
+	// flavourAuto probes the cluster of the current kubeconfig for the flavour
+	flavourAuto = "auto"
+)
+
 type templateData struct {
 	DockerRepo             string
 	DockerTag              string
@@ -42,6 +51,8 @@ type templateData struct {
 	CrName                 string
 	Namespace              string
 	LogBacktraceAt         string
+	Flavour                string
+	PodSecurityLabels      map[string]string
 	GeneratedManifests     map[string]string
 }
 
@@ -52,11 +63,15 @@ var (
 	genManifestsPath       = flag.String("generated-manifests-path", "", "")
 	deployClusterResources = flag.String("deploy-cluster-resources", "", "")
 	deployPrometheusRule   = flag.String("deploy-prometheus-rule", "", "")
+	deployWebhook          = flag.String("deploy-webhook", "false", "deploy wasp-webhook, which stamps the swap policy of pods at admission")
 	operatorImage          = flag.String("operator-image", "", "")
 	verbosity              = flag.String("verbosity", "1", "")
 	pullPolicy             = flag.String("pull-policy", "", "")
 	crName                 = flag.String("cr-name", "", "")
 	namespace              = flag.String("namespace", "", "")
+	flavour                = flag.String("flavour", wasp.FlavourOpenShift, "openshift, kubernetes, or auto to probe the API of the current kubeconfig")
+	outputFormat           = flag.String("output-format", "yaml", "yaml, helm, kustomize or olm-bundle")
+	outputDir              = flag.String("output-dir", "", "directory the Helm chart, the Kustomize base or the OLM bundle is written to")
 )
 
 func main() {
@@ -79,6 +94,10 @@ func main() {
 		}
 	})
 
+	if err := resolveFlavour(); err != nil {
+		klog.Fatalf("Error resolving the flavour: %v", err)
+	}
+
 	if *templFile != "" {
 		generateFromFile(*templFile)
 		return
@@ -86,7 +105,24 @@ func main() {
 
 	rules.SetupRules()
 
-	generateFromCode(*resourceType, *resourceGroup)
+	switch *outputFormat {
+	case "yaml":
+		generateFromCode(*resourceType, *resourceGroup)
+	case "helm":
+		if err := generateHelmChart(*outputDir); err != nil {
+			klog.Fatalf("Error generating the Helm chart: %v", err)
+		}
+	case "kustomize":
+		if err := generateKustomize(*outputDir); err != nil {
+			klog.Fatalf("Error generating the Kustomize base: %v", err)
+		}
+	case "olm-bundle":
+		if err := generateOLMBundle(*outputDir); err != nil {
+			klog.Fatalf("Error generating the OLM bundle: %v", err)
+		}
+	default:
+		klog.Fatalf("Unknown output format %s", *outputFormat)
+	}
 }
 
 func generateFromFile(templFile string) {
@@ -98,6 +134,10 @@ func generateFromFile(templFile string) {
 		PullPolicy:             *pullPolicy,
 		CrName:                 *crName,
 		Namespace:              *namespace,
+		Flavour:                *flavour,
+	}
+	if *flavour == wasp.FlavourKubernetes {
+		data.PodSecurityLabels = wasp.PodSecurityLabels
 	}
 
 	file, err := os.Open(templFile)
@@ -159,17 +199,50 @@ func generateFromCode(resourceType, resourceGroup string) {
 }
 
 func getOperatorResources(resourceGroup string) ([]client.Object, error) {
+	return wasp.CreateOperatorResourceGroup(resourceGroup, getFactoryArgs())
+}
+
+func getFactoryArgs() *wasp.FactoryArgs {
 	args := &wasp.FactoryArgs{
 		NamespacedArgs: args2.FactoryArgs{
 			Verbosity:              *verbosity,
 			OperatorVersion:        *operatorVersion,
 			DeployClusterResources: *deployClusterResources,
 			DeployPrometheusRule:   *deployPrometheusRule,
+			DeployWebhook:          *deployWebhook,
 			PullPolicy:             *pullPolicy,
 			Namespace:              *namespace,
 		},
-		Image: *operatorImage,
+		Image:   *operatorImage,
+		Flavour: *flavour,
+	}
+	if err := setWorkload(args); err != nil {
+		klog.Fatalf("Error parsing the workload flags: %v", err)
 	}
+	return args
+}
 
-	return wasp.CreateOperatorResourceGroup(resourceGroup, args)
+// resolveFlavour probes the API for the flavour when the flag asks for it. The generation fails when the cluster
+// can't be probed, rather than generating a flavour the cluster may not run.
+func resolveFlavour() error {
+	if *flavour != flavourAuto {
+		return wasp.ValidateFlavour(*flavour)
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("no cluster to probe: %v", err)
+	}
+	config.Timeout = probeTimeout
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	detected, err := wasp.DetectFlavour(client)
+	if err != nil {
+		return fmt.Errorf("failed to probe the cluster: %v", err)
+	}
+	klog.V(1).Infof("Generating the %s flavour of the cluster", detected)
+	*flavour = detected
+	return nil
 }
@@ -0,0 +1,115 @@
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	wasp "github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/operator"
+)
+
+var (
+	replacesVersion = flag.String("replaces-version", "", "operator version replaced by the OLM bundle, none when empty")
+	channel         = flag.String("channel", "stable", "channel of the OLM bundle")
+)
+
+type bundleAnnotations struct {
+	Annotations map[string]string `json:"annotations"`
+}
+
+// generateOLMBundle writes a registry+v1 bundle installing wasp-operator with OLM: the CSV and the CRDs in
+// manifests/, the annotations in metadata/, and the bundle.Dockerfile building the bundle image. The RBAC of
+// wasp-operator is carried by the cluster permissions of the CSV.
+func generateOLMBundle(dir string) error {
+	manifestsDir := filepath.Join(dir, "manifests")
+	metadataDir := filepath.Join(dir, "metadata")
+	for _, d := range []string{manifestsDir, metadataDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+
+	version := semanticVersion(*operatorVersion)
+	data := &wasp.ClusterServiceVersionData{
+		CsvVersion:      version,
+		Namespace:       *namespace,
+		ImagePullPolicy: *pullPolicy,
+		Verbosity:       *verbosity,
+		OperatorVersion: *operatorVersion,
+		OperatorImage:   *operatorImage,
+	}
+	if *replacesVersion != "" {
+		data.ReplacesCsvVersion = semanticVersion(*replacesVersion)
+	}
+	csv, err := wasp.CreateClusterServiceVersion(data)
+	if err != nil {
+		return err
+	}
+	manifest, err := marshallObjects(csv)
+	if err != nil {
+		return err
+	}
+	csvFile := fmt.Sprintf("%s.clusterserviceversion.yaml", wasp.CSVPackageName)
+	if err := os.WriteFile(filepath.Join(manifestsDir, csvFile), []byte(manifest), 0644); err != nil {
+		return err
+	}
+
+	crds, err := wasp.CreateOperatorResourceGroup("wasp-crd", getFactoryArgs())
+	if err != nil {
+		return err
+	}
+	for _, crd := range crds {
+		manifest, err := marshallObjects(crd)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(manifestsDir, crd.GetName()+".crd.yaml"), []byte(manifest), 0644); err != nil {
+			return err
+		}
+	}
+
+	annotations := map[string]string{
+		"operators.operatorframework.io.bundle.mediatype.v1":       "registry+v1",
+		"operators.operatorframework.io.bundle.manifests.v1":       "manifests/",
+		"operators.operatorframework.io.bundle.metadata.v1":        "metadata/",
+		"operators.operatorframework.io.bundle.package.v1":         wasp.CSVPackageName,
+		"operators.operatorframework.io.bundle.channels.v1":        *channel,
+		"operators.operatorframework.io.bundle.channel.default.v1": *channel,
+	}
+	if err := writeYAML(filepath.Join(metadataDir, "annotations.yaml"), bundleAnnotations{Annotations: annotations}); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "bundle.Dockerfile"), []byte(bundleDockerfile(annotations)), 0644)
+}
+
+// bundleDockerfile builds the bundle image, labelled with the annotations of the bundle
+func bundleDockerfile(annotations map[string]string) string {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("FROM scratch\n\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "LABEL %s=%s\n", key, annotations[key])
+	}
+	b.WriteString("\nCOPY manifests /manifests/\nCOPY metadata /metadata/\n")
+	return b.String()
+}
@@ -0,0 +1,163 @@
+//Licensed under the Apache License, Version 2.0 (the "License");
+//you may not use this file except in compliance with the License.
+//You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+//Unless required by applicable law or agreed to in writing, software
+//distributed under the License is distributed on an "AS IS" BASIS,
+//WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//See the License for the specific language governing permissions and
+//limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	wasp "github.com/openshift-virtualization/wasp-agent/pkg/wasp/resources/operator"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	nodeSelector     = flag.String("node-selector", "", "node selector of wasp-agent, e.g. node-role.kubernetes.io/worker=,wasp.io/swap=true")
+	tolerations      = flag.String("tolerations", "", "tolerations added to the default ones of wasp-agent, as a YAML or JSON list")
+	affinity         = flag.String("affinity", "", "affinity of wasp-agent, as YAML or JSON")
+	resourceRequests = flag.String("resource-requests", "", "resource requests of wasp-agent replacing the default ones, e.g. cpu=100m,memory=50M")
+	resourceLimits   = flag.String("resource-limits", "", "resource limits of wasp-agent, e.g. memory=500M")
+	extraEnv         = flag.String("extra-env", "", "environment added to wasp-agent, e.g. GOMAXPROCS=2,GOGC=50")
+	priorityClass    = flag.String("priority-class", "", "priority class of wasp-agent, system-node-critical when empty")
+	updateStrategy   = flag.String("update-strategy", "", "update strategy of the wasp-agent DaemonSet, RollingUpdate or OnDelete")
+	maxUnavailable   = flag.String("max-unavailable", "", "maximal number or percentage of unavailable wasp-agent pods during a rolling update")
+	swapProvisioning = flag.Bool("swap-provisioning", false, "mount the root of the host with the kubernetes flavour, for wasp-agent to provision swap")
+	swapDisabled     = flag.String("swap-disabled-priority-classes", "", "priority classes whose pods get no swap from wasp-webhook, e.g. batch-low,batch-high")
+)
+
+// setWorkload fills the factory arguments from the workload flags
+func setWorkload(args *wasp.FactoryArgs) error {
+	var err error
+	if args.Placement.NodeSelector, err = parseKeyValues(*nodeSelector); err != nil {
+		return fmt.Errorf("invalid node selector: %v", err)
+	}
+	if *tolerations != "" {
+		if err := yaml.UnmarshalStrict([]byte(*tolerations), &args.Placement.Tolerations); err != nil {
+			return fmt.Errorf("invalid tolerations: %v", err)
+		}
+	}
+	if *affinity != "" {
+		args.Placement.Affinity = &corev1.Affinity{}
+		if err := yaml.UnmarshalStrict([]byte(*affinity), args.Placement.Affinity); err != nil {
+			return fmt.Errorf("invalid affinity: %v", err)
+		}
+	}
+	if args.Resources, err = parseResources(*resourceRequests, *resourceLimits); err != nil {
+		return err
+	}
+	if args.Env, err = parseEnv(*extraEnv); err != nil {
+		return fmt.Errorf("invalid environment: %v", err)
+	}
+	args.PriorityClassName = *priorityClass
+	args.SwapProvisioning = *swapProvisioning
+	for _, name := range strings.Split(*swapDisabled, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			args.SwapDisabledPriorityClasses = append(args.SwapDisabledPriorityClasses, name)
+		}
+	}
+	args.UpdateStrategy, err = parseUpdateStrategy(*updateStrategy, *maxUnavailable)
+	return err
+}
+
+// parseKeyValues parses a comma separated list of key=value pairs, a key without a value maps to an empty value
+func parseKeyValues(list string) (map[string]string, error) {
+	env, err := parseEnv(list)
+	if err != nil || env == nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for _, v := range env {
+		result[v.Name] = v.Value
+	}
+	return result, nil
+}
+
+// parseEnv parses a comma separated list of NAME=value pairs, keeping their order
+func parseEnv(list string) ([]corev1.EnvVar, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var result []corev1.EnvVar
+	for _, pair := range strings.Split(list, ",") {
+		key, value, _ := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); key == "" {
+			return nil, fmt.Errorf("missing key in %q", pair)
+		}
+		result = append(result, corev1.EnvVar{Name: key, Value: strings.TrimSpace(value)})
+	}
+	return result, nil
+}
+
+func parseResourceList(list string) (corev1.ResourceList, error) {
+	quantities, err := parseKeyValues(list)
+	if err != nil || quantities == nil {
+		return nil, err
+	}
+	result := make(corev1.ResourceList)
+	for name, value := range quantities {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q of %s: %v", value, name, err)
+		}
+		result[corev1.ResourceName(name)] = quantity
+	}
+	return result, nil
+}
+
+func parseResources(requests, limits string) (*corev1.ResourceRequirements, error) {
+	if requests == "" && limits == "" {
+		return nil, nil
+	}
+	var err error
+	resources := &corev1.ResourceRequirements{}
+	if resources.Requests, err = parseResourceList(requests); err != nil {
+		return nil, fmt.Errorf("invalid resource requests: %v", err)
+	}
+	if resources.Limits, err = parseResourceList(limits); err != nil {
+		return nil, fmt.Errorf("invalid resource limits: %v", err)
+	}
+	return resources, nil
+}
+
+func parseUpdateStrategy(strategyType, maxUnavailable string) (*appsv1.DaemonSetUpdateStrategy, error) {
+	switch appsv1.DaemonSetUpdateStrategyType(strategyType) {
+	case "":
+		if maxUnavailable != "" {
+			return nil, fmt.Errorf("max-unavailable requires the %s update strategy", appsv1.RollingUpdateDaemonSetStrategyType)
+		}
+		return nil, nil
+	case appsv1.OnDeleteDaemonSetStrategyType:
+		if maxUnavailable != "" {
+			return nil, fmt.Errorf("max-unavailable doesn't apply to the %s update strategy", appsv1.OnDeleteDaemonSetStrategyType)
+		}
+		return &appsv1.DaemonSetUpdateStrategy{Type: appsv1.OnDeleteDaemonSetStrategyType}, nil
+	case appsv1.RollingUpdateDaemonSetStrategyType:
+		strategy := &appsv1.DaemonSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateDaemonSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateDaemonSet{},
+		}
+		if maxUnavailable != "" {
+			value := intstr.Parse(maxUnavailable)
+			strategy.RollingUpdate.MaxUnavailable = &value
+		}
+		return strategy, nil
+	default:
+		return nil, fmt.Errorf("unknown update strategy %q, expected %s or %s", strategyType,
+			appsv1.RollingUpdateDaemonSetStrategyType, appsv1.OnDeleteDaemonSetStrategyType)
+	}
+}
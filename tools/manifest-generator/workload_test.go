@@ -0,0 +1,68 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("Workload flags", func() {
+	It("should parse the environment in order", func() {
+		env, err := parseEnv("MEMORY_PROTECTION=low, SWAP_PRESSURE_TAINT=true,EMPTY")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env).To(Equal([]corev1.EnvVar{
+			{Name: "MEMORY_PROTECTION", Value: "low"},
+			{Name: "SWAP_PRESSURE_TAINT", Value: "true"},
+			{Name: "EMPTY"},
+		}))
+
+		_, err = parseEnv("=low")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should parse a node selector", func() {
+		selector, err := parseKeyValues("wasp.io/swap=true,node-role.kubernetes.io/worker=")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selector).To(Equal(map[string]string{"wasp.io/swap": "true", "node-role.kubernetes.io/worker": ""}))
+
+		selector, err = parseKeyValues("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selector).To(BeNil())
+	})
+
+	It("should parse the resources", func() {
+		resources, err := parseResources("cpu=100m,memory=50M", "memory=500M")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources.Requests).To(Equal(corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("50M"),
+		}))
+		Expect(resources.Limits).To(Equal(corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("500M")}))
+
+		_, err = parseResources("memory=lots", "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("parseUpdateStrategy", func(strategyType, maxUnavailable string, expected *appsv1.DaemonSetUpdateStrategy, valid bool) {
+		strategy, err := parseUpdateStrategy(strategyType, maxUnavailable)
+		if !valid {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strategy).To(Equal(expected))
+	},
+		Entry("default", "", "", nil, true),
+		Entry("on delete", "OnDelete", "", &appsv1.DaemonSetUpdateStrategy{Type: appsv1.OnDeleteDaemonSetStrategyType}, true),
+		Entry("rolling update", "RollingUpdate", "20%", &appsv1.DaemonSetUpdateStrategy{
+			Type:          appsv1.RollingUpdateDaemonSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateDaemonSet{MaxUnavailable: &intstr.IntOrString{Type: intstr.String, StrVal: "20%"}},
+		}, true),
+		Entry("max unavailable without rolling update", "", "1", nil, false),
+		Entry("max unavailable with on delete", "OnDelete", "1", nil, false),
+		Entry("unknown", "Recreate", "", nil, false),
+	)
+})